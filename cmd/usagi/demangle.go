@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"codeberg.org/rileyq/usagi/internal/compile/semantics"
+)
+
+func init() {
+	commands = append(commands, &command{
+		name:  "demangle",
+		short: "demangle link names, or filter them from standard input",
+		run:   runDemangle,
+	})
+}
+
+func runDemangle(args []string) error {
+	fs := newFlagSet("demangle", "[name ...]")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return demangleFilter(os.Stdout, os.Stdin)
+	}
+	var errs []error
+	for _, name := range fs.Args() {
+		demangled, err := semantics.Demangle(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Println(demangled)
+	}
+	return errors.Join(errs...)
+}
+
+// demangleFilter copies r to w line by line, demangling the link names in
+// each line, so that it can follow tools such as nm and objdump in a
+// pipeline.
+func demangleFilter(w io.Writer, r io.Reader) error {
+	in := bufio.NewReader(r)
+	out := bufio.NewWriter(w)
+	for {
+		line, err := in.ReadString('\n')
+		out.WriteString(semantics.DemangleAll(line))
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// Lines are passed on as they arrive when reading interactively.
+		if in.Buffered() == 0 {
+			if err := out.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return out.Flush()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+
+	"codeberg.org/rileyq/usagi/internal/compile/ast/astjson"
+	"codeberg.org/rileyq/usagi/internal/compile/parser"
+)
+
+func init() {
+	commands = append(commands, &command{
+		name:  "dump",
+		short: "print the syntax tree of a file as JSON",
+		run:   runDump,
+	})
+}
+
+func runDump(args []string) error {
+	fs := newFlagSet("dump", "[file]")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	path := "-"
+	if fs.NArg() == 1 {
+		path = fs.Arg(0)
+	}
+
+	src, err := readSource(path)
+	if err != nil {
+		return err
+	}
+
+	module, err := parser.ParseBytes(moduleName(path), src)
+	if err != nil {
+		return err
+	}
+
+	return astjson.Encode(os.Stdout, module)
+}
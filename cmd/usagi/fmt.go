@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"codeberg.org/rileyq/usagi/internal/compile/format"
+	"codeberg.org/rileyq/usagi/internal/diff"
+)
+
+func init() {
+	commands = append(commands, &command{
+		name:  "fmt",
+		short: "format source files",
+		run:   runFmt,
+	})
+}
+
+type fmtFlags struct {
+	write bool
+	diff  bool
+	list  bool
+}
+
+func runFmt(args []string) error {
+	var flags fmtFlags
+	fs := newFlagSet("fmt", "[-w] [-d] [-l] [file ...]")
+	fs.BoolVar(&flags.write, "w", false, "write the result to the source file instead of standard output")
+	fs.BoolVar(&flags.diff, "d", false, "display diffs instead of rewriting files")
+	fs.BoolVar(&flags.list, "l", false, "list files whose formatting differs")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		if flags.write {
+			return errors.New("cannot use -w with standard input")
+		}
+		paths = []string{"-"}
+	}
+
+	var errs []error
+	for _, path := range paths {
+		err := formatFile(path, &flags)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func formatFile(path string, flags *fmtFlags) error {
+	src, err := readSource(path)
+	if err != nil {
+		return err
+	}
+
+	name := displayName(path)
+	res, err := format.Source(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	changed := !bytes.Equal(src, res)
+	if flags.list && changed {
+		fmt.Println(name)
+	}
+	if flags.write && changed {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(path, res, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+	}
+	if flags.diff && changed {
+		_, err = os.Stdout.Write(diff.Unified(name+".orig", name, src, res))
+		if err != nil {
+			return err
+		}
+	}
+	if !flags.list && !flags.write && !flags.diff {
+		_, err = os.Stdout.Write(res)
+		return err
+	}
+	return nil
+}
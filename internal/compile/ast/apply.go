@@ -0,0 +1,274 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// An ApplyFunc is invoked by Apply for each node n, even if n is nil,
+// before and/or after the node's children, using a Cursor describing the
+// current node and providing operations on it.
+//
+// The return value of ApplyFunc controls the syntax tree traversal. See
+// Apply for details.
+type ApplyFunc func(*Cursor) bool
+
+// Apply traverses a syntax tree recursively, starting with root, and
+// calling pre and post for each node as described below. Apply returns
+// the syntax tree, possibly modified.
+//
+// If pre is not nil, it is called for each node before the node's
+// children are traversed (pre-order). If pre returns false, no children
+// are traversed, and post is not called for that node.
+//
+// If post is not nil, and a prior call of pre didn't return false, post
+// is called for each node after its children are traversed (post-order).
+// If post returns false, traversal is terminated and Apply returns
+// immediately.
+//
+// Children are traversed in the same order as Walk. Nodes inserted or
+// used as replacements during traversal are not visited.
+func Apply(root Node, pre, post ApplyFunc) (result Node) {
+	parent := &struct{ Node }{root}
+	defer func() {
+		if r := recover(); r != nil && r != errAbort {
+			panic(r)
+		}
+		result = parent.Node
+	}()
+	a := &application{pre: pre, post: post}
+	a.apply(parent, "Node", nil, root)
+	return
+}
+
+var errAbort = new(int)
+
+// A Cursor describes a node encountered during Apply. Information about
+// the node and its parent is available from the Node, Parent, Name and
+// Index methods.
+type Cursor struct {
+	parent Node
+	name   string
+	iter   *iterator
+	node   Node
+}
+
+// Node returns the current node.
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the parent of the current node.
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Name returns the name of the parent field that contains the current
+// node.
+func (c *Cursor) Name() string { return c.name }
+
+// Index reports the index of the current node in the slice of nodes that
+// contains it, or a value < 0 if the current node is not part of a slice.
+func (c *Cursor) Index() int {
+	if c.iter != nil {
+		return c.iter.index
+	}
+	return -1
+}
+
+func (c *Cursor) field() reflect.Value {
+	return reflect.Indirect(reflect.ValueOf(c.parent)).FieldByName(c.name)
+}
+
+// Replace replaces the current node with n. The replacement node is not
+// walked by Apply.
+func (c *Cursor) Replace(n Node) {
+	v := c.field()
+	if i := c.Index(); i >= 0 {
+		v = v.Index(i)
+	}
+	v.Set(nodeValue(v.Type(), n))
+}
+
+// Delete deletes the current node from its containing slice. If the
+// current node is not part of a slice, Delete panics.
+func (c *Cursor) Delete() {
+	i := c.Index()
+	if i < 0 {
+		panic("Delete node not contained in slice")
+	}
+	v := c.field()
+	l := v.Len()
+	reflect.Copy(v.Slice(i, l), v.Slice(i+1, l))
+	v.Index(l - 1).Set(reflect.Zero(v.Type().Elem()))
+	v.SetLen(l - 1)
+	c.iter.step--
+}
+
+// InsertAfter inserts n after the current node in its containing slice.
+// If the current node is not part of a slice, InsertAfter panics. Apply
+// does not walk n.
+func (c *Cursor) InsertAfter(n Node) {
+	i := c.Index()
+	if i < 0 {
+		panic("InsertAfter node not contained in slice")
+	}
+	v := c.field()
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+2, l), v.Slice(i+1, l))
+	v.Index(i + 1).Set(nodeValue(v.Type().Elem(), n))
+	c.iter.step++
+}
+
+// InsertBefore inserts n before the current node in its containing
+// slice. If the current node is not part of a slice, InsertBefore
+// panics. Apply does not walk n.
+func (c *Cursor) InsertBefore(n Node) {
+	i := c.Index()
+	if i < 0 {
+		panic("InsertBefore node not contained in slice")
+	}
+	v := c.field()
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+1, l), v.Slice(i, l))
+	v.Index(i).Set(nodeValue(v.Type().Elem(), n))
+	c.iter.index++
+}
+
+func nodeValue(typ reflect.Type, n Node) reflect.Value {
+	if n == nil {
+		return reflect.Zero(typ)
+	}
+	return reflect.ValueOf(n)
+}
+
+type iterator struct {
+	index, step int
+}
+
+type application struct {
+	pre, post ApplyFunc
+	cursor    Cursor
+	iter      iterator
+}
+
+func (a *application) apply(parent Node, name string, iter *iterator, n Node) {
+	// Typed nils are reported to pre and post as untyped nils.
+	if v := reflect.ValueOf(n); v.Kind() == reflect.Pointer && v.IsNil() {
+		n = nil
+	}
+
+	saved := a.cursor
+	a.cursor.parent = parent
+	a.cursor.name = name
+	a.cursor.iter = iter
+	a.cursor.node = n
+
+	if a.pre != nil && !a.pre(&a.cursor) {
+		a.cursor = saved
+		return
+	}
+
+	switch n := n.(type) {
+	case nil, *Identifier, *Literal, *VarArgExpr, *BreakExpr, *BadExpr:
+		// nothing to do
+	case *Module:
+		a.applyList(n, "Decls")
+	case *Binding:
+		a.apply(n, "Name", nil, n.Name)
+		a.apply(n, "Type", nil, n.Type)
+		a.apply(n, "Value", nil, n.Value)
+	case *CallExpr:
+		a.apply(n, "Base", nil, n.Base)
+		a.applyList(n, "Args")
+	case *FuncExpr:
+		a.applyList(n, "Params")
+		a.apply(n, "ReturnType", nil, n.ReturnType)
+		a.apply(n, "Body", nil, n.Body)
+	case *Param:
+		a.apply(n, "Name", nil, n.Name)
+		a.apply(n, "Type", nil, n.Type)
+		a.apply(n, "Default", nil, n.Default)
+	case *BlockExpr:
+		a.applyList(n, "List")
+	case *ReturnExpr:
+		a.apply(n, "Value", nil, n.Value)
+	case *BinaryExpr:
+		a.apply(n, "Left", nil, n.Left)
+		a.apply(n, "Right", nil, n.Right)
+	case *UnaryExpr:
+		a.apply(n, "Base", nil, n.Base)
+	case *ExprStmt:
+		a.apply(n, "X", nil, n.X)
+	case *MemberExpr:
+		a.apply(n, "Base", nil, n.Base)
+		a.apply(n, "Member", nil, n.Member)
+	case *SliceExpr:
+		a.apply(n, "Base", nil, n.Base)
+	case *ArrayExpr:
+		a.apply(n, "Len", nil, n.Len)
+		a.apply(n, "Base", nil, n.Base)
+	case *ManyPointerExpr:
+		a.apply(n, "Base", nil, n.Base)
+	case *IfExpr:
+		a.apply(n, "Cond", nil, n.Cond)
+		a.apply(n, "Block", nil, n.Block)
+	case *WhileExpr:
+		a.apply(n, "Cond", nil, n.Cond)
+		a.apply(n, "Block", nil, n.Block)
+	case *StructExpr:
+		a.applyList(n, "Members")
+	case *UnionExpr:
+		a.applyList(n, "Members")
+	case *Field:
+		a.apply(n, "Name", nil, n.Name)
+		a.apply(n, "Type", nil, n.Type)
+		a.apply(n, "Default", nil, n.Default)
+	case *NamedArg:
+		a.apply(n, "Name", nil, n.Name)
+		a.apply(n, "Value", nil, n.Value)
+	case *TraitExpr:
+		a.applyList(n, "Traits")
+		a.applyList(n, "Members")
+	case *ImplDecl:
+		a.apply(n, "Type", nil, n.Type)
+		a.applyList(n, "Traits")
+		a.applyList(n, "Definitions")
+	case *ExistentialExpr:
+		a.apply(n, "Base", nil, n.Base)
+	case *DeclStmt:
+		a.apply(n, "X", nil, n.X)
+	case *IndexExpr:
+		a.apply(n, "Base", nil, n.Base)
+		a.applyList(n, "Indices")
+	default:
+		panic(fmt.Sprintf("ast.Apply: unexpected node type %T", n))
+	}
+
+	if a.post != nil && !a.post(&a.cursor) {
+		panic(errAbort)
+	}
+
+	a.cursor = saved
+}
+
+func (a *application) applyList(parent Node, name string) {
+	saved := a.iter
+	a.iter.index = 0
+	for {
+		// The slice is reloaded on every step since the cursor may have
+		// modified it.
+		v := reflect.Indirect(reflect.ValueOf(parent)).FieldByName(name)
+		if a.iter.index >= v.Len() {
+			break
+		}
+
+		var x Node
+		if e := v.Index(a.iter.index); e.IsValid() && !e.IsNil() {
+			x = e.Interface().(Node)
+		}
+
+		a.iter.step = 1
+		a.apply(parent, name, &a.iter, x)
+		a.iter.index += a.iter.step
+	}
+	a.iter = saved
+}
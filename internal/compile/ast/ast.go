@@ -27,6 +27,69 @@ type Decl interface {
 	astDecl()
 }
 
+// pos and end return the range of n, or NoPos if n is absent, so that
+// nodes missing children, as built by hand or while parsing, can still be
+// asked for their range. Identifier and BlockExpr, the node types of
+// pointer fields, allow nil receivers for the same reason.
+func pos(n Node) token.Pos {
+	if n == nil {
+		return token.NoPos
+	}
+	return n.Pos()
+}
+
+func end(n Node) token.Pos {
+	if n == nil {
+		return token.NoPos
+	}
+	return n.End()
+}
+
+// after returns the position n bytes after p, or NoPos if p is NoPos.
+func after(p token.Pos, n int) token.Pos {
+	if p == token.NoPos {
+		return token.NoPos
+	}
+	return p + token.Pos(n)
+}
+
+// NodeTypes returns a nil pointer of each node type, for code that handles
+// every type of node, such as encoders.
+func NodeTypes() []Node {
+	return []Node{
+		(*Module)(nil),
+		(*Binding)(nil),
+		(*Identifier)(nil),
+		(*CallExpr)(nil),
+		(*Literal)(nil),
+		(*FuncExpr)(nil),
+		(*Param)(nil),
+		(*BlockExpr)(nil),
+		(*ReturnExpr)(nil),
+		(*BreakExpr)(nil),
+		(*BinaryExpr)(nil),
+		(*UnaryExpr)(nil),
+		(*ExprStmt)(nil),
+		(*MemberExpr)(nil),
+		(*SliceExpr)(nil),
+		(*ArrayExpr)(nil),
+		(*ManyPointerExpr)(nil),
+		(*VarArgExpr)(nil),
+		(*IfExpr)(nil),
+		(*WhileExpr)(nil),
+		(*BadExpr)(nil),
+		(*StructExpr)(nil),
+		(*UnionExpr)(nil),
+		(*Field)(nil),
+		(*NamedArg)(nil),
+		(*TraitExpr)(nil),
+		(*ImplDecl)(nil),
+		(*ExistentialExpr)(nil),
+		(*DeclStmt)(nil),
+		(*IndexExpr)(nil),
+	}
+}
+
 type Module struct {
 	Name  string
 	Decls []Decl
@@ -48,15 +111,28 @@ func (m BindingMode) Export() bool { return m&ModeExport != 0 }
 func (m BindingMode) Const() bool  { return m&ModeConst != 0 }
 
 type Binding struct {
-	Token token.Type
-	Mode  BindingMode
-	Name  *Identifier
-	Type  Expr
-	Value Expr
+	BindingPos token.Pos
+	Token      token.Type
+	Mode       BindingMode
+	Name       *Identifier
+	Type       Expr
+	Value      Expr
+	Semicolon  token.Pos
 }
 
-func (b *Binding) Pos() token.Pos { return b.Name.Pos() }
-func (b *Binding) End() token.Pos { panic("TODO") }
+func (b *Binding) Pos() token.Pos { return b.BindingPos }
+func (b *Binding) End() token.Pos {
+	switch {
+	case b.Semicolon != token.NoPos:
+		return b.Semicolon + 1
+	case b.Value != nil:
+		return end(b.Value)
+	case b.Type != nil:
+		return end(b.Type)
+	default:
+		return end(b.Name)
+	}
+}
 
 func (*Binding) astNode() {}
 func (*Binding) astDecl() {}
@@ -67,42 +143,71 @@ type Identifier struct {
 	Name    string
 }
 
-func (id *Identifier) Pos() token.Pos { return id.NamePos }
-func (id *Identifier) End() token.Pos { return id.NameEnd }
+func (id *Identifier) Pos() token.Pos {
+	if id == nil {
+		return token.NoPos
+	}
+	return id.NamePos
+}
+
+func (id *Identifier) End() token.Pos {
+	if id == nil {
+		return token.NoPos
+	}
+	return id.NameEnd
+}
 
 func (id *Identifier) astNode() {}
 func (id *Identifier) astExpr() {}
 
 type CallExpr struct {
-	Base Expr
-	Args []Expr
+	Base   Expr
+	Args   []Expr
+	Rparen token.Pos
 }
 
-func (expr *CallExpr) Pos() token.Pos { return expr.Base.Pos() }
-func (expr *CallExpr) End() token.Pos { return expr.Base.End() }
+func (expr *CallExpr) Pos() token.Pos { return pos(expr.Base) }
+func (expr *CallExpr) End() token.Pos { return after(expr.Rparen, 1) }
 
 func (expr *CallExpr) astNode() {}
 func (expr *CallExpr) astExpr() {}
 
 type Literal struct {
-	Tok   token.Type
-	Value string
+	ValuePos token.Pos
+	Tok      token.Type
+	Value    string
 }
 
-func (expr *Literal) Pos() token.Pos { panic("TODO") }
-func (expr *Literal) End() token.Pos { panic("TODO") }
+func (expr *Literal) Pos() token.Pos { return expr.ValuePos }
+func (expr *Literal) End() token.Pos { return after(expr.ValuePos, len(expr.Value)) }
 
 func (expr *Literal) astNode() {}
 func (expr *Literal) astExpr() {}
 
+// FuncExpr is a function literal or type. Func is NoPos when the
+// function is declared by a func binding, which owns the keyword.
 type FuncExpr struct {
+	Func       token.Pos
+	Lparen     token.Pos
 	Params     []*Param
+	Rparen     token.Pos
 	ReturnType Expr
 	Body       *BlockExpr
 }
 
-func (expr *FuncExpr) Pos() token.Pos { panic("TODO") }
-func (expr *FuncExpr) End() token.Pos { panic("TODO") }
+func (expr *FuncExpr) Pos() token.Pos {
+	if expr.Func != token.NoPos {
+		return expr.Func
+	}
+	return expr.Lparen
+}
+
+func (expr *FuncExpr) End() token.Pos {
+	if expr.Body != nil {
+		return end(expr.Body)
+	}
+	return end(expr.ReturnType)
+}
 
 func (expr *FuncExpr) astNode() {}
 func (expr *FuncExpr) astExpr() {}
@@ -110,60 +215,113 @@ func (expr *FuncExpr) astExpr() {}
 type Param struct {
 	Name *Identifier
 	Type Expr
+	// Default is the value of the parameter when a call omits it, or nil
+	// if the argument is required.
+	Default Expr
+}
+
+func (p *Param) Pos() token.Pos {
+	if p.Name != nil {
+		return pos(p.Name)
+	}
+	return pos(p.Type)
 }
 
-func (p *Param) Pos() token.Pos { panic("TODO") }
-func (p *Param) End() token.Pos { panic("TODO") }
+func (p *Param) End() token.Pos {
+	if p.Default != nil {
+		return end(p.Default)
+	}
+	return end(p.Type)
+}
 
 func (p *Param) astNode() {}
 
 type BlockExpr struct {
-	List []Stmt
+	Lbrace token.Pos
+	List   []Stmt
+	Rbrace token.Pos
 }
 
-func (expr *BlockExpr) Pos() token.Pos { panic("TODO") }
-func (expr *BlockExpr) End() token.Pos { panic("TODO") }
+func (expr *BlockExpr) Pos() token.Pos {
+	if expr == nil {
+		return token.NoPos
+	}
+	return expr.Lbrace
+}
+
+func (expr *BlockExpr) End() token.Pos {
+	if expr == nil {
+		return token.NoPos
+	}
+	return after(expr.Rbrace, 1)
+}
 
 func (*BlockExpr) astNode() {}
 func (*BlockExpr) astExpr() {}
 
 type ReturnExpr struct {
-	Value Expr
+	Return token.Pos
+	Value  Expr
 }
 
-func (expr *ReturnExpr) Pos() token.Pos { panic("TODO") }
-func (expr *ReturnExpr) End() token.Pos { panic("TODO") }
+func (expr *ReturnExpr) Pos() token.Pos { return expr.Return }
+func (expr *ReturnExpr) End() token.Pos {
+	if expr.Value != nil {
+		return end(expr.Value)
+	}
+	return after(expr.Return, len("return"))
+}
 
 func (*ReturnExpr) astNode() {}
 func (*ReturnExpr) astExpr() {}
 
+// BreakExpr leaves the innermost enclosing while loop.
+type BreakExpr struct {
+	Break token.Pos
+}
+
+func (expr *BreakExpr) Pos() token.Pos { return expr.Break }
+func (expr *BreakExpr) End() token.Pos { return after(expr.Break, len("break")) }
+
+func (*BreakExpr) astNode() {}
+func (*BreakExpr) astExpr() {}
+
 type BinaryExpr struct {
 	Left  Expr
 	Op    token.Type
 	Right Expr
 }
 
-func (expr *BinaryExpr) Pos() token.Pos { return expr.Left.Pos() }
-func (expr *BinaryExpr) End() token.Pos { return expr.Right.End() }
+func (expr *BinaryExpr) Pos() token.Pos { return pos(expr.Left) }
+func (expr *BinaryExpr) End() token.Pos { return end(expr.Right) }
 
 func (*BinaryExpr) astNode() {}
 func (*BinaryExpr) astExpr() {}
 
 type UnaryExpr struct {
-	Op   token.Type
-	Base Expr
+	OpPos token.Pos
+	Op    token.Type
+	Base  Expr
 }
 
-func (*UnaryExpr) Pos() token.Pos { panic("TODO") }
-func (*UnaryExpr) End() token.Pos { panic("TODO") }
+func (expr *UnaryExpr) Pos() token.Pos { return expr.OpPos }
+func (expr *UnaryExpr) End() token.Pos { return end(expr.Base) }
 
 func (*UnaryExpr) astNode() {}
 func (*UnaryExpr) astExpr() {}
 
-type ExprStmt struct{ X Expr }
+type ExprStmt struct {
+	X         Expr
+	Semicolon token.Pos
+}
 
-func (stmt *ExprStmt) Pos() token.Pos { return stmt.X.Pos() }
-func (stmt *ExprStmt) End() token.Pos { return stmt.X.End() }
+func (stmt *ExprStmt) Pos() token.Pos { return pos(stmt.X) }
+func (stmt *ExprStmt) End() token.Pos {
+	if stmt.Semicolon != token.NoPos {
+		return stmt.Semicolon + 1
+	}
+	return end(stmt.X)
+}
 
 func (*ExprStmt) astNode() {}
 func (*ExprStmt) astStmt() {}
@@ -173,76 +331,141 @@ type MemberExpr struct {
 	Member *Identifier
 }
 
-func (expr *MemberExpr) Pos() token.Pos { return expr.Base.Pos() }
-func (expr *MemberExpr) End() token.Pos { return expr.Member.End() }
+func (expr *MemberExpr) Pos() token.Pos { return pos(expr.Base) }
+func (expr *MemberExpr) End() token.Pos { return end(expr.Member) }
 
 func (*MemberExpr) astNode() {}
 func (*MemberExpr) astExpr() {}
 
 type SliceExpr struct {
-	Base Expr
+	Lbrack token.Pos
+	Base   Expr
 }
 
-func (expr *SliceExpr) Pos() token.Pos { panic("TODO") }
-func (expr *SliceExpr) End() token.Pos { return expr.Base.End() }
+func (expr *SliceExpr) Pos() token.Pos { return expr.Lbrack }
+func (expr *SliceExpr) End() token.Pos { return end(expr.Base) }
 
 func (*SliceExpr) astNode() {}
 func (*SliceExpr) astExpr() {}
 
+// ArrayExpr is an array type with Len elements of type Base.
+type ArrayExpr struct {
+	Lbrack token.Pos
+	Len    Expr
+	Base   Expr
+}
+
+func (expr *ArrayExpr) Pos() token.Pos { return expr.Lbrack }
+func (expr *ArrayExpr) End() token.Pos { return end(expr.Base) }
+
+func (*ArrayExpr) astNode() {}
+func (*ArrayExpr) astExpr() {}
+
 type ManyPointerExpr struct {
-	Base Expr
+	Lbrack token.Pos
+	Base   Expr
 }
 
-func (expr *ManyPointerExpr) Pos() token.Pos { panic("TODO") }
-func (expr *ManyPointerExpr) End() token.Pos { return expr.Base.End() }
+func (expr *ManyPointerExpr) Pos() token.Pos { return expr.Lbrack }
+func (expr *ManyPointerExpr) End() token.Pos { return end(expr.Base) }
 
 func (*ManyPointerExpr) astNode() {}
 func (*ManyPointerExpr) astExpr() {}
 
-type VarArgExpr struct{}
+type VarArgExpr struct {
+	Ellipses token.Pos
+}
 
-func (*VarArgExpr) Pos() token.Pos { panic("TODO") }
-func (*VarArgExpr) End() token.Pos { panic("TODO") }
+func (expr *VarArgExpr) Pos() token.Pos { return expr.Ellipses }
+func (expr *VarArgExpr) End() token.Pos { return after(expr.Ellipses, len("...")) }
 
 func (*VarArgExpr) astNode() {}
 func (*VarArgExpr) astExpr() {}
 
 type IfExpr struct {
+	If    token.Pos
 	Cond  Expr
 	Block *BlockExpr
 }
 
-func (*IfExpr) Pos() token.Pos { panic("TODO") }
-func (*IfExpr) End() token.Pos { panic("TODO") }
+func (expr *IfExpr) Pos() token.Pos { return expr.If }
+func (expr *IfExpr) End() token.Pos { return end(expr.Block) }
 
 func (*IfExpr) astNode() {}
 func (*IfExpr) astExpr() {}
 
-type BadExpr struct{}
+type WhileExpr struct {
+	While token.Pos
+	Cond  Expr
+	Block *BlockExpr
+}
+
+func (expr *WhileExpr) Pos() token.Pos { return expr.While }
+func (expr *WhileExpr) End() token.Pos { return end(expr.Block) }
 
-func (*BadExpr) Pos() token.Pos { panic("TODO") }
-func (*BadExpr) End() token.Pos { panic("TODO") }
+func (*WhileExpr) astNode() {}
+func (*WhileExpr) astExpr() {}
+
+type BadExpr struct {
+	From, To token.Pos
+}
+
+func (expr *BadExpr) Pos() token.Pos { return expr.From }
+func (expr *BadExpr) End() token.Pos { return expr.To }
 
 func (*BadExpr) astNode() {}
 func (*BadExpr) astExpr() {}
 
+// StructExpr is a struct type. Struct is NoPos when the struct is
+// declared by a struct binding, which owns the keyword.
 type StructExpr struct {
+	Struct  token.Pos
+	Lparen  token.Pos
 	Members []*Field
+	Rparen  token.Pos
+}
+
+func (expr *StructExpr) Pos() token.Pos {
+	if expr.Struct != token.NoPos {
+		return expr.Struct
+	}
+	return expr.Lparen
 }
 
-func (*StructExpr) Pos() token.Pos { panic("TODO") }
-func (*StructExpr) End() token.Pos { panic("TODO") }
+func (expr *StructExpr) End() token.Pos { return after(expr.Rparen, 1) }
 
 func (*StructExpr) astNode() {}
 func (*StructExpr) astExpr() {}
 
+type UnionExpr struct {
+	Union   token.Pos
+	Lparen  token.Pos
+	Members []*Field
+	Rparen  token.Pos
+}
+
+func (expr *UnionExpr) Pos() token.Pos { return expr.Union }
+func (expr *UnionExpr) End() token.Pos { return after(expr.Rparen, 1) }
+
+func (*UnionExpr) astNode() {}
+func (*UnionExpr) astExpr() {}
+
 type Field struct {
 	Name *Identifier
 	Type Expr
+	// Default is the value of the member when a constructor call omits
+	// it, or nil if the member is required.
+	Default Expr
 }
 
-func (*Field) Pos() token.Pos { panic("TODO") }
-func (*Field) End() token.Pos { panic("TODO") }
+func (f *Field) Pos() token.Pos { return pos(f.Name) }
+
+func (f *Field) End() token.Pos {
+	if f.Default != nil {
+		return end(f.Default)
+	}
+	return end(f.Type)
+}
 
 func (*Field) astNode() {}
 
@@ -251,42 +474,62 @@ type NamedArg struct {
 	Value Expr
 }
 
-func (*NamedArg) Pos() token.Pos { panic("TODO") }
-func (*NamedArg) End() token.Pos { panic("TODO") }
+func (arg *NamedArg) Pos() token.Pos { return pos(arg.Name) }
+func (arg *NamedArg) End() token.Pos { return end(arg.Value) }
 
 func (*NamedArg) astNode() {}
 func (*NamedArg) astExpr() {}
 
+// TraitExpr is a trait type. Trait is NoPos when the trait is declared
+// by a trait binding, which owns the keyword, and Lparen is NoPos when
+// there is no list of required traits.
 type TraitExpr struct {
+	Trait   token.Pos
 	Closed  bool
+	Lparen  token.Pos
 	Traits  []Expr
+	Lbrace  token.Pos
 	Members []*Binding
+	Rbrace  token.Pos
 }
 
-func (*TraitExpr) Pos() token.Pos { panic("TODO") }
-func (*TraitExpr) End() token.Pos { panic("TODO") }
+func (expr *TraitExpr) Pos() token.Pos {
+	switch {
+	case expr.Trait != token.NoPos:
+		return expr.Trait
+	case expr.Lparen != token.NoPos:
+		return expr.Lparen
+	default:
+		return expr.Lbrace
+	}
+}
+
+func (expr *TraitExpr) End() token.Pos { return after(expr.Rbrace, 1) }
 
 func (*TraitExpr) astNode() {}
 func (*TraitExpr) astExpr() {}
 
 type ImplDecl struct {
+	Impl        token.Pos
 	Type        Expr
 	Traits      []Expr
 	Definitions []*Binding
+	Rbrace      token.Pos
 }
 
-func (*ImplDecl) Pos() token.Pos { panic("TODO") }
-func (*ImplDecl) End() token.Pos { panic("TODO") }
+func (decl *ImplDecl) Pos() token.Pos { return decl.Impl }
+func (decl *ImplDecl) End() token.Pos { return after(decl.Rbrace, 1) }
 
 func (*ImplDecl) astNode() {}
 func (*ImplDecl) astDecl() {}
 
 type ExistentialExpr struct {
-	Base Expr
+	ForSome token.Pos
+	Base    Expr
 }
 
-func (*ExistentialExpr) Pos() token.Pos { panic("TODO") }
-func (*ExistentialExpr) End() token.Pos { panic("TODO") }
+func (expr *ExistentialExpr) Pos() token.Pos { return expr.ForSome }
+func (expr *ExistentialExpr) End() token.Pos { return end(expr.Base) }
 
 func (*ExistentialExpr) astNode() {}
 func (*ExistentialExpr) astExpr() {}
@@ -295,8 +538,8 @@ type DeclStmt struct {
 	X Decl
 }
 
-func (stmt *DeclStmt) Pos() token.Pos { return stmt.X.Pos() }
-func (stmt *DeclStmt) End() token.Pos { return stmt.X.End() }
+func (stmt *DeclStmt) Pos() token.Pos { return pos(stmt.X) }
+func (stmt *DeclStmt) End() token.Pos { return end(stmt.X) }
 
 func (*DeclStmt) astNode() {}
 func (*DeclStmt) astStmt() {}
@@ -304,10 +547,11 @@ func (*DeclStmt) astStmt() {}
 type IndexExpr struct {
 	Base    Expr
 	Indices []Expr
+	Rbrack  token.Pos
 }
 
-func (expr *IndexExpr) Pos() token.Pos { return expr.Base.Pos() }
-func (*IndexExpr) End() token.Pos      { panic("TODO") }
+func (expr *IndexExpr) Pos() token.Pos { return pos(expr.Base) }
+func (expr *IndexExpr) End() token.Pos { return after(expr.Rbrack, 1) }
 
 func (*IndexExpr) astNode() {}
 func (*IndexExpr) astExpr() {}
@@ -0,0 +1,270 @@
+// Package astjson encodes syntax trees as JSON.
+//
+// Every node is an object with a "kind" member naming its type, "pos" and
+// "end" members holding its range, and one member per field of the node
+// named after the field in lower camel case. Token types are encoded as
+// their spelling, positions as byte offsets plus one, and absent nodes as
+// null. The "pos" and "end" members are informational and are ignored
+// when decoding.
+package astjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+
+	"codeberg.org/rileyq/usagi/internal/compile/ast"
+	"codeberg.org/rileyq/usagi/internal/compile/token"
+)
+
+var kinds = map[string]reflect.Type{}
+
+func init() {
+	for _, n := range ast.NodeTypes() {
+		typ := reflect.TypeOf(n).Elem()
+		kinds[typ.Name()] = typ
+	}
+}
+
+var (
+	nodeType      = reflect.TypeFor[ast.Node]()
+	posType       = reflect.TypeFor[token.Pos]()
+	tokenTypeType = reflect.TypeFor[token.Type]()
+)
+
+// Marshal returns the JSON encoding of node.
+func Marshal(node ast.Node) ([]byte, error) {
+	v, err := encode(reflect.ValueOf(node))
+	if err != nil {
+		return nil, err
+	}
+	return marshal(v)
+}
+
+// Encode writes the indented JSON encoding of node to w.
+func Encode(w io.Writer, node ast.Node) error {
+	v, err := encode(reflect.ValueOf(node))
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// Unmarshal decodes a node encoded by Marshal or Encode.
+func Unmarshal(data []byte) (ast.Node, error) {
+	v, err := decodeNode(nodeType, data)
+	if err != nil {
+		return nil, err
+	}
+	if !v.IsValid() || v.IsNil() {
+		return nil, nil
+	}
+	return v.Interface().(ast.Node), nil
+}
+
+// Decode reads a single node from r.
+func Decode(r io.Reader) (ast.Node, error) {
+	var data json.RawMessage
+	err := json.NewDecoder(r).Decode(&data)
+	if err != nil {
+		return nil, err
+	}
+	return Unmarshal(data)
+}
+
+// object is an encoded node. Its members are kept in field order so that
+// the encoding is stable.
+type object struct {
+	kind     string
+	pos, end token.Pos
+	names    []string
+	values   []any
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `{"kind":%q,"pos":%d,"end":%d`, o.kind, o.pos, o.end)
+	for i, name := range o.names {
+		value, err := marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, ",%q:", name)
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// marshal is json.Marshal without HTML escaping, which would obscure
+// token spellings such as "<".
+func marshal(v any) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+func encode(v reflect.Value) (any, error) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.IsNil() {
+		return nil, nil
+	}
+
+	typ := v.Type().Elem()
+	if kinds[typ.Name()] != typ {
+		return nil, fmt.Errorf("astjson: unknown node type %s", v.Type())
+	}
+
+	node := v.Interface().(ast.Node)
+	o := &object{kind: typ.Name()}
+	o.pos, o.end = node.Pos(), node.End()
+
+	v = v.Elem()
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		value, err := encodeField(v.Field(i))
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", typ.Name(), field.Name, err)
+		}
+		o.names = append(o.names, fieldName(field.Name))
+		o.values = append(o.values, value)
+	}
+	return o, nil
+}
+
+func encodeField(v reflect.Value) (any, error) {
+	switch {
+	case v.Type() == posType:
+		return v.Int(), nil
+	case v.Type() == tokenTypeType:
+		return token.Type(v.Int()).String(), nil
+	case v.Type().Implements(nodeType):
+		return encode(v)
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		list := make([]any, 0, v.Len())
+		for i := range v.Len() {
+			elem, err := encodeField(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, elem)
+		}
+		return list, nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	default:
+		return nil, fmt.Errorf("unsupported field type %s", v.Type())
+	}
+}
+
+func decodeNode(typ reflect.Type, data []byte) (reflect.Value, error) {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return reflect.Zero(typ), nil
+	}
+
+	var members map[string]json.RawMessage
+	err := json.Unmarshal(data, &members)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	var kind string
+	err = json.Unmarshal(members["kind"], &kind)
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("astjson: node kind: %w", err)
+	}
+	structType, found := kinds[kind]
+	if !found {
+		return reflect.Value{}, fmt.Errorf("astjson: unknown node kind %q", kind)
+	}
+	if !reflect.PointerTo(structType).AssignableTo(typ) {
+		return reflect.Value{}, fmt.Errorf("astjson: %s node is not a valid %s", kind, typ)
+	}
+
+	v := reflect.New(structType)
+	for i := range structType.NumField() {
+		field := structType.Field(i)
+		raw, found := members[fieldName(field.Name)]
+		if !found {
+			continue
+		}
+		err = decodeField(v.Elem().Field(i), raw)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%s.%s: %w", kind, field.Name, err)
+		}
+	}
+	return v, nil
+}
+
+func decodeField(v reflect.Value, data []byte) error {
+	switch {
+	case v.Type() == tokenTypeType:
+		var name string
+		err := json.Unmarshal(data, &name)
+		if err != nil {
+			return err
+		}
+		typ, found := token.Lookup(name)
+		if !found {
+			return fmt.Errorf("unknown token %q", name)
+		}
+		v.SetInt(int64(typ))
+		return nil
+	case v.Type().Implements(nodeType):
+		node, err := decodeNode(v.Type(), data)
+		if err != nil {
+			return err
+		}
+		v.Set(node)
+		return nil
+	case v.Kind() == reflect.Slice:
+		var list []json.RawMessage
+		err := json.Unmarshal(data, &list)
+		if err != nil {
+			return err
+		}
+		if list == nil {
+			return nil
+		}
+		s := reflect.MakeSlice(v.Type(), len(list), len(list))
+		for i, elem := range list {
+			err = decodeField(s.Index(i), elem)
+			if err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	default:
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+}
+
+func fieldName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
@@ -0,0 +1,152 @@
+package astjson
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"codeberg.org/rileyq/usagi/internal/compile/ast"
+	"codeberg.org/rileyq/usagi/internal/compile/ast/asttest"
+	"codeberg.org/rileyq/usagi/internal/compile/ast/printer"
+	"codeberg.org/rileyq/usagi/internal/compile/parser"
+)
+
+const src = `
+const std = @import("std");
+
+struct TwoInts (
+	a: i32,
+	b: i32,
+);
+
+trait(closed) Type {}
+
+trait Drop {
+	func drop(self: Self) void;
+}
+
+trait Linear(!Drop) {}
+
+impl TwoInts(Drop) {
+	func drop(self: TwoInts) void {}
+}
+
+func genericAdd(x: forSome Integer, y: @TypeOf(x)) @TypeOf(x) {
+	return x + y;
+}
+
+func ArrayList(T: forSome Type) forSome Type {
+	struct ArrayList(data: []T, size: usize, capacity: usize);
+	impl ArrayList {
+		const empty = ArrayList(data: []T(), size: 0, capacity: 0);
+
+		func append(self: Self, item: T) void {
+			self.data[self.size] = item;
+			self.size = self.size + 1;
+		}
+	}
+	return ArrayList;
+}
+
+const add: func(arg: TwoInts) i32 = func(arg: TwoInts) i32 {
+	return arg.a + arg.b;
+};
+
+func main() void {
+	std.print(add(TwoInts(a: 1, b: 2)));
+}
+`
+
+func TestRoundTrip(t *testing.T) {
+	module, err := parser.ParseBytes("main", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Marshal(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded, ast.Node(module)) {
+		t.Error("decoded module is not equal to the original")
+	}
+
+	var want, got bytes.Buffer
+	err = printer.Fprint(&want, module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = printer.Fprint(&got, decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("decoded module prints differently:\ngot:\n%s\nwant:\n%s", &got, &want)
+	}
+
+	var buf bytes.Buffer
+	err = Encode(&buf, module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err = Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, ast.Node(module)) {
+		t.Error("Decode(Encode(module)) is not equal to the original")
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	data, err := Marshal(&ast.Identifier{NamePos: 3, NameEnd: 6, Name: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"kind":"Identifier","pos":3,"end":6,"namePos":3,"nameEnd":6,"name":"foo"}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+
+	// Incomplete nodes report the part of their range they have.
+	data, err = Marshal(&ast.BinaryExpr{Left: &ast.Identifier{NamePos: 1, NameEnd: 2, Name: "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(`{"kind":"BinaryExpr","pos":1,"end":0,`)) {
+		t.Errorf("got %s, want only the start of the range", data)
+	}
+	for _, n := range ast.NodeTypes() {
+		if _, err := Marshal(reflect.New(reflect.TypeOf(n).Elem()).Interface().(ast.Node)); err != nil {
+			t.Errorf("empty %T: %v", n, err)
+		}
+	}
+
+	for _, bad := range []string{
+		`{"kind":"Nope"}`,
+		`{"kind":"ExprStmt","x":{"kind":"Module"}}`,
+		`{"kind":"BinaryExpr","op":"nope"}`,
+	} {
+		if _, err := Unmarshal([]byte(bad)); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestNodeKinds(t *testing.T) {
+	names, err := asttest.NodeTypes("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if _, found := kinds[name]; !found {
+			t.Errorf("node type %s has no JSON kind", name)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Package asttest provides helpers for tests that must handle every kind
+// of syntax tree node.
+package asttest
+
+import (
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"path/filepath"
+	"strings"
+)
+
+// NodeTypes returns the names of the node types declared in dir, the
+// directory of the ast package, found by their astNode methods. Tests
+// compare them to the node types they know of so that new types are not
+// forgotten.
+func NodeTypes(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := goparser.ParseFile(gotoken.NewFileSet(), path, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range file.Decls {
+			fn, isFunc := decl.(*goast.FuncDecl)
+			if !isFunc || fn.Recv == nil || fn.Name.Name != "astNode" {
+				continue
+			}
+			recv := fn.Recv.List[0].Type.(*goast.StarExpr).X.(*goast.Ident)
+			names = append(names, recv.Name)
+		}
+	}
+	return names, nil
+}
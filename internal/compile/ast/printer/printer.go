@@ -96,12 +96,25 @@ func fprint(w io.Writer, node ast.Node, depth int) error {
 					return err
 				}
 			}
+		case token.Newtype:
+			_, err = io.WriteString(w, " = ")
+			if err != nil {
+				return err
+			}
+			err = fprint(w, node.Value, depth)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, ";")
+			if err != nil {
+				return err
+			}
 		case token.Struct:
 			_, err = io.WriteString(w, " ")
 			if err != nil {
 				return err
 			}
-			err = structMembers(w, node.Value.(*ast.StructExpr), depth)
+			err = structMembers(w, node.Value.(*ast.StructExpr).Members, depth)
 			if err != nil {
 				return err
 			}
@@ -154,7 +167,13 @@ func fprint(w io.Writer, node ast.Node, depth int) error {
 		if err != nil {
 			return err
 		}
-		_, err = io.WriteString(w, ";\n")
+		if !isBlockLike(node.X) {
+			_, err = io.WriteString(w, ";")
+			if err != nil {
+				return err
+			}
+		}
+		_, err = io.WriteString(w, "\n")
 		if err != nil {
 			return err
 		}
@@ -185,6 +204,11 @@ func fprint(w io.Writer, node ast.Node, depth int) error {
 			if err != nil {
 				return err
 			}
+		} else if len(node.Traits) > 0 {
+			_, err = io.WriteString(w, "(open)")
+			if err != nil {
+				return err
+			}
 		}
 		err = traitBody(w, node, depth)
 		if err != nil {
@@ -192,6 +216,9 @@ func fprint(w io.Writer, node ast.Node, depth int) error {
 		}
 		return nil
 	case *ast.Param:
+		if node.Name == nil {
+			return fprint(w, node.Type, depth)
+		}
 		err = fprint(w, node.Name, depth)
 		if err != nil {
 			return err
@@ -204,7 +231,7 @@ func fprint(w io.Writer, node ast.Node, depth int) error {
 		if err != nil {
 			return err
 		}
-		return nil
+		return defaultValue(w, node.Default, depth)
 	case *ast.BlockExpr:
 		_, err = io.WriteString(w, "{\n")
 		if err != nil {
@@ -284,6 +311,10 @@ func fprint(w io.Writer, node ast.Node, depth int) error {
 		}
 		return nil
 	case *ast.ReturnExpr:
+		if node.Value == nil {
+			_, err = io.WriteString(w, "return")
+			return err
+		}
 		_, err = io.WriteString(w, "return ")
 		if err != nil {
 			return err
@@ -303,6 +334,96 @@ func fprint(w io.Writer, node ast.Node, depth int) error {
 			return err
 		}
 		return nil
+	case *ast.IfExpr:
+		_, err = io.WriteString(w, "if ")
+		if err != nil {
+			return err
+		}
+		err = fprint(w, node.Cond, depth)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, " ")
+		if err != nil {
+			return err
+		}
+		err = fprint(w, node.Block, depth)
+		if err != nil {
+			return err
+		}
+		return nil
+	case *ast.WhileExpr:
+		_, err = io.WriteString(w, "while ")
+		if err != nil {
+			return err
+		}
+		err = fprint(w, node.Cond, depth)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, " ")
+		if err != nil {
+			return err
+		}
+		err = fprint(w, node.Block, depth)
+		if err != nil {
+			return err
+		}
+		return nil
+	case *ast.StructExpr:
+		_, err = io.WriteString(w, "struct")
+		if err != nil {
+			return err
+		}
+		err = structMembers(w, node.Members, depth)
+		if err != nil {
+			return err
+		}
+		return nil
+	case *ast.UnionExpr:
+		_, err = io.WriteString(w, "union")
+		if err != nil {
+			return err
+		}
+		err = structMembers(w, node.Members, depth)
+		if err != nil {
+			return err
+		}
+		return nil
+	case *ast.ArrayExpr:
+		_, err = io.WriteString(w, "[")
+		if err != nil {
+			return err
+		}
+		err = fprint(w, node.Len, depth)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, "]")
+		if err != nil {
+			return err
+		}
+		err = fprint(w, node.Base, depth)
+		if err != nil {
+			return err
+		}
+		return nil
+	case *ast.ManyPointerExpr:
+		_, err = io.WriteString(w, "[*]")
+		if err != nil {
+			return err
+		}
+		err = fprint(w, node.Base, depth)
+		if err != nil {
+			return err
+		}
+		return nil
+	case *ast.VarArgExpr:
+		_, err = io.WriteString(w, "...")
+		return err
+	case *ast.BreakExpr:
+		_, err = io.WriteString(w, "break")
+		return err
 	case *ast.SliceExpr:
 		_, err = io.WriteString(w, "[]")
 		if err != nil {
@@ -340,7 +461,7 @@ func fprint(w io.Writer, node ast.Node, depth int) error {
 		if err != nil {
 			return err
 		}
-		return nil
+		return defaultValue(w, node.Default, depth)
 	case *ast.Identifier:
 		_, err = io.WriteString(w, node.Name)
 		return err
@@ -378,14 +499,27 @@ func funcBody(w io.Writer, node *ast.FuncExpr, depth int) error {
 	return nil
 }
 
-func structMembers(w io.Writer, node *ast.StructExpr, depth int) error {
+// defaultValue prints the default value def of a parameter or member, if
+// there is one.
+func defaultValue(w io.Writer, def ast.Expr, depth int) error {
+	if def == nil {
+		return nil
+	}
+	_, err := io.WriteString(w, " = ")
+	if err != nil {
+		return err
+	}
+	return fprint(w, def, depth)
+}
+
+func structMembers(w io.Writer, members []*ast.Field, depth int) error {
 	_, err := io.WriteString(w, "(\n")
 	if err != nil {
 		return err
 	}
 	pad := strings.Repeat("  ", depth)
 	innerPad := strings.Repeat("  ", depth+1)
-	for _, m := range node.Members {
+	for _, m := range members {
 		_, err = io.WriteString(w, innerPad)
 		if err != nil {
 			return err
@@ -454,3 +588,14 @@ func listWithDelim[T ast.Node](w io.Writer, exprs []T, depth int, open, close, s
 	}
 	return nil
 }
+
+// isBlockLike reports whether expr ends with a block and so is not
+// followed by a semicolon when used as a statement.
+func isBlockLike(expr ast.Expr) bool {
+	switch expr.(type) {
+	case *ast.IfExpr, *ast.WhileExpr:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,75 @@
+package printer_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"codeberg.org/rileyq/usagi/internal/compile/ast/printer"
+	"codeberg.org/rileyq/usagi/internal/compile/parser"
+	"codeberg.org/rileyq/usagi/internal/compile/token"
+)
+
+func FuzzFprint(f *testing.F) {
+	f.Add([]byte("func main() void {\n\tif x < 1 {\n\t\treturn;\n\t}\n}\n"))
+	f.Fuzz(func(t *testing.T, src []byte) {
+		module, err := parser.ParseBytes("main", src)
+		if err != nil {
+			return
+		}
+
+		var b strings.Builder
+		err = printer.Fprint(&b, module)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reparsed, err := parser.ParseBytes("main", []byte(b.String()))
+		if err != nil {
+			t.Fatalf("printed module does not parse: %v\n%s", err, b.String())
+		}
+
+		if !equal(reflect.ValueOf(module), reflect.ValueOf(reparsed)) {
+			t.Fatalf("printed module parses differently:\n%s", b.String())
+		}
+	})
+}
+
+var posType = reflect.TypeFor[token.Pos]()
+
+// equal reports whether a and b are structurally equal syntax trees,
+// ignoring positions.
+func equal(a, b reflect.Value) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return equal(a.Elem(), b.Elem())
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := range a.Len() {
+			if !equal(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := range a.NumField() {
+			if !equal(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	default:
+		if a.Type() == posType {
+			return true
+		}
+		return a.Interface() == b.Interface()
+	}
+}
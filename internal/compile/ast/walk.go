@@ -0,0 +1,146 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order, visiting children in
+// source order. Nil children are skipped.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Module:
+		walkList(v, n.Decls)
+	case *Binding:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		if n.Type != nil {
+			Walk(v, n.Type)
+		}
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+	case *Identifier, *Literal, *VarArgExpr, *BreakExpr, *BadExpr:
+		// nothing to do
+	case *CallExpr:
+		Walk(v, n.Base)
+		walkList(v, n.Args)
+	case *FuncExpr:
+		walkList(v, n.Params)
+		if n.ReturnType != nil {
+			Walk(v, n.ReturnType)
+		}
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+	case *Param:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		Walk(v, n.Type)
+		if n.Default != nil {
+			Walk(v, n.Default)
+		}
+	case *BlockExpr:
+		walkList(v, n.List)
+	case *ReturnExpr:
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+	case *BinaryExpr:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *UnaryExpr:
+		Walk(v, n.Base)
+	case *ExprStmt:
+		Walk(v, n.X)
+	case *MemberExpr:
+		Walk(v, n.Base)
+		if n.Member != nil {
+			Walk(v, n.Member)
+		}
+	case *SliceExpr:
+		Walk(v, n.Base)
+	case *ArrayExpr:
+		Walk(v, n.Len)
+		Walk(v, n.Base)
+	case *ManyPointerExpr:
+		Walk(v, n.Base)
+	case *IfExpr:
+		Walk(v, n.Cond)
+		if n.Block != nil {
+			Walk(v, n.Block)
+		}
+	case *WhileExpr:
+		Walk(v, n.Cond)
+		if n.Block != nil {
+			Walk(v, n.Block)
+		}
+	case *StructExpr:
+		walkList(v, n.Members)
+	case *UnionExpr:
+		walkList(v, n.Members)
+	case *Field:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		Walk(v, n.Type)
+		if n.Default != nil {
+			Walk(v, n.Default)
+		}
+	case *NamedArg:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		Walk(v, n.Value)
+	case *TraitExpr:
+		walkList(v, n.Traits)
+		walkList(v, n.Members)
+	case *ImplDecl:
+		Walk(v, n.Type)
+		walkList(v, n.Traits)
+		walkList(v, n.Definitions)
+	case *ExistentialExpr:
+		Walk(v, n.Base)
+	case *DeclStmt:
+		Walk(v, n.X)
+	case *IndexExpr:
+		Walk(v, n.Base)
+		walkList(v, n.Indices)
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkList[N Node](v Visitor, list []N) {
+	for _, node := range list {
+		Walk(v, node)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order, calling f(node) for each
+// node. If f returns true, Inspect invokes f recursively for each of the
+// children of node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
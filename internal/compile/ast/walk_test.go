@@ -0,0 +1,195 @@
+package ast_test
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"codeberg.org/rileyq/usagi/internal/compile/ast"
+	"codeberg.org/rileyq/usagi/internal/compile/ast/asttest"
+	"codeberg.org/rileyq/usagi/internal/compile/parser"
+	"codeberg.org/rileyq/usagi/internal/compile/token"
+)
+
+func TestNodeTypes(t *testing.T) {
+	declared, err := asttest.NodeTypes(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(declared) == 0 {
+		t.Fatal("no node types found")
+	}
+
+	var known []string
+	for _, n := range ast.NodeTypes() {
+		known = append(known, reflect.TypeOf(n).Elem().Name())
+	}
+
+	for _, name := range declared {
+		if !slices.Contains(known, name) {
+			t.Errorf("node type %s is missing from ast.NodeTypes", name)
+		}
+	}
+}
+
+// populate fills every node field of n with a new node and returns the
+// number of children it added.
+func populate(n ast.Node) int {
+	count := 0
+	v := reflect.ValueOf(n).Elem()
+	for i := range v.NumField() {
+		f := v.Field(i)
+		if f.Kind() == reflect.Slice {
+			if child := newNode(f.Type().Elem()); child != nil {
+				f.Set(reflect.Append(f, reflect.ValueOf(child), reflect.ValueOf(newNode(f.Type().Elem()))))
+				count += 2
+			}
+			continue
+		}
+		if child := newNode(f.Type()); child != nil {
+			f.Set(reflect.ValueOf(child))
+			count++
+		}
+	}
+	return count
+}
+
+var nodeType = reflect.TypeFor[ast.Node]()
+
+func newNode(typ reflect.Type) ast.Node {
+	switch typ {
+	case reflect.TypeFor[ast.Expr](), nodeType:
+		return &ast.Identifier{Name: "x"}
+	case reflect.TypeFor[ast.Stmt]():
+		return &ast.ExprStmt{X: &ast.Identifier{Name: "x"}}
+	case reflect.TypeFor[ast.Decl]():
+		return &ast.Binding{Name: &ast.Identifier{Name: "x"}}
+	}
+	if typ.Kind() == reflect.Pointer && typ.Implements(nodeType) {
+		return reflect.New(typ.Elem()).Interface().(ast.Node)
+	}
+	return nil
+}
+
+func TestWalkChildren(t *testing.T) {
+	for _, n := range ast.NodeTypes() {
+		n := reflect.New(reflect.TypeOf(n).Elem()).Interface().(ast.Node)
+		want := populate(n)
+
+		walked := 0
+		ast.Inspect(n, func(c ast.Node) bool {
+			if c == nil {
+				return false
+			}
+			if c != n {
+				walked++
+				return false
+			}
+			return true
+		})
+		if walked != want {
+			t.Errorf("Walk visits %d children of %T, want %d", walked, n, want)
+		}
+
+		applied := 0
+		ast.Apply(n, func(c *ast.Cursor) bool {
+			if c.Node() == nil {
+				return false
+			}
+			if c.Node() != n {
+				applied++
+				return false
+			}
+			return true
+		}, nil)
+		if applied != want {
+			t.Errorf("Apply visits %d children of %T, want %d", applied, n, want)
+		}
+	}
+}
+
+const src = `
+const std = @import("std");
+
+func add(x: i32, y: i32) i32 {
+	return x + y;
+}
+
+func main() void {
+	std.print(add(1, 2));
+}
+`
+
+func TestInspectOrder(t *testing.T) {
+	module, err := parser.ParseBytes("main", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var last token.Pos
+	ast.Inspect(module, func(n ast.Node) bool {
+		if _, isModule := n.(*ast.Module); n == nil || isModule {
+			return true
+		}
+		if n.Pos() < last {
+			t.Errorf("%T at %d visited after %d", n, n.Pos(), last)
+		}
+		last = n.Pos()
+		return true
+	})
+}
+
+func TestApply(t *testing.T) {
+	module, err := parser.ParseBytes("main", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extra := &ast.Binding{Token: token.Const, Mode: ast.ModeConst, Name: &ast.Identifier{Name: "extra"}}
+	ast.Apply(module, func(c *ast.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.Binding:
+			switch n.Name.Name {
+			case "std":
+				c.Delete()
+				return false
+			case "main":
+				c.InsertBefore(extra)
+			}
+		case *ast.Identifier:
+			if n.Name == "y" {
+				c.Replace(&ast.Identifier{Name: "z"})
+			}
+		}
+		return true
+	}, nil)
+
+	var names []string
+	for _, decl := range module.Decls {
+		names = append(names, decl.(*ast.Binding).Name.Name)
+	}
+	if !slices.Equal(names, []string{"add", "extra", "main"}) {
+		t.Errorf("got declarations %v", names)
+	}
+
+	var idents []string
+	ast.Inspect(module.Decls[0], func(n ast.Node) bool {
+		if id, isIdent := n.(*ast.Identifier); isIdent {
+			idents = append(idents, id.Name)
+		}
+		return true
+	})
+	if !slices.Contains(idents, "z") || slices.Contains(idents, "y") {
+		t.Errorf("identifiers not replaced: %v", idents)
+	}
+
+	result := ast.Apply(module, nil, func(c *ast.Cursor) bool {
+		if _, isModule := c.Node().(*ast.Module); isModule {
+			c.Replace(&ast.Module{Name: "replaced"})
+		}
+		return true
+	})
+	if result.(*ast.Module).Name != "replaced" {
+		t.Errorf("root not replaced")
+	}
+}
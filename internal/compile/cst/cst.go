@@ -0,0 +1,263 @@
+// Package cst builds lossless concrete syntax trees.
+//
+// A Tree holds every token of a source file, including white space and
+// comments, arranged under the ast nodes that contain them. Writing a
+// Tree reproduces its source byte-for-byte.
+package cst
+
+import (
+	"bytes"
+	"io"
+	"iter"
+	"strings"
+
+	"codeberg.org/rileyq/usagi/internal/compile/ast"
+	"codeberg.org/rileyq/usagi/internal/compile/parser"
+	"codeberg.org/rileyq/usagi/internal/compile/token"
+)
+
+type Tree struct {
+	Root *Node
+	// Trailing holds the trivia after the last token of the file.
+	Trailing []*token.Token
+
+	nodes map[ast.Node]*Node
+}
+
+// Element is a *Node or a *Token.
+type Element interface {
+	Pos() token.Pos
+	End() token.Pos
+
+	cstElement()
+}
+
+type Node struct {
+	AST      ast.Node
+	Parent   *Node
+	Children []Element
+}
+
+func (n *Node) Pos() token.Pos {
+	for tok := range n.Tokens() {
+		return tok.Pos()
+	}
+	return token.NoPos
+}
+
+func (n *Node) End() token.Pos {
+	end := token.NoPos
+	for tok := range n.Tokens() {
+		end = tok.End()
+	}
+	return end
+}
+
+// Tokens yields every token under n in source order.
+func (n *Node) Tokens() iter.Seq[*Token] {
+	return func(yield func(*Token) bool) {
+		n.tokens(yield)
+	}
+}
+
+func (n *Node) tokens(yield func(*Token) bool) bool {
+	for _, child := range n.Children {
+		switch child := child.(type) {
+		case *Token:
+			if !yield(child) {
+				return false
+			}
+		case *Node:
+			if !child.tokens(yield) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (*Node) cstElement() {}
+
+// Token is a significant token with the trivia attached to it. Trailing
+// trivia runs up to and including the end of the token's line; all other
+// trivia leads the next token.
+type Token struct {
+	Token    *token.Token
+	Leading  []*token.Token
+	Trailing []*token.Token
+	Parent   *Node
+}
+
+func (t *Token) Pos() token.Pos { return t.Token.Pos }
+func (t *Token) End() token.Pos { return t.Token.End }
+
+func (*Token) cstElement() {}
+
+// Parse parses src in trivia mode and builds its syntax tree. The tree
+// is returned even when src has syntax errors.
+func Parse(name string, src []byte) (*Tree, error) {
+	p := parser.NewFromReaderWithMode(bytes.NewReader(src), parser.Trivia)
+	module, err := p.Parse(name)
+	return Build(module, p.Tokens()), err
+}
+
+// Build arranges tokens, which must be every token read while parsing
+// module in source order, into a syntax tree.
+func Build(module *ast.Module, tokens []*token.Token) *Tree {
+	b := &builder{nodes: map[ast.Node]*Node{}}
+	b.attachTrivia(tokens)
+	root := &Node{AST: module}
+	b.nodes[module] = root
+	for _, child := range children(module) {
+		b.child(root, child)
+	}
+	for b.i < len(b.toks) {
+		b.take(root)
+	}
+	return &Tree{Root: root, Trailing: b.trailing, nodes: b.nodes}
+}
+
+// Module returns the ast view of the tree.
+func (t *Tree) Module() *ast.Module {
+	return t.Root.AST.(*ast.Module)
+}
+
+// Node returns the syntax node for n, or nil if n is not part of the
+// tree.
+func (t *Tree) Node(n ast.Node) *Node {
+	return t.nodes[n]
+}
+
+func (t *Tree) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	write := func(toks []*token.Token) error {
+		for _, tok := range toks {
+			n, err := io.WriteString(w, tok.Text)
+			total += int64(n)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for tok := range t.Root.Tokens() {
+		if err := write(tok.Leading); err != nil {
+			return total, err
+		}
+		if err := write([]*token.Token{tok.Token}); err != nil {
+			return total, err
+		}
+		if err := write(tok.Trailing); err != nil {
+			return total, err
+		}
+	}
+	if err := write(t.Trailing); err != nil {
+		return total, err
+	}
+	return total, nil
+}
+
+func (t *Tree) String() string {
+	var b strings.Builder
+	t.WriteTo(&b)
+	return b.String()
+}
+
+type builder struct {
+	toks     []*Token
+	trailing []*token.Token
+	i        int
+	nodes    map[ast.Node]*Node
+}
+
+func (b *builder) attachTrivia(tokens []*token.Token) {
+	var leading []*token.Token
+	var last *Token
+	// onLine reports whether trivia still belongs to the line of last.
+	onLine := false
+
+	for _, tok := range tokens {
+		if tok.Type != token.Whitespace && tok.Type != token.Comment {
+			last = &Token{Token: tok, Leading: leading}
+			leading = nil
+			b.toks = append(b.toks, last)
+			onLine = true
+			continue
+		}
+		if !onLine {
+			leading = append(leading, tok)
+			continue
+		}
+		before, after, found := splitLine(tok)
+		last.Trailing = append(last.Trailing, before)
+		if found {
+			onLine = false
+			if after != nil {
+				leading = append(leading, after)
+			}
+		}
+	}
+
+	b.trailing = leading
+}
+
+// splitLine splits a trivia token after its first newline.
+func splitLine(tok *token.Token) (*token.Token, *token.Token, bool) {
+	i := strings.IndexByte(tok.Text, '\n')
+	if i < 0 {
+		return tok, nil, false
+	}
+	if i == len(tok.Text)-1 {
+		return tok, nil, true
+	}
+	mid := tok.Pos + token.Pos(i+1)
+	before := &token.Token{Type: tok.Type, Pos: tok.Pos, End: mid, Text: tok.Text[:i+1]}
+	after := &token.Token{Type: tok.Type, Pos: mid, End: tok.End, Text: tok.Text[i+1:]}
+	return before, after, true
+}
+
+func (b *builder) child(parent *Node, n ast.Node) {
+	pos, end := n.Pos(), n.End()
+	// Nodes without a usable range leave their tokens to the parent.
+	if pos == token.NoPos || end <= pos {
+		return
+	}
+	for b.i < len(b.toks) && b.toks[b.i].Pos() < pos {
+		b.take(parent)
+	}
+	if b.i == len(b.toks) || b.toks[b.i].Pos() >= end {
+		return
+	}
+
+	node := &Node{AST: n, Parent: parent}
+	b.nodes[n] = node
+	parent.Children = append(parent.Children, node)
+	for _, child := range children(n) {
+		b.child(node, child)
+	}
+	for b.i < len(b.toks) && b.toks[b.i].Pos() < end {
+		b.take(node)
+	}
+}
+
+func (b *builder) take(parent *Node) {
+	tok := b.toks[b.i]
+	tok.Parent = parent
+	parent.Children = append(parent.Children, tok)
+	b.i++
+}
+
+// children returns the direct children of n in source order.
+func children(n ast.Node) []ast.Node {
+	var list []ast.Node
+	ast.Inspect(n, func(c ast.Node) bool {
+		if c == n {
+			return true
+		}
+		if c != nil {
+			list = append(list, c)
+		}
+		return false
+	})
+	return list
+}
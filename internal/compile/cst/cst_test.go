@@ -0,0 +1,93 @@
+package cst
+
+import (
+	"testing"
+
+	"codeberg.org/rileyq/usagi/internal/compile/ast"
+	"codeberg.org/rileyq/usagi/internal/compile/token"
+)
+
+const src = `// Package comment
+
+const std = @import("std"); // trailing comment
+
+struct TwoInts (
+	a: i32,  // first
+	b: i32,
+);
+
+trait Drop {
+	func drop(self: Self) void;
+}
+
+impl TwoInts(Drop) {
+	func drop(self: TwoInts) void {}
+}
+
+func add(arg: TwoInts) i32 {
+	let x: i32 = arg.a;
+	return x + arg.b;
+}
+
+func main() void {
+	if 1 < 2 {
+		std.print(add(TwoInts(a: 1, b: 2)));
+	}
+}
+
+// trailing comment without newline`
+
+func TestRoundTrip(t *testing.T) {
+	for _, src := range []string{src, "", "\n\n", "// only a comment\n", "const x = ;\n", "func f( {"} {
+		tree, _ := Parse("main", []byte(src))
+		if got := tree.String(); got != src {
+			t.Errorf("round trip mismatch:\ngot:\n%s\nwant:\n%s", got, src)
+		}
+	}
+}
+
+func TestNodes(t *testing.T) {
+	tree, err := Parse("main", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var check func(n *Node)
+	check = func(n *Node) {
+		if tree.Node(n.AST) != n {
+			t.Errorf("Node(%T) does not map back to its syntax node", n.AST)
+		}
+		if _, isModule := n.AST.(*ast.Module); !isModule {
+			if n.Pos() != n.AST.Pos() || n.End() != n.AST.End() {
+				t.Errorf("%T: syntax range [%d, %d) != ast range [%d, %d)", n.AST, n.Pos(), n.End(), n.AST.Pos(), n.AST.End())
+			}
+		}
+		for _, child := range n.Children {
+			switch child := child.(type) {
+			case *Node:
+				if child.Parent != n {
+					t.Errorf("%T has wrong parent", child.AST)
+				}
+				check(child)
+			case *Token:
+				if child.Parent != n {
+					t.Errorf("token %q has wrong parent", child.Token.Text)
+				}
+			}
+		}
+	}
+	check(tree.Root)
+
+	main := tree.Module().Decls[len(tree.Module().Decls)-1].(*ast.Binding)
+	node := tree.Node(main)
+	if node == nil {
+		t.Fatal("no syntax node for main")
+	}
+	first := node.Children[0].(*Token)
+	if first.Token.Type != token.Func {
+		t.Errorf("main starts with %s, want func", first.Token.Type)
+	}
+	if len(tree.Trailing) == 0 || tree.Trailing[len(tree.Trailing)-1].Type != token.Comment {
+		t.Errorf("trailing comment not attached to the tree")
+	}
+}
@@ -0,0 +1,255 @@
+package format
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// A doc describes layout independently of line width, in the style of
+// Wadler's "prettier printer". Groups are printed on one line when they
+// fit and broken at their lines otherwise.
+type doc interface{}
+
+type (
+	text   string
+	concat []doc
+	indent struct{ doc doc }
+	group  struct {
+		doc doc
+		// hard is set for groups that contain a hard line and can
+		// therefore never be printed flat.
+		hard bool
+	}
+	// line is a space in a flat group and a newline in a broken one.
+	// Soft lines print nothing in flat groups.
+	line struct{ soft bool }
+	// hardLine is always a newline.
+	hardLine struct{}
+	// freshLine is a newline unless the output is already at the start
+	// of a line.
+	freshLine struct{}
+	// blankLine is an empty line, printed at most once in a row.
+	blankLine struct{}
+	// ifBreak prints broken or flat depending on the enclosing group.
+	ifBreak struct{ broken, flat doc }
+	// lineSuffix is deferred until just before the next newline, which
+	// keeps trailing comments at the end of their line.
+	lineSuffix string
+)
+
+var (
+	space    = text(" ")
+	softLine = line{soft: true}
+)
+
+func join(docs []doc, sep doc) doc {
+	out := make(concat, 0, 2*len(docs))
+	for i, d := range docs {
+		if i > 0 {
+			out = append(out, sep)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// propagate marks every group containing a hard line as hard and
+// reports whether d contains one.
+func propagate(d doc) bool {
+	switch d := d.(type) {
+	case concat:
+		hard := false
+		for _, c := range d {
+			if propagate(c) {
+				hard = true
+			}
+		}
+		return hard
+	case indent:
+		return propagate(d.doc)
+	case *group:
+		d.hard = propagate(d.doc)
+		return d.hard
+	case ifBreak:
+		broken := propagate(d.broken)
+		flat := propagate(d.flat)
+		return broken || flat
+	case hardLine, freshLine, blankLine, lineSuffix:
+		return true
+	default:
+		return false
+	}
+}
+
+const tabWidth = 4
+
+type mode int
+
+const (
+	modeBreak mode = iota
+	modeFlat
+)
+
+type command struct {
+	indent int
+	mode   mode
+	doc    doc
+}
+
+type renderer struct {
+	width int
+	b     strings.Builder
+	col   int
+	// lineStart is set at the start of a line, before its indentation
+	// has been written.
+	lineStart bool
+	// blank is set when the previous line was empty.
+	blank    bool
+	indent   int
+	suffixes []string
+}
+
+func render(d doc, width int) string {
+	propagate(d)
+	r := &renderer{width: width, lineStart: true, blank: true}
+	stack := []command{{0, modeBreak, d}}
+	for len(stack) > 0 {
+		cmd := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch d := cmd.doc.(type) {
+		case nil:
+		case text:
+			r.text(cmd.indent, string(d))
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, command{cmd.indent, cmd.mode, d[i]})
+			}
+		case indent:
+			stack = append(stack, command{cmd.indent + 1, cmd.mode, d.doc})
+		case *group:
+			m := modeBreak
+			if cmd.mode == modeFlat || !d.hard && r.fits(command{cmd.indent, modeFlat, d.doc}, stack) {
+				m = modeFlat
+			}
+			stack = append(stack, command{cmd.indent, m, d.doc})
+		case line:
+			if cmd.mode == modeFlat {
+				if !d.soft {
+					r.text(cmd.indent, " ")
+				}
+				break
+			}
+			r.newline()
+		case hardLine:
+			r.newline()
+		case freshLine:
+			if !r.lineStart {
+				r.newline()
+			}
+		case blankLine:
+			if !r.lineStart {
+				r.newline()
+			}
+			if !r.blank {
+				r.newline()
+			}
+		case ifBreak:
+			if cmd.mode == modeFlat {
+				stack = append(stack, command{cmd.indent, cmd.mode, d.flat})
+			} else {
+				stack = append(stack, command{cmd.indent, cmd.mode, d.broken})
+			}
+		case lineSuffix:
+			r.suffixes = append(r.suffixes, string(d))
+		default:
+			panic("format: unexpected doc")
+		}
+	}
+	r.flushSuffixes()
+	return r.b.String()
+}
+
+func (r *renderer) text(indent int, s string) {
+	if s == "" {
+		return
+	}
+	if r.lineStart {
+		r.b.WriteString(strings.Repeat("\t", indent))
+		r.col = indent * tabWidth
+		r.lineStart = false
+		r.blank = false
+	}
+	r.b.WriteString(s)
+	r.col += utf8.RuneCountInString(s)
+}
+
+func (r *renderer) flushSuffixes() {
+	for _, s := range r.suffixes {
+		r.b.WriteString(s)
+	}
+	r.suffixes = r.suffixes[:0]
+}
+
+func (r *renderer) newline() {
+	r.flushSuffixes()
+	r.blank = r.lineStart
+	r.b.WriteByte('\n')
+	r.col = 0
+	r.lineStart = true
+}
+
+// fits reports whether next, followed by the rest of the stack up to the
+// next line break, fits in the remaining width.
+func (r *renderer) fits(next command, rest []command) bool {
+	remaining := r.width - r.col
+	if r.lineStart {
+		remaining -= next.indent * tabWidth
+	}
+	stack := []command{next}
+	restIdx := len(rest)
+	for remaining >= 0 {
+		if len(stack) == 0 {
+			if restIdx == 0 {
+				return true
+			}
+			restIdx--
+			stack = append(stack, rest[restIdx])
+		}
+		cmd := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch d := cmd.doc.(type) {
+		case text:
+			remaining -= utf8.RuneCountInString(string(d))
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, command{cmd.indent, cmd.mode, d[i]})
+			}
+		case indent:
+			stack = append(stack, command{cmd.indent + 1, cmd.mode, d.doc})
+		case *group:
+			m := cmd.mode
+			if d.hard {
+				m = modeBreak
+			}
+			stack = append(stack, command{cmd.indent, m, d.doc})
+		case line:
+			if cmd.mode == modeBreak {
+				return true
+			}
+			if !d.soft {
+				remaining--
+			}
+		case hardLine, freshLine, blankLine:
+			return true
+		case ifBreak:
+			if cmd.mode == modeFlat {
+				stack = append(stack, command{cmd.indent, cmd.mode, d.flat})
+			} else {
+				stack = append(stack, command{cmd.indent, cmd.mode, d.broken})
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,418 @@
+// Package format implements canonical formatting of Usagi source code.
+//
+// Formatting is idempotent: formatting already formatted source returns
+// it unchanged. Comments and single blank lines between declarations and
+// statements are preserved; all other layout is derived from the syntax
+// tree and the line width.
+package format
+
+import (
+	"strings"
+
+	"codeberg.org/rileyq/usagi/internal/compile/ast"
+	"codeberg.org/rileyq/usagi/internal/compile/cst"
+	"codeberg.org/rileyq/usagi/internal/compile/token"
+)
+
+// Width is the line width that lists are wrapped to fit in. Tabs count
+// as four columns.
+const Width = 100
+
+// Source formats src. Source containing syntax errors is not formatted.
+func Source(src []byte) ([]byte, error) {
+	tree, err := cst.Parse("", src)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(Tree(tree)), nil
+}
+
+// Tree formats a syntax tree, taking comments and blank lines from its
+// trivia.
+func Tree(tree *cst.Tree) string {
+	p := newPrinter(tree)
+	d := concat{p.module(tree.Module()), p.flush(token.Pos(1 << 62))}
+	out := render(d, Width)
+	out = strings.TrimLeft(out, "\n")
+	if out == "" {
+		return ""
+	}
+	return strings.TrimRight(out, "\n") + "\n"
+}
+
+type comment struct {
+	tok *token.Token
+	// trailing comments follow code on the same line.
+	trailing bool
+	// blank is set when an empty line precedes the comment.
+	blank bool
+}
+
+type printer struct {
+	comments []*comment
+	next     int
+	// blank records the significant tokens preceded by an empty line.
+	blank map[token.Pos]bool
+	// start is set at the start of a module or body, where empty lines
+	// are dropped.
+	start bool
+}
+
+func newPrinter(tree *cst.Tree) *printer {
+	p := &printer{blank: map[token.Pos]bool{}, start: true}
+
+	// Leading trivia always starts at the beginning of a line, so a
+	// single newline before anything else in it ends an empty line.
+	leading := func(trivia []*token.Token, first bool) bool {
+		newlines := 0
+		if !first {
+			newlines = 1
+		}
+		for _, tok := range trivia {
+			switch tok.Type {
+			case token.Whitespace:
+				newlines += strings.Count(tok.Text, "\n")
+			case token.Comment:
+				p.comments = append(p.comments, &comment{tok: tok, blank: newlines >= 2})
+				newlines = 0
+			}
+		}
+		return newlines >= 2
+	}
+
+	first := true
+	for tok := range tree.Root.Tokens() {
+		p.blank[tok.Pos()] = leading(tok.Leading, first)
+		first = false
+		for _, trivia := range tok.Trailing {
+			if trivia.Type == token.Comment {
+				p.comments = append(p.comments, &comment{tok: trivia, trailing: true})
+			}
+		}
+	}
+	leading(tree.Trailing, first)
+	return p
+}
+
+// flush prints the comments before pos.
+func (p *printer) flush(pos token.Pos) doc {
+	var out concat
+	for p.next < len(p.comments) && p.comments[p.next].tok.Pos < pos {
+		c := p.comments[p.next]
+		p.next++
+		s := strings.TrimRightFunc(c.tok.Text, isSpace)
+		if c.trailing {
+			out = append(out, lineSuffix(" "+s))
+			continue
+		}
+		if c.blank && !p.start {
+			out = append(out, blankLine{})
+		}
+		out = append(out, freshLine{}, text(s), hardLine{})
+		p.start = false
+	}
+	return out
+}
+
+func isSpace(r rune) bool { return r == ' ' || r == '\t' || r == '\r' }
+
+// tok prints text for the token at pos after any comments before it.
+func (p *printer) tok(pos token.Pos, s string) doc {
+	if pos == token.NoPos {
+		return text(s)
+	}
+	return concat{p.flush(pos), text(s)}
+}
+
+// item prints a declaration or statement on its own line, preserving
+// the comments and an empty line before it.
+func (p *printer) item(n ast.Node, print func(ast.Node) doc) doc {
+	out := concat{p.flush(n.Pos())}
+	if p.blank[n.Pos()] && !p.start {
+		out = append(out, blankLine{})
+	}
+	p.start = false
+	return append(out, freshLine{}, print(n))
+}
+
+func (p *printer) module(m *ast.Module) doc {
+	var out concat
+	for _, decl := range m.Decls {
+		out = append(out, p.item(decl, func(n ast.Node) doc { return p.decl(n.(ast.Decl)) }))
+	}
+	return out
+}
+
+// body prints a braced list of items.
+func (p *printer) body(lbrace token.Pos, items []ast.Node, print func(ast.Node) doc, rbrace token.Pos) doc {
+	open := p.tok(lbrace, "{")
+	if len(items) == 0 && !p.hasComments(rbrace) {
+		return concat{open, p.tok(rbrace, "}")}
+	}
+	p.start = true
+	var inner concat
+	for _, item := range items {
+		inner = append(inner, p.item(item, print))
+	}
+	inner = append(inner, p.flush(rbrace))
+	p.start = false
+	return concat{open, indent{inner}, freshLine{}, p.tok(rbrace, "}")}
+}
+
+func (p *printer) hasComments(pos token.Pos) bool {
+	return p.next < len(p.comments) && p.comments[p.next].tok.Pos < pos
+}
+
+// list prints a parenthesized, comma separated list that is wrapped one
+// element per line with a trailing comma when it does not fit.
+func (p *printer) list(open string, lpos token.Pos, items []ast.Node, print func(ast.Node) doc, close string, rpos token.Pos) doc {
+	if len(items) == 0 {
+		return concat{p.tok(lpos, open), p.tok(rpos, close)}
+	}
+	inner := concat{p.tok(lpos, open)}
+	var elems concat
+	for i, item := range items {
+		elems = append(elems, print(item))
+		if i < len(items)-1 {
+			// Comments trailing the comma stay on its line.
+			elems = append(elems, text(","), p.trailing(items[i+1].Pos()), line{})
+		}
+	}
+	return &group{doc: append(inner,
+		indent{concat{softLine, elems, ifBreak{broken: text(",")}, p.trailing(rpos)}},
+		softLine,
+		p.tok(rpos, close),
+	)}
+}
+
+// trailing prints the comments before pos that trail code on their line.
+func (p *printer) trailing(pos token.Pos) doc {
+	var out concat
+	for p.next < len(p.comments) && p.comments[p.next].trailing && p.comments[p.next].tok.Pos < pos {
+		out = append(out, p.flush(p.comments[p.next].tok.End))
+	}
+	return out
+}
+
+func (p *printer) exprList(open string, lpos token.Pos, exprs []ast.Expr, close string, rpos token.Pos) doc {
+	items := make([]ast.Node, 0, len(exprs))
+	for _, expr := range exprs {
+		items = append(items, expr)
+	}
+	return p.list(open, lpos, items, func(n ast.Node) doc { return p.expr(n.(ast.Expr)) }, close, rpos)
+}
+
+func (p *printer) decl(decl ast.Decl) doc {
+	switch decl := decl.(type) {
+	case *ast.Binding:
+		return p.binding(decl)
+	case *ast.ImplDecl:
+		return p.impl(decl)
+	default:
+		panic("format: unexpected declaration")
+	}
+}
+
+func (p *printer) binding(b *ast.Binding) doc {
+	out := concat{p.flush(b.Pos())}
+	var words []string
+	if b.Mode.Export() {
+		words = append(words, "export")
+	}
+	if b.Mode.Const() {
+		words = append(words, "const")
+	}
+	switch b.Token {
+	case token.Const:
+	case token.Trait:
+		if b.Value.(*ast.TraitExpr).Closed {
+			words = append(words, "trait(closed)")
+		} else {
+			words = append(words, "trait")
+		}
+	default:
+		words = append(words, b.Token.String())
+	}
+	out = append(out, text(strings.Join(words, " ")), space, p.expr(b.Name))
+
+	switch b.Token {
+	case token.Const, token.Let:
+		if b.Type != nil {
+			out = append(out, text(": "), p.expr(b.Type))
+		}
+		if b.Value != nil {
+			out = append(out, text(" = "), p.expr(b.Value))
+		}
+		out = append(out, p.tok(b.Semicolon, ";"))
+	case token.Func:
+		fn := b.Value.(*ast.FuncExpr)
+		out = append(out, p.signature(fn))
+		if fn.Body != nil {
+			out = append(out, space, p.block(fn.Body))
+		} else {
+			out = append(out, p.tok(b.Semicolon, ";"))
+		}
+	case token.Newtype:
+		out = append(out, text(" = "), p.expr(b.Value), p.tok(b.Semicolon, ";"))
+	case token.Struct:
+		s := b.Value.(*ast.StructExpr)
+		out = append(out, p.fields(s.Lparen, s.Members, s.Rparen), p.tok(b.Semicolon, ";"))
+	case token.Trait:
+		out = append(out, p.traitBody(b.Value.(*ast.TraitExpr)))
+	}
+	return out
+}
+
+func (p *printer) impl(decl *ast.ImplDecl) doc {
+	out := concat{p.tok(decl.Impl, "impl "), p.expr(decl.Type)}
+	if len(decl.Traits) > 0 {
+		out = append(out, p.exprList("(", token.NoPos, decl.Traits, ")", token.NoPos))
+	}
+	defs := make([]ast.Node, 0, len(decl.Definitions))
+	for _, def := range decl.Definitions {
+		defs = append(defs, def)
+	}
+	body := p.body(token.NoPos, defs, func(n ast.Node) doc { return p.binding(n.(*ast.Binding)) }, decl.Rbrace)
+	return append(out, space, body)
+}
+
+func (p *printer) signature(fn *ast.FuncExpr) doc {
+	params := make([]ast.Node, 0, len(fn.Params))
+	for _, param := range fn.Params {
+		params = append(params, param)
+	}
+	out := concat{p.list("(", fn.Lparen, params, func(n ast.Node) doc { return p.param(n.(*ast.Param)) }, ")", fn.Rparen)}
+	if fn.ReturnType != nil {
+		out = append(out, space, p.expr(fn.ReturnType))
+	}
+	return out
+}
+
+func (p *printer) param(param *ast.Param) doc {
+	if param.Name == nil {
+		return p.expr(param.Type)
+	}
+	return concat{p.expr(param.Name), text(": "), p.expr(param.Type), p.defaultValue(param.Default)}
+}
+
+func (p *printer) defaultValue(def ast.Expr) doc {
+	if def == nil {
+		return concat{}
+	}
+	return concat{text(" = "), p.expr(def)}
+}
+
+func (p *printer) fields(lparen token.Pos, members []*ast.Field, rparen token.Pos) doc {
+	fields := make([]ast.Node, 0, len(members))
+	for _, f := range members {
+		fields = append(fields, f)
+	}
+	return p.list("(", lparen, fields, func(n ast.Node) doc {
+		f := n.(*ast.Field)
+		return concat{p.expr(f.Name), text(": "), p.expr(f.Type), p.defaultValue(f.Default)}
+	}, ")", rparen)
+}
+
+func (p *printer) traitBody(t *ast.TraitExpr) doc {
+	var out concat
+	if len(t.Traits) > 0 {
+		out = append(out, p.exprList("(", t.Lparen, t.Traits, ")", token.NoPos))
+	}
+	members := make([]ast.Node, 0, len(t.Members))
+	for _, m := range t.Members {
+		members = append(members, m)
+	}
+	body := p.body(t.Lbrace, members, func(n ast.Node) doc { return p.binding(n.(*ast.Binding)) }, t.Rbrace)
+	return append(out, space, body)
+}
+
+func (p *printer) block(b *ast.BlockExpr) doc {
+	stmts := make([]ast.Node, 0, len(b.List))
+	for _, stmt := range b.List {
+		stmts = append(stmts, stmt)
+	}
+	return p.body(b.Lbrace, stmts, func(n ast.Node) doc { return p.stmt(n.(ast.Stmt)) }, b.Rbrace)
+}
+
+func (p *printer) stmt(stmt ast.Stmt) doc {
+	switch stmt := stmt.(type) {
+	case *ast.ExprStmt:
+		switch stmt.X.(type) {
+		case *ast.IfExpr, *ast.WhileExpr:
+			return p.expr(stmt.X)
+		}
+		return concat{p.expr(stmt.X), p.tok(stmt.Semicolon, ";")}
+	case *ast.DeclStmt:
+		return p.decl(stmt.X)
+	default:
+		panic("format: unexpected statement")
+	}
+}
+
+func (p *printer) expr(expr ast.Expr) doc {
+	switch expr := expr.(type) {
+	case nil:
+		return nil
+	case *ast.Identifier:
+		return p.tok(expr.NamePos, expr.Name)
+	case *ast.Literal:
+		return p.tok(expr.ValuePos, expr.Value)
+	case *ast.CallExpr:
+		return concat{p.expr(expr.Base), p.exprList("(", token.NoPos, expr.Args, ")", expr.Rparen)}
+	case *ast.IndexExpr:
+		return concat{p.expr(expr.Base), p.exprList("[", token.NoPos, expr.Indices, "]", expr.Rbrack)}
+	case *ast.NamedArg:
+		return concat{p.expr(expr.Name), text(": "), p.expr(expr.Value)}
+	case *ast.MemberExpr:
+		return concat{p.expr(expr.Base), text("."), p.expr(expr.Member)}
+	case *ast.BinaryExpr:
+		return concat{p.expr(expr.Left), text(" " + expr.Op.String() + " "), p.expr(expr.Right)}
+	case *ast.UnaryExpr:
+		return concat{p.tok(expr.OpPos, expr.Op.String()), p.expr(expr.Base)}
+	case *ast.ReturnExpr:
+		if expr.Value == nil {
+			return p.tok(expr.Return, "return")
+		}
+		return concat{p.tok(expr.Return, "return "), p.expr(expr.Value)}
+	case *ast.BreakExpr:
+		return p.tok(expr.Break, "break")
+	case *ast.FuncExpr:
+		out := concat{p.tok(expr.Func, "func"), p.signature(expr)}
+		if expr.Body != nil {
+			out = append(out, space, p.block(expr.Body))
+		}
+		return out
+	case *ast.BlockExpr:
+		return p.block(expr)
+	case *ast.IfExpr:
+		return concat{p.tok(expr.If, "if "), p.expr(expr.Cond), space, p.block(expr.Block)}
+	case *ast.WhileExpr:
+		return concat{p.tok(expr.While, "while "), p.expr(expr.Cond), space, p.block(expr.Block)}
+	case *ast.SliceExpr:
+		return concat{p.tok(expr.Lbrack, "[]"), p.expr(expr.Base)}
+	case *ast.ArrayExpr:
+		return concat{p.tok(expr.Lbrack, "["), p.expr(expr.Len), text("]"), p.expr(expr.Base)}
+	case *ast.ManyPointerExpr:
+		return concat{p.tok(expr.Lbrack, "[*]"), p.expr(expr.Base)}
+	case *ast.VarArgExpr:
+		return p.tok(expr.Ellipses, "...")
+	case *ast.ExistentialExpr:
+		return concat{p.tok(expr.ForSome, "forSome "), p.expr(expr.Base)}
+	case *ast.StructExpr:
+		return concat{p.tok(expr.Struct, "struct"), p.fields(expr.Lparen, expr.Members, expr.Rparen)}
+	case *ast.UnionExpr:
+		return concat{p.tok(expr.Union, "union"), p.fields(expr.Lparen, expr.Members, expr.Rparen)}
+	case *ast.TraitExpr:
+		out := concat{p.tok(expr.Trait, "trait")}
+		switch {
+		case expr.Closed:
+			out = append(out, text("(closed)"))
+		case len(expr.Traits) > 0:
+			// Without a state the trait list would be read as one.
+			out = append(out, text("(open)"))
+		}
+		return append(out, p.traitBody(expr))
+	default:
+		panic("format: unexpected expression")
+	}
+}
@@ -0,0 +1,167 @@
+package format
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"codeberg.org/rileyq/usagi/internal/compile/parser"
+	"codeberg.org/rileyq/usagi/internal/compile/token"
+)
+
+const src = `// Package comment
+
+const std = @import("std"); // trailing comment
+struct TwoInts (
+	a: i32,
+	b: i32,
+);
+newtype   Meters=u32 ;
+struct Options(width: u32=80,verbose: bool = false);
+const Word = union ( bytes: [ 4 ]u8 , value: u32 );
+
+trait(closed) Type {}
+trait Drop {
+	// drop it
+	func drop(self: Self) void;
+}
+impl TwoInts(Drop) {
+	func drop(self: TwoInts) void {}
+}
+
+func genericAdd(x: forSome Integer, y: @TypeOf(x)) @TypeOf(x) {
+
+	return x+y;
+}
+
+func longFunctionName(firstParameter: i32, secondParameter: i32, thirdParameter: i32, fourth: i32) i32 {
+	let x: i32 = firstParameter;
+	if x < 2 {
+		std.printf("a very long string that goes on and on", firstParameter, secondParameter, thirdParameter);
+	}
+	while x < 2 {
+		x = x + 1;
+		if x > 5 { break ; }
+	}
+
+	// comment before return
+	return x; // after return
+	// end of block
+}
+// trailing comment without newline`
+
+const want = `// Package comment
+
+const std = @import("std"); // trailing comment
+struct TwoInts(a: i32, b: i32);
+newtype Meters = u32;
+struct Options(width: u32 = 80, verbose: bool = false);
+const Word = union(bytes: [4]u8, value: u32);
+
+trait(closed) Type {}
+trait Drop {
+	// drop it
+	func drop(self: Self) void;
+}
+impl TwoInts(Drop) {
+	func drop(self: TwoInts) void {}
+}
+
+func genericAdd(x: forSome Integer, y: @TypeOf(x)) @TypeOf(x) {
+	return x + y;
+}
+
+func longFunctionName(
+	firstParameter: i32,
+	secondParameter: i32,
+	thirdParameter: i32,
+	fourth: i32,
+) i32 {
+	let x: i32 = firstParameter;
+	if x < 2 {
+		std.printf(
+			"a very long string that goes on and on",
+			firstParameter,
+			secondParameter,
+			thirdParameter,
+		);
+	}
+	while x < 2 {
+		x = x + 1;
+		if x > 5 {
+			break;
+		}
+	}
+
+	// comment before return
+	return x; // after return
+	// end of block
+}
+// trailing comment without newline
+`
+
+func TestSource(t *testing.T) {
+	got, err := Source([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	again, err := Source(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, got) {
+		t.Errorf("formatting is not idempotent:\n%s", again)
+	}
+}
+
+func TestPreservesSyntax(t *testing.T) {
+	before, err := parser.ParseBytes("main", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatted, err := Source([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := parser.ParseBytes("main", formatted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clearPositions(reflect.ValueOf(before))
+	clearPositions(reflect.ValueOf(after))
+	if !reflect.DeepEqual(before, after) {
+		t.Error("formatting changed the syntax tree")
+	}
+}
+
+func clearPositions(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			clearPositions(v.Elem())
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			clearPositions(v.Index(i))
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			clearPositions(v.Field(i))
+		}
+	default:
+		if v.Type() == reflect.TypeFor[token.Pos]() {
+			v.SetInt(0)
+		}
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	if _, err := Source([]byte("func f( {")); err == nil {
+		t.Error("formatted source with syntax errors")
+	}
+}
@@ -0,0 +1,435 @@
+// Package importer implements a semantics.Importer that loads modules from
+// source files and export data files.
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"codeberg.org/rileyq/usagi/internal/compile/ast"
+	"codeberg.org/rileyq/usagi/internal/compile/parser"
+	"codeberg.org/rileyq/usagi/internal/compile/semantics"
+	"codeberg.org/rileyq/usagi/internal/compile/token"
+)
+
+// Ext is the file extension of Usagi source files.
+const Ext = ".usagi"
+
+// ExportExt is the file extension of the export data files written by
+// semantics.WriteExportData, which are stored next to the source of their
+// module.
+const ExportExt = ".usagix"
+
+// An Importer loads the modules named by @import from source files,
+// checking each one the first time it is imported and caching the result.
+// A module whose export data file is at least as new as its source, and
+// was written with the modules it imports as they are now, is read from
+// the export data instead, as is a module which has no source.
+// Names starting with "./" or "../" are relative to the directory of the
+// importing module; any other name is looked up in each directory of the
+// search path in turn.
+//
+// Before a module is checked, the modules it imports are found by parsing
+// it and the modules they import in turn. Modules that do not depend on
+// each other are then checked concurrently, each one as soon as its
+// imports have been checked.
+//
+// An Importer is safe for concurrent use, and may be shared by any number
+// of calls to semantics.Check so that each module is checked only once.
+type Importer struct {
+	searchPath []string
+	cfg        semantics.CheckConfig
+	// workers holds a token for each module being checked, limiting how
+	// many are checked at once.
+	workers chan struct{}
+
+	// mu guards modules and the imports and errs of each module. It is
+	// only held briefly, never while a module is read.
+	mu      sync.Mutex
+	modules map[string]*module
+}
+
+// A module is a module requested from an Importer, identified by the path
+// of its source. done is closed once it has been loaded, after which
+// result and err are set.
+type module struct {
+	path string
+	// imports maps the names imported by the module to the modules they
+	// resolve to, and errs to the error importing them reports instead.
+	imports map[string]*module
+	errs    map[string]error
+
+	done   chan struct{}
+	result *semantics.Module
+	err    error
+}
+
+// New returns an Importer that searches the directories of searchPath and
+// checks modules using cfg, whose Module, Info, Importer and Dir are
+// ignored. If cfg is nil, modules are checked with the defaults. Function
+// bodies are always checked, so that the modules importing a module can
+// call its functions at compile time. Up to GOMAXPROCS modules are checked
+// at once.
+func New(searchPath []string, cfg *semantics.CheckConfig) *Importer {
+	imp := &Importer{
+		searchPath: slices.Clone(searchPath),
+		workers:    make(chan struct{}, runtime.GOMAXPROCS(0)),
+		modules:    map[string]*module{},
+	}
+	if cfg != nil {
+		imp.cfg = *cfg
+	}
+	imp.cfg.Module, imp.cfg.Info, imp.cfg.Importer, imp.cfg.Dir = nil, nil, nil, ""
+	imp.cfg.CheckFuncBodies = true
+	return imp
+}
+
+// SetWorkers sets the number of modules checked at once to n, or to 1 if n
+// is less than 1. It must not be called once imp is in use.
+func (imp *Importer) SetWorkers(n int) {
+	imp.workers = make(chan struct{}, max(n, 1))
+}
+
+// Import imports name, resolving relative names against the current
+// directory.
+func (imp *Importer) Import(name string) (*semantics.Module, error) {
+	return imp.ImportFrom(name, ".")
+}
+
+// ImportFrom imports name for a module whose source is in dir.
+func (imp *Importer) ImportFrom(name, dir string) (*semantics.Module, error) {
+	path, err := imp.resolve(name, dir)
+	if err != nil {
+		return nil, err
+	}
+	m := imp.add(path)
+	<-m.done
+	return m.result, m.err
+}
+
+// add returns the module stored at path. If the module has not been
+// requested before, add claims it and loads it. imp.mu must not be held,
+// as only claiming the module is done with it held.
+func (imp *Importer) add(path string) *module {
+	imp.mu.Lock()
+	m, found := imp.modules[path]
+	if !found {
+		m = &module{
+			path:    path,
+			imports: map[string]*module{},
+			errs:    map[string]error{},
+			done:    make(chan struct{}),
+		}
+		imp.modules[path] = m
+	}
+	imp.mu.Unlock()
+	if !found {
+		imp.load(m)
+	}
+	return m
+}
+
+// load finds the imports of m, adding each of them in turn, and starts
+// checking it.
+func (imp *Importer) load(m *module) {
+	moduleAst, exported, err := imp.parse(m)
+	if moduleAst == nil && exported == nil {
+		m.err = err
+		close(m.done)
+		return
+	}
+	var names []string
+	if exported != nil {
+		for _, dep := range exported.Dependencies() {
+			names = append(names, dep.Name)
+		}
+	} else {
+		names = imports(moduleAst)
+	}
+
+	dir := filepath.Dir(m.path)
+	for _, name := range names {
+		imp.mu.Lock()
+		_, found := m.imports[name]
+		imp.mu.Unlock()
+		if found {
+			continue
+		}
+		importPath, err := imp.resolve(name, dir)
+		if err != nil {
+			imp.mu.Lock()
+			m.errs[name] = err
+			imp.mu.Unlock()
+			continue
+		}
+		dep := imp.add(importPath)
+		// Modules are loaded concurrently, so each import is checked for a
+		// cycle as it is recorded: whichever is recorded last completes
+		// the cycle, and finds it.
+		imp.mu.Lock()
+		if cycle := imp.cycle(dep, m); cycle != nil {
+			m.errs[name] = &CycleError{Modules: append([]string{moduleName(m.path)}, cycle...)}
+		} else {
+			m.imports[name] = dep
+		}
+		imp.mu.Unlock()
+	}
+	go imp.check(m, moduleAst, exported)
+}
+
+// parse parses the source of m. If m has export data at least as new as
+// its source it is read instead, and returned with a nil module; it is
+// only used if its dependencies are up to date. If m has no source, its
+// export data is used regardless, and parse returns two nil modules after
+// setting m.result.
+func (imp *Importer) parse(m *module) (*ast.Module, *semantics.Module, error) {
+	exportPath := exportFile(m.path)
+	exportInfo, err := os.Stat(exportPath)
+	if err == nil {
+		srcInfo, err := os.Stat(m.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			m.result, err = readExportData(exportPath)
+			return nil, nil, err
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if !exportInfo.ModTime().Before(srcInfo.ModTime()) {
+			exported, err := readExportData(exportPath)
+			if !errors.Is(err, semantics.ErrExportVersion) {
+				return nil, exported, err
+			}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	moduleAst, err := parseSource(m.path)
+	return moduleAst, nil, err
+}
+
+// parseSource parses the source of the module stored at path.
+func parseSource(path string) (*ast.Module, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	moduleAst, err := parser.ParseBytes(moduleName(path), src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return moduleAst, nil
+}
+
+// check checks m once its imports have been loaded. If m was read from
+// export data, the export data is used instead if it is up to date.
+func (imp *Importer) check(m *module, moduleAst *ast.Module, exported *semantics.Module) {
+	defer close(m.done)
+	for _, dep := range m.imports {
+		<-dep.done
+	}
+	if exported != nil {
+		if imp.upToDate(m, exported) {
+			m.result = exported
+			return
+		}
+		var err error
+		if moduleAst, err = parseSource(m.path); err != nil {
+			m.err = err
+			return
+		}
+	}
+	imp.workers <- struct{}{}
+	defer func() { <-imp.workers }()
+
+	cfg := imp.cfg
+	cfg.Module = moduleAst
+	cfg.Dir = filepath.Dir(m.path)
+	cfg.Importer = &moduleImporter{imp, m}
+	m.result, m.err = semantics.Check(&cfg)
+	if m.err != nil {
+		m.result, m.err = nil, fmt.Errorf("%s: %w", m.path, m.err)
+	}
+}
+
+// upToDate reports whether the modules imported by m, whose export data
+// was read as exported, have the fingerprints they had when it was
+// written.
+func (imp *Importer) upToDate(m *module, exported *semantics.Module) bool {
+	for _, dep := range exported.Dependencies() {
+		imp.mu.Lock()
+		imported := m.imports[dep.Name]
+		imp.mu.Unlock()
+		if imported == nil || imported.result == nil || dep.Fingerprint == (semantics.Fingerprint{}) ||
+			imported.result.Fingerprint() != dep.Fingerprint {
+			return false
+		}
+	}
+	return true
+}
+
+// A moduleImporter imports the modules of a module being checked.
+type moduleImporter struct {
+	imp *Importer
+	m   *module
+}
+
+func (mi *moduleImporter) Import(name string) (*semantics.Module, error) {
+	return mi.ImportFrom(name, filepath.Dir(mi.m.path))
+}
+
+func (mi *moduleImporter) ImportFrom(name, dir string) (*semantics.Module, error) {
+	imp := mi.imp
+	imp.mu.Lock()
+	dep, found := mi.m.imports[name]
+	err := mi.m.errs[name]
+	imp.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		<-dep.done
+		return dep.result, dep.err
+	}
+
+	// The name was not found by parsing the module, as it is not given by
+	// a string literal, so it is added now. The module's worker is given up
+	// while the import is loaded, so that the import can be checked.
+	path, err := imp.resolve(name, dir)
+	if err != nil {
+		return nil, err
+	}
+	dep = imp.add(path)
+	imp.mu.Lock()
+	if cycle := imp.cycle(dep, mi.m); cycle != nil {
+		imp.mu.Unlock()
+		return nil, &CycleError{Modules: append([]string{moduleName(mi.m.path)}, cycle...)}
+	}
+	mi.m.imports[name] = dep
+	imp.mu.Unlock()
+
+	<-imp.workers
+	<-dep.done
+	imp.workers <- struct{}{}
+	return dep.result, dep.err
+}
+
+// cycle returns the names of the modules on a path of imports from m to
+// target, or nil if there is none. imp.mu must be held.
+func (imp *Importer) cycle(m, target *module) []string {
+	if m == target {
+		return []string{moduleName(m.path)}
+	}
+	for _, dep := range m.imports {
+		if path := imp.cycle(dep, target); path != nil {
+			return append([]string{moduleName(m.path)}, path...)
+		}
+	}
+	return nil
+}
+
+// imports returns the names of the modules imported by m with
+// @import("name"), in order of appearance.
+func imports(m *ast.Module) []string {
+	var names []string
+	ast.Inspect(m, func(node ast.Node) bool {
+		call, isCall := node.(*ast.CallExpr)
+		if !isCall || len(call.Args) != 1 {
+			return true
+		}
+		builtin, isIdent := call.Base.(*ast.Identifier)
+		lit, isLit := call.Args[0].(*ast.Literal)
+		if !isIdent || builtin.Name != "@import" || !isLit || lit.Tok != token.String {
+			return true
+		}
+		if name, err := strconv.Unquote(lit.Value); err == nil {
+			names = append(names, name)
+		}
+		return true
+	})
+	return names
+}
+
+// readExportData reads the module stored as export data at path.
+func readExportData(path string) (*semantics.Module, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	module, err := semantics.ReadExportData(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return module, nil
+}
+
+// resolve returns the absolute path of the source of the module name
+// imported from dir. The source itself need not exist if the module has
+// an export data file.
+func (imp *Importer) resolve(name, dir string) (string, error) {
+	file := filepath.FromSlash(name)
+	if filepath.Ext(file) != Ext {
+		file += Ext
+	}
+
+	if strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../") {
+		return filepath.Abs(filepath.Join(dir, file))
+	}
+	if filepath.IsAbs(file) {
+		return filepath.Clean(file), nil
+	}
+	for _, searchDir := range imp.searchPath {
+		path := filepath.Join(searchDir, file)
+		found, err := exists(path)
+		if err == nil && !found {
+			found, err = exists(exportFile(path))
+		}
+		if err != nil {
+			return "", err
+		}
+		if found {
+			return filepath.Abs(path)
+		}
+	}
+	return "", fmt.Errorf("module %q not found in search path %s", name, strings.Join(imp.searchPath, string(filepath.ListSeparator)))
+}
+
+func exists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// exportFile returns the path of the export data file of the module whose
+// source is stored at path.
+func exportFile(path string) string {
+	return strings.TrimSuffix(path, Ext) + ExportExt
+}
+
+// A CycleError is returned when a module imports itself, directly or
+// through other modules.
+type CycleError struct {
+	// Modules lists the modules of the cycle in import order, starting and
+	// ending with the same module.
+	Modules []string
+}
+
+func (err *CycleError) Error() string {
+	return "import cycle: " + strings.Join(err.Modules, " imports ")
+}
+
+// moduleName returns the name of the module stored at path.
+func moduleName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), Ext)
+}
@@ -0,0 +1,275 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"codeberg.org/rileyq/usagi/internal/compile/parser"
+	"codeberg.org/rileyq/usagi/internal/compile/semantics"
+)
+
+// writeFiles writes files, which maps slash-separated paths to their
+// contents, to a new temporary directory and returns it.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func check(t *testing.T, imp *Importer, dir, src string) (*semantics.Module, error) {
+	t.Helper()
+	moduleAst, err := parser.ParseBytes("main", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return semantics.Check(&semantics.CheckConfig{Module: moduleAst, Importer: imp, Dir: dir})
+}
+
+func TestImport(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"lib/std.usagi":      `export const answer: i32 = 42;`,
+		"override/std.usagi": `export const answer: i32 = 0;`,
+		"lib/std/io.usagi":   `const util = @import("./util"); export const size = util.size;`,
+		"lib/std/util.usagi": `export const size: u32 = 4096;`,
+		"app/helper.usagi":   `export const std = @import("std"); export const answer = std.answer;`,
+	})
+	imp := New([]string{filepath.Join(dir, "lib"), filepath.Join(dir, "override")}, nil)
+
+	module, err := check(t, imp, filepath.Join(dir, "app"), `
+const helper = @import("./helper");
+const io = @import("std/io");
+const answer = helper.answer;
+const size = io.size;
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"answer": "42", "size": "4096"} {
+		if got := module.Scope().Lookup(name).Value(); got == nil || got.(*semantics.IntegerLiteral).String() != want {
+			t.Errorf("%s = %v, want %s", name, got, want)
+		}
+	}
+
+	// Each module is checked once, however many times it is imported.
+	std, err := imp.Import("std")
+	if err != nil {
+		t.Fatal(err)
+	}
+	helper, err := imp.ImportFrom("./helper", filepath.Join(dir, "app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported := helper.Scope().Lookup("std").Value().(*semantics.ModuleImport).Module()
+	if std != imported {
+		t.Errorf("std was checked more than once")
+	}
+	if len(imp.modules) != 4 {
+		t.Errorf("got %d cached modules, want 4", len(imp.modules))
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.usagi":   `const b = @import("./b");`,
+		"b.usagi":   `const c = @import("./c");`,
+		"c.usagi":   `const a = @import("./a");`,
+		"bad.usagi": `const x = ;`,
+	})
+	imp := New([]string{dir}, nil)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"a", "import cycle: a imports b imports c imports a"},
+		{"missing", `module "missing" not found in search path ` + dir},
+		{"bad", "bad.usagi"},
+	}
+	for _, test := range tests {
+		_, err := imp.Import(test.name)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("importing %s: got error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+// writeExportData checks the module src and writes its export data to
+// path.
+func writeExportData(t *testing.T, path, src string) {
+	t.Helper()
+	module, err := check(t, New(nil, nil), filepath.Dir(path), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := semantics.WriteExportData(&buf, module); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportExportData(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"fresh.usagi":       `export const answer: i32 = 1;`,
+		"stale.usagi":       `export const answer: i32 = 2;`,
+		"unsupported.usagi": `export const answer: i32 = 3;`,
+	})
+	writeExportData(t, filepath.Join(dir, "fresh"+ExportExt), `export const answer: i32 = 10;`)
+	writeExportData(t, filepath.Join(dir, "stale"+ExportExt), `export const answer: i32 = 20;`)
+	writeExportData(t, filepath.Join(dir, "binary"+ExportExt), `export const answer: i32 = 40;`)
+	if err := os.WriteFile(filepath.Join(dir, "unsupported"+ExportExt), []byte("\x00usagi\x63"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "stale"+ExportExt), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	imp := New([]string{dir}, nil)
+	for name, want := range map[string]string{"fresh": "10", "stale": "2", "unsupported": "3", "binary": "40"} {
+		module, err := imp.Import(name)
+		if err != nil {
+			t.Errorf("importing %s: %v", name, err)
+			continue
+		}
+		if got := module.LookupExport("answer").Value().(*semantics.IntegerLiteral).String(); got != want {
+			t.Errorf("%s.answer = %s, want %s", name, got, want)
+		}
+	}
+}
+
+// TestImportStaleDependency covers export data that is newer than its
+// source but was written before a module it imports changed.
+func TestImportStaleDependency(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"base.usagi": `export const size: u32 = 1;`,
+		"user.usagi": `const base = @import("./base"); export const total = base.size + 1;`,
+	})
+	writeExportData(t, filepath.Join(dir, "base"+ExportExt), `export const size: u32 = 1;`)
+	// The export data differs from the source, so that it can be told
+	// which one was used.
+	writeExportData(t, filepath.Join(dir, "user"+ExportExt), `const base = @import("./base"); export const total = base.size + 10;`)
+
+	total := func() string {
+		t.Helper()
+		module, err := New([]string{dir}, nil).Import("user")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return module.LookupExport("total").Value().(*semantics.IntegerLiteral).String()
+	}
+	if got := total(); got != "11" {
+		t.Errorf("total = %s, want 11 from the export data", got)
+	}
+
+	path := filepath.Join(dir, "base.usagi")
+	if err := os.WriteFile(path, []byte(`export const size: u32 = 5;`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := total(); got != "6" {
+		t.Errorf("total = %s, want 6 from the source", got)
+	}
+}
+
+func TestImportConcurrent(t *testing.T) {
+	files := map[string]string{
+		"base.usagi": `export struct Point(x: i32, y: i32);`,
+		"util.usagi": `const base = @import("base"); export func sum(p: base.Point) i32 { return p.x + p.y; }`,
+		// The name of dynamic is not a string literal, so it is only found
+		// once app is checked.
+		"app.usagi":     `const name = "./dynamic"; export const dynamic = @import(name);`,
+		"dynamic.usagi": `export const answer: i32 = 42;`,
+		"loop.usagi":    `const name = "./back"; const back = @import(name);`,
+		"back.usagi":    `const loop = @import("./loop");`,
+		// The modules of the cycle are loaded concurrently, each from a
+		// different import.
+		"x.usagi": `const y = @import("./y");`,
+		"y.usagi": `const z = @import("./z");`,
+		"z.usagi": `const x = @import("./x");`,
+	}
+	const n = 8
+	for i := range n {
+		files[fmt.Sprintf("m%d.usagi", i)] = fmt.Sprintf(`const base = @import("base");
+const util = @import("util");
+export const total = util.sum(base.Point(%d, 1));
+`, i)
+	}
+	dir := writeFiles(t, files)
+
+	for _, workers := range []int{1, 4} {
+		imp := New([]string{dir}, nil)
+		imp.SetWorkers(workers)
+
+		modules := make([]*semantics.Module, n)
+		var wg sync.WaitGroup
+		for i := range n {
+			wg.Go(func() {
+				module, err := imp.Import(fmt.Sprintf("m%d", i))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				modules[i] = module
+			})
+		}
+		wg.Wait()
+		for i, module := range modules {
+			if module == nil {
+				continue
+			}
+			if got, want := module.LookupExport("total").Value().(*semantics.IntegerLiteral).String(), fmt.Sprint(i+1); got != want {
+				t.Errorf("m%d.total = %s, want %s", i, got, want)
+			}
+		}
+		if len(imp.modules) != n+2 {
+			t.Errorf("got %d cached modules, want %d", len(imp.modules), n+2)
+		}
+
+		app, err := imp.Import("app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dynamic, err := imp.Import("dynamic")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if imported := app.LookupExport("dynamic").Value().(*semantics.ModuleImport).Module(); imported != dynamic {
+			t.Errorf("dynamic was checked more than once")
+		}
+
+		for _, name := range []string{"x", "y", "z"} {
+			wg.Go(func() {
+				if _, err := imp.Import(name); err == nil || !strings.Contains(err.Error(), "import cycle") {
+					t.Errorf("importing %s: got error %v, want an import cycle", name, err)
+				}
+			})
+		}
+		wg.Wait()
+
+		_, err = imp.Import("loop")
+		if want := "import cycle: loop imports back imports loop"; err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+	}
+}
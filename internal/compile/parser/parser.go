@@ -12,10 +12,22 @@ import (
 	"codeberg.org/rileyq/usagi/internal/compile/token"
 )
 
+type Mode uint
+
+const (
+	// Trivia records every scanned token, including white space and
+	// comments, so that a lossless syntax tree can be built from the
+	// result. See Tokens.
+	Trivia Mode = 1 << iota
+)
+
 type Parser struct {
-	scn  Scanner
-	t    *token.Token
-	errs []error
+	scn    Scanner
+	mode   Mode
+	t      *token.Token
+	prev   *token.Token
+	errs   []error
+	tokens []*token.Token
 }
 
 func (p *Parser) Parse(name string) (*ast.Module, error) {
@@ -33,6 +45,12 @@ func (p *Parser) Parse(name string) (*ast.Module, error) {
 	return &ast.Module{Name: name, Decls: decls}, p.wrappedError()
 }
 
+// Tokens returns every token read by the parser in source order. It is
+// only populated in Trivia mode.
+func (p *Parser) Tokens() []*token.Token {
+	return p.tokens
+}
+
 func (p *Parser) wrappedError() error {
 	return errors.Join(p.errs...)
 }
@@ -41,7 +59,7 @@ var topLevelRecoveryTokens = []token.Type{token.Semicolon}
 
 func (p *Parser) decl() ast.Decl {
 	switch p.peekNext() {
-	case token.Export, token.Const, token.Let, token.Func, token.Struct, token.Trait:
+	case token.Export, token.Const, token.Let, token.Func, token.Struct, token.Trait, token.Newtype:
 		return p.binding()
 	case token.Impl:
 		return p.impl()
@@ -53,8 +71,9 @@ func (p *Parser) decl() ast.Decl {
 func (p *Parser) impl() *ast.ImplDecl {
 	var traits []ast.Expr
 	var defs []*ast.Binding
+	var rbrace token.Pos
 
-	p.expect(token.Impl)
+	impl := pos(p.expect(token.Impl))
 
 	typ := p.expr2(nil, token.PrecedenceCall)
 	if p.accept(token.OpenParen) != nil {
@@ -72,7 +91,8 @@ func (p *Parser) impl() *ast.ImplDecl {
 
 	p.expect(token.OpenBrace)
 	for p.t != nil {
-		if p.accept(token.CloseBrace) != nil {
+		if t := p.accept(token.CloseBrace); t != nil {
+			rbrace = t.Pos
 			break
 		}
 		binding := p.binding()
@@ -82,9 +102,11 @@ func (p *Parser) impl() *ast.ImplDecl {
 	}
 
 	return &ast.ImplDecl{
+		Impl:        impl,
 		Type:        typ,
 		Traits:      traits,
 		Definitions: defs,
+		Rbrace:      rbrace,
 	}
 }
 
@@ -93,6 +115,8 @@ func (p *Parser) binding() *ast.Binding {
 	var typ ast.Expr
 	var val ast.Expr
 
+	start := p.pos()
+
 	if p.accept(token.Export) != nil {
 		mode |= ast.ModeExport
 	}
@@ -112,30 +136,39 @@ func (p *Parser) binding() *ast.Binding {
 			val = p.expr()
 		}
 
-		p.expect(token.Semicolon)
+		semicolon := pos(p.expect(token.Semicolon))
 
 		return &ast.Binding{
-			Token: token.Const,
-			Mode:  mode,
-			Name:  name,
-			Type:  typ,
-			Value: val,
+			BindingPos: start,
+			Token:      token.Const,
+			Mode:       mode,
+			Name:       name,
+			Type:       typ,
+			Value:      val,
+			Semicolon:  semicolon,
 		}
 	}
 
-	switch p.t.Type {
+	var b *ast.Binding
+	switch p.peekNext() {
 	case token.Let:
-		return p.letBinding(mode)
+		b = p.letBinding(mode)
 	case token.Func:
-		return p.funcBinding(mode)
+		b = p.funcBinding(mode)
 	case token.Struct:
-		return p.structBinding(mode)
+		b = p.structBinding(mode)
+	case token.Newtype:
+		b = p.newtypeBinding(mode)
 	case token.Trait:
-		return p.traitBinding(mode)
+		b = p.traitBinding(mode)
 	default:
 		p.unexpected("binding")
 		return nil
 	}
+	if b != nil {
+		b.BindingPos = start
+	}
+	return b
 }
 
 func (p *Parser) traitBinding(mode ast.BindingMode) *ast.Binding {
@@ -143,19 +176,12 @@ func (p *Parser) traitBinding(mode ast.BindingMode) *ast.Binding {
 	p.expect(token.Trait)
 
 	if p.accept(token.OpenParen) != nil {
-		state := p.identifier()
-		if state.Name != "open" && state.Name != "closed" {
-			p.error(fmt.Errorf("expected \"open\" or \"closed\" for trait"))
-		}
-		closed = state.Name == "closed"
-		p.expect(token.CloseParen)
+		closed = p.traitState()
 	}
 
 	name := p.identifier()
 	value := p.traitBody()
-	if value != nil {
-		value.Closed = closed
-	}
+	value.Closed = closed
 	return &ast.Binding{
 		Token: token.Trait,
 		Mode:  mode,
@@ -168,14 +194,34 @@ func (p *Parser) traitBinding(mode ast.BindingMode) *ast.Binding {
 func (p *Parser) structBinding(mode ast.BindingMode) *ast.Binding {
 	p.expect(token.Struct)
 	name := p.identifier()
-	members := p.fields()
-	p.expect(token.Semicolon)
+	value := p.fields()
+	semicolon := pos(p.expect(token.Semicolon))
 	return &ast.Binding{
-		Token: token.Struct,
-		Mode:  mode,
-		Name:  name,
-		Type:  nil,
-		Value: &ast.StructExpr{Members: members},
+		Token:     token.Struct,
+		Mode:      mode,
+		Name:      name,
+		Type:      nil,
+		Value:     value,
+		Semicolon: semicolon,
+	}
+}
+
+func (p *Parser) newtypeBinding(mode ast.BindingMode) *ast.Binding {
+	p.expect(token.Newtype)
+	name := p.identifier()
+	if name == nil {
+		return nil
+	}
+	p.expect(token.Assign)
+	value := p.expr()
+	semicolon := pos(p.expect(token.Semicolon))
+	return &ast.Binding{
+		Token:     token.Newtype,
+		Mode:      mode,
+		Name:      name,
+		Type:      nil,
+		Value:     value,
+		Semicolon: semicolon,
 	}
 }
 
@@ -195,12 +241,15 @@ func (p *Parser) letBinding(mode ast.BindingMode) *ast.Binding {
 		val = p.expr()
 	}
 
+	semicolon := pos(p.expect(token.Semicolon))
+
 	return &ast.Binding{
-		Token: token.Let,
-		Mode:  mode,
-		Name:  name,
-		Type:  typ,
-		Value: val,
+		Token:     token.Let,
+		Mode:      mode,
+		Name:      name,
+		Type:      typ,
+		Value:     val,
+		Semicolon: semicolon,
 	}
 }
 
@@ -214,32 +263,37 @@ func (p *Parser) funcBinding(mode ast.BindingMode) *ast.Binding {
 
 	fn := p.funcBody()
 
+	var semicolon token.Pos
 	if fn.Body == nil {
-		p.expect(token.Semicolon)
+		semicolon = pos(p.expect(token.Semicolon))
 	}
 
 	return &ast.Binding{
-		Token: token.Func,
-		Mode:  mode,
-		Name:  name,
-		Type:  nil,
-		Value: fn,
+		Token:     token.Func,
+		Mode:      mode,
+		Name:      name,
+		Type:      nil,
+		Value:     fn,
+		Semicolon: semicolon,
 	}
 }
 
 func (p *Parser) funcBody() *ast.FuncExpr {
 	var params []*ast.Param
 	var body *ast.BlockExpr
+	var rparen token.Pos
 
-	p.expect(token.OpenParen)
+	lparen := pos(p.expect(token.OpenParen))
 	for p.t != nil {
-		if p.accept(token.CloseParen) != nil {
+		if t := p.accept(token.CloseParen); t != nil {
+			rparen = t.Pos
 			break
 		}
 		params = append(params, p.param())
 		if p.accept(token.Comma) != nil {
 			continue
-		} else if p.accept(token.CloseParen) != nil {
+		} else if t := p.accept(token.CloseParen); t != nil {
+			rparen = t.Pos
 			break
 		} else {
 			p.expect(token.CloseParen)
@@ -253,7 +307,9 @@ func (p *Parser) funcBody() *ast.FuncExpr {
 	}
 
 	return &ast.FuncExpr{
+		Lparen:     lparen,
 		Params:     params,
+		Rparen:     rparen,
 		ReturnType: returnType,
 		Body:       body,
 	}
@@ -261,33 +317,36 @@ func (p *Parser) funcBody() *ast.FuncExpr {
 
 func (p *Parser) blockExpr() *ast.BlockExpr {
 	var stmts []ast.Stmt
+	var rbrace token.Pos
 
-	p.expect(token.OpenBrace)
+	lbrace := pos(p.expect(token.OpenBrace))
 	for p.t != nil {
-		if p.accept(token.CloseBrace) != nil {
+		if t := p.accept(token.CloseBrace); t != nil {
+			rbrace = t.Pos
 			break
 		}
-		stmts = append(stmts, p.stmt())
+		if stmt := p.stmt(); stmt != nil {
+			stmts = append(stmts, stmt)
+		}
 	}
 
-	return &ast.BlockExpr{List: stmts}
+	return &ast.BlockExpr{Lbrace: lbrace, List: stmts, Rbrace: rbrace}
 }
 
 func (p *Parser) stmt() ast.Stmt {
 	switch p.peekNext() {
-	case token.Return, token.Identifier:
+	case token.Return, token.Break, token.Identifier:
 		x := p.expr()
-		p.expect(token.Semicolon)
-		return &ast.ExprStmt{X: x}
-	case token.If:
+		semicolon := pos(p.expect(token.Semicolon))
+		return &ast.ExprStmt{X: x, Semicolon: semicolon}
+	case token.If, token.While:
 		x := p.expr()
 		return &ast.ExprStmt{X: x}
-	case token.Struct, token.Trait, token.Impl, token.Func:
-		return &ast.DeclStmt{X: p.decl()}
-	case token.Let, token.Const:
-		decl := p.decl()
-		p.expect(token.Semicolon)
-		return &ast.DeclStmt{X: decl}
+	case token.Struct, token.Trait, token.Impl, token.Func, token.Let, token.Const, token.Newtype:
+		if decl := p.decl(); decl != nil {
+			return &ast.DeclStmt{X: decl}
+		}
+		return nil
 	default:
 		p.unexpected("statement")
 		return nil
@@ -295,20 +354,26 @@ func (p *Parser) stmt() ast.Stmt {
 }
 
 func (p *Parser) param() *ast.Param {
-	if p.accept(token.Ellipses) != nil {
+	if t := p.accept(token.Ellipses); t != nil {
 		return &ast.Param{
 			Name: nil,
-			Type: &ast.VarArgExpr{},
+			Type: &ast.VarArgExpr{Ellipses: t.Pos},
 		}
 	}
 
 	name := p.identifier()
 	p.expect(token.Colon)
-	typ := p.expr()
+	typ := p.expr2(nil, token.PrecedenceAssignment)
+
+	var def ast.Expr
+	if p.accept(token.Assign) != nil {
+		def = p.expr()
+	}
 
 	return &ast.Param{
-		Name: name,
-		Type: typ,
+		Name:    name,
+		Type:    typ,
+		Default: def,
 	}
 }
 
@@ -319,9 +384,6 @@ func (p *Parser) expr() ast.Expr {
 func (p *Parser) expr2(left ast.Expr, prec token.Precedence) ast.Expr {
 	if left == nil {
 		left = p.unaryOperand()
-		if left == nil {
-			return &ast.BadExpr{}
-		}
 	}
 
 	for p.peekNext().Precedence() > prec {
@@ -340,7 +402,8 @@ func (p *Parser) binaryExpr(left ast.Expr) ast.Expr {
 		p.next()
 		member := p.identifier()
 		return &ast.MemberExpr{Base: left, Member: member}
-	case token.Less, token.Minus, token.Plus, token.Assign:
+	case token.Less, token.LessEqual, token.Greater, token.GreaterEqual, token.Equal, token.NotEqual,
+		token.Minus, token.Plus, token.Assign:
 		p.next()
 		right := p.expr2(nil, t.Precedence())
 		return &ast.BinaryExpr{
@@ -357,14 +420,17 @@ func (p *Parser) binaryExpr(left ast.Expr) ast.Expr {
 
 func (p *Parser) index(base ast.Expr) *ast.IndexExpr {
 	var indices []ast.Expr
+	var rbrack token.Pos
 
 	p.expect(token.OpenBracket)
 	for p.t != nil {
-		if p.accept(token.CloseBracket) != nil {
+		if t := p.accept(token.CloseBracket); t != nil {
+			rbrack = t.Pos
 			break
 		}
 		indices = append(indices, p.expr())
-		if p.accept(token.CloseBracket) != nil {
+		if t := p.accept(token.CloseBracket); t != nil {
+			rbrack = t.Pos
 			break
 		}
 		p.expect(token.Comma)
@@ -373,21 +439,25 @@ func (p *Parser) index(base ast.Expr) *ast.IndexExpr {
 	return &ast.IndexExpr{
 		Base:    base,
 		Indices: indices,
+		Rbrack:  rbrack,
 	}
 }
 
 func (p *Parser) call(base ast.Expr) ast.Expr {
 	var args []ast.Expr
+	var rparen token.Pos
 
 	p.expect(token.OpenParen)
 	for p.t != nil {
-		if p.accept(token.CloseParen) != nil {
+		if t := p.accept(token.CloseParen); t != nil {
+			rparen = t.Pos
 			break
 		}
 
 		args = append(args, p.argument())
 
-		if p.accept(token.CloseParen) != nil {
+		if t := p.accept(token.CloseParen); t != nil {
+			rparen = t.Pos
 			break
 		} else if p.accept(token.Comma) != nil {
 			continue
@@ -397,8 +467,9 @@ func (p *Parser) call(base ast.Expr) ast.Expr {
 	}
 
 	return &ast.CallExpr{
-		Base: base,
-		Args: args,
+		Base:   base,
+		Args:   args,
+		Rparen: rparen,
 	}
 }
 
@@ -427,62 +498,88 @@ func (p *Parser) unaryOperand() ast.Expr {
 		return p.integer()
 	case token.Return:
 		var expr ast.Expr
+		ret := p.pos()
 		p.next()
-		if p.t.Type != token.Semicolon {
+		if p.peekNext() != token.Semicolon {
 			expr = p.expr()
 		}
-		return &ast.ReturnExpr{Value: expr}
+		return &ast.ReturnExpr{Return: ret, Value: expr}
+	case token.Break:
+		brk := p.pos()
+		p.next()
+		return &ast.BreakExpr{Break: brk}
 	case token.Func:
+		fn := p.pos()
 		p.next()
-		return p.funcBody()
+		expr := p.funcBody()
+		expr.Func = fn
+		return expr
 	case token.Ellipses:
+		ellipses := p.pos()
 		p.next()
-		return &ast.VarArgExpr{}
+		return &ast.VarArgExpr{Ellipses: ellipses}
 	case token.OpenBracket:
 		return p.sliceOrManyPointer()
 	case token.If:
 		return p.ifExpr()
+	case token.While:
+		return p.whileExpr()
 	case token.Struct:
 		return p.structExpr()
+	case token.Union:
+		return p.unionExpr()
 	case token.Trait:
 		return p.traitExpr()
-	case token.Bang:
+	case token.Bang, token.Minus:
+		op := p.t
 		p.next()
-		base := p.unaryOperand()
-		return &ast.UnaryExpr{Op: token.Bang, Base: base}
+		// Calls, members and indices bind more tightly than prefix
+		// operators.
+		base := p.expr2(nil, token.PrecedenceAddition)
+		return &ast.UnaryExpr{OpPos: op.Pos, Op: op.Type, Base: base}
 	case token.ForSome:
+		forSome := p.pos()
 		p.next()
 		base := p.unaryOperand()
-		return &ast.ExistentialExpr{Base: base}
+		return &ast.ExistentialExpr{ForSome: forSome, Base: base}
 	default:
+		from := p.pos()
 		p.unexpected("unary operand")
-		return &ast.BadExpr{}
+		return &ast.BadExpr{From: from, To: p.prevEnd()}
 	}
 }
 
 func (p *Parser) traitExpr() *ast.TraitExpr {
 	var closed bool
-	p.expect(token.Trait)
+	trait := pos(p.expect(token.Trait))
 	if p.accept(token.OpenParen) != nil {
-		state := p.identifier()
-		if state.Name != "open" && state.Name != "closed" {
-			p.error(fmt.Errorf("expected \"open\" or \"closed\" for trait"))
-		}
-		closed = state.Name == "closed"
-		p.expect(token.CloseParen)
+		closed = p.traitState()
 	}
 	body := p.traitBody()
-	if body != nil {
-		body.Closed = closed
-	}
+	body.Trait = trait
+	body.Closed = closed
 	return body
 }
 
+func (p *Parser) traitState() (closed bool) {
+	state := p.identifier()
+	if state == nil {
+		return false
+	}
+	if state.Name != "open" && state.Name != "closed" {
+		p.error(NewParseError(state.NamePos, state.NameEnd, fmt.Errorf("expected \"open\" or \"closed\" for trait")))
+	}
+	p.expect(token.CloseParen)
+	return state.Name == "closed"
+}
+
 func (p *Parser) traitBody() *ast.TraitExpr {
 	var traits []ast.Expr
 	var members []*ast.Binding
+	var lparen, rbrace token.Pos
 
-	if p.accept(token.OpenParen) != nil {
+	if t := p.accept(token.OpenParen); t != nil {
+		lparen = t.Pos
 		for p.t != nil {
 			if p.accept(token.CloseParen) != nil {
 				break
@@ -495,9 +592,10 @@ func (p *Parser) traitBody() *ast.TraitExpr {
 		}
 	}
 
-	p.expect(token.OpenBrace)
+	lbrace := pos(p.expect(token.OpenBrace))
 	for p.t != nil {
-		if p.accept(token.CloseBrace) != nil {
+		if t := p.accept(token.CloseBrace); t != nil {
+			rbrace = t.Pos
 			break
 		}
 		binding := p.binding()
@@ -506,85 +604,130 @@ func (p *Parser) traitBody() *ast.TraitExpr {
 		}
 	}
 
-	return &ast.TraitExpr{Traits: traits, Members: members}
+	return &ast.TraitExpr{
+		Lparen:  lparen,
+		Traits:  traits,
+		Lbrace:  lbrace,
+		Members: members,
+		Rbrace:  rbrace,
+	}
 }
 
 func (p *Parser) structExpr() *ast.StructExpr {
-	p.expect(token.Struct)
-	members := p.fields()
-	return &ast.StructExpr{Members: members}
+	structPos := pos(p.expect(token.Struct))
+	expr := p.fields()
+	expr.Struct = structPos
+	return expr
+}
+
+func (p *Parser) unionExpr() *ast.UnionExpr {
+	union := pos(p.expect(token.Union))
+	fields := p.fields()
+	return &ast.UnionExpr{
+		Union:   union,
+		Lparen:  fields.Lparen,
+		Members: fields.Members,
+		Rparen:  fields.Rparen,
+	}
 }
 
-func (p *Parser) fields() []*ast.Field {
+func (p *Parser) fields() *ast.StructExpr {
 	var fields []*ast.Field
-	p.expect(token.OpenParen)
+	var rparen token.Pos
+	lparen := pos(p.expect(token.OpenParen))
 	for p.t != nil {
-		if p.accept(token.CloseParen) != nil {
+		if t := p.accept(token.CloseParen); t != nil {
+			rparen = t.Pos
 			break
 		}
 		fields = append(fields, p.field())
-		if p.accept(token.CloseParen) != nil {
+		if t := p.accept(token.CloseParen); t != nil {
+			rparen = t.Pos
 			break
 		}
 		p.expect(token.Comma)
 	}
-	return fields
+	return &ast.StructExpr{Lparen: lparen, Members: fields, Rparen: rparen}
 }
 
 func (p *Parser) field() *ast.Field {
 	name := p.identifier()
 	p.expect(token.Colon)
-	typ := p.expr()
+	typ := p.expr2(nil, token.PrecedenceAssignment)
+
+	var def ast.Expr
+	if p.accept(token.Assign) != nil {
+		def = p.expr()
+	}
+
 	return &ast.Field{
-		Name: name,
-		Type: typ,
+		Name:    name,
+		Type:    typ,
+		Default: def,
 	}
 }
 
 func (p *Parser) ifExpr() *ast.IfExpr {
-	p.expect(token.If)
+	ifPos := pos(p.expect(token.If))
 	cond := p.expr()
 	body := p.blockExpr()
 
-	return &ast.IfExpr{Cond: cond, Block: body}
+	return &ast.IfExpr{If: ifPos, Cond: cond, Block: body}
+}
+
+func (p *Parser) whileExpr() *ast.WhileExpr {
+	whilePos := pos(p.expect(token.While))
+	cond := p.expr()
+	body := p.blockExpr()
+
+	return &ast.WhileExpr{While: whilePos, Cond: cond, Block: body}
 }
 
 func (p *Parser) sliceOrManyPointer() ast.Expr {
 	var manyPointer bool
+	var length ast.Expr
 	var base ast.Expr
 
-	p.expect(token.OpenBracket)
-	switch p.t.Type {
+	lbrack := pos(p.expect(token.OpenBracket))
+	switch p.peekNext() {
 	case token.Asterisk:
 		p.next()
 		p.expect(token.CloseBracket)
 		manyPointer = true
 	case token.CloseBracket:
 		p.next()
+	default:
+		length = p.expr()
+		p.expect(token.CloseBracket)
 	}
 
 	base = p.unaryOperand()
 
-	if manyPointer {
-		return &ast.ManyPointerExpr{Base: base}
-	} else {
-		return &ast.SliceExpr{Base: base}
+	switch {
+	case manyPointer:
+		return &ast.ManyPointerExpr{Lbrack: lbrack, Base: base}
+	case length != nil:
+		return &ast.ArrayExpr{Lbrack: lbrack, Len: length, Base: base}
+	default:
+		return &ast.SliceExpr{Lbrack: lbrack, Base: base}
 	}
 }
 
 func (p *Parser) integer() *ast.Literal {
 	tok := p.expect(token.Integer)
 	return &ast.Literal{
-		Tok:   token.Integer,
-		Value: tok.Text,
+		ValuePos: tok.Pos,
+		Tok:      token.Integer,
+		Value:    tok.Text,
 	}
 }
 
 func (p *Parser) string() *ast.Literal {
 	tok := p.expect(token.String)
 	return &ast.Literal{
-		Tok:   token.String,
-		Value: tok.Text,
+		ValuePos: tok.Pos,
+		Tok:      token.String,
+		Value:    tok.Text,
 	}
 }
 
@@ -630,18 +773,46 @@ func (p *Parser) accept(tok token.Type) *token.Token {
 }
 
 func (p *Parser) next() {
-	t, err := p.scn.Scan()
-	if err != nil {
-		if errors.Is(err, io.EOF) {
+	if p.t != nil {
+		p.prev = p.t
+	}
+	for {
+		t, err := p.scn.Scan()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				p.error(err)
+			}
 			p.t = nil
 			return
 		}
-		panic(err)
+		if p.mode&Trivia != 0 {
+			p.tokens = append(p.tokens, t)
+		}
+		if t.Type != token.Comment && t.Type != token.Whitespace {
+			p.t = t
+			return
+		}
 	}
-	p.t = t
-	if p.t.Type == token.Comment {
-		p.next()
+}
+
+// pos returns the position of the current token, or NoPos at EOF.
+func (p *Parser) pos() token.Pos {
+	return pos(p.t)
+}
+
+// prevEnd returns the end of the last token consumed by the parser.
+func (p *Parser) prevEnd() token.Pos {
+	if p.prev == nil {
+		return token.NoPos
+	}
+	return p.prev.End
+}
+
+func pos(t *token.Token) token.Pos {
+	if t == nil {
+		return token.NoPos
 	}
+	return t.Pos
 }
 
 func (p *Parser) unexpected(expected string) {
@@ -685,10 +856,25 @@ func New(scn Scanner) *Parser {
 	return &Parser{scn: scn}
 }
 
+// NewWithMode returns a parser that reads from scn. In Trivia mode scn
+// should also report white space, such as a scanner created with
+// scanner.ScanWhitespace.
+func NewWithMode(scn Scanner, mode Mode) *Parser {
+	return &Parser{scn: scn, mode: mode}
+}
+
 func NewFromReader(rd io.Reader) *Parser {
 	return New(scanner.New(rd))
 }
 
+func NewFromReaderWithMode(rd io.Reader, mode Mode) *Parser {
+	var scnMode scanner.Mode
+	if mode&Trivia != 0 {
+		scnMode |= scanner.ScanWhitespace
+	}
+	return NewWithMode(scanner.NewWithMode(rd, scnMode), mode)
+}
+
 func ParseBytes(name string, src []byte) (*ast.Module, error) {
 	return NewFromReader(bytes.NewReader(src)).Parse(name)
 }
@@ -2,9 +2,13 @@ package parser
 
 import (
 	"bytes"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
+	"codeberg.org/rileyq/usagi/internal/compile/ast"
 	"codeberg.org/rileyq/usagi/internal/compile/ast/printer"
+	"codeberg.org/rileyq/usagi/internal/compile/token"
 )
 
 const src = `
@@ -15,6 +19,14 @@ struct TwoInts (
 	b: i32,
 );
 
+newtype Meters = u32;
+
+struct Options(width: u32 = 80, verbose: bool = false);
+
+func pad(s: [*]u8, width: u32 = 8) void {}
+
+const Word = union(bytes: [4]u8, value: u32);
+
 const Type = trait(closed) {};
 
 trait(closed) Type {}
@@ -56,6 +68,9 @@ const add: func(arg: TwoInts) i32 = func(arg: TwoInts) i32 {
 
 func main() void {
 	std.print(add(TwoInts(a: 1, b: 2)));
+	while true {
+		break;
+	}
 }
 `
 
@@ -71,3 +86,40 @@ func TestParser(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestUnaryPrecedence(t *testing.T) {
+	module, err := ParseBytes("main", []byte("const x = !f(1).a == -y;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmp, isBinary := module.Decls[0].(*ast.Binding).Value.(*ast.BinaryExpr)
+	if !isBinary || cmp.Op != token.Equal {
+		t.Fatalf("got %#v, want a comparison", module.Decls[0].(*ast.Binding).Value)
+	}
+	not, isUnary := cmp.Left.(*ast.UnaryExpr)
+	if !isUnary {
+		t.Fatalf("got %#v, want !f(1).a", cmp.Left)
+	}
+	if _, isMember := not.Base.(*ast.MemberExpr); !isMember {
+		t.Errorf("! applies to %#v, want f(1).a", not.Base)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add([]byte(src))
+	f.Fuzz(func(t *testing.T, src []byte) {
+		p := NewFromReaderWithMode(bytes.NewReader(src), Trivia)
+		_, err := p.Parse("main")
+		if err != nil || !utf8.Valid(src) {
+			return
+		}
+
+		var b strings.Builder
+		for _, tok := range p.Tokens() {
+			b.WriteString(tok.Text)
+		}
+		if b.String() != string(src) {
+			t.Errorf("tokens do not reproduce the source:\n%s", b.String())
+		}
+	})
+}
@@ -9,18 +9,33 @@ import (
 	"codeberg.org/rileyq/usagi/internal/compile/token"
 )
 
+type Mode uint
+
+const (
+	// ScanWhitespace reports runs of white space as token.Whitespace
+	// instead of skipping them.
+	ScanWhitespace Mode = 1 << iota
+)
+
 type Scanner struct {
-	rd *runeScanner
+	rd   *runeScanner
+	mode Mode
 }
 
 func New(rd io.Reader) *Scanner {
-	return &Scanner{rd: newRuneScanner(bufio.NewReader(rd))}
+	return NewWithMode(rd, 0)
+}
+
+func NewWithMode(rd io.Reader, mode Mode) *Scanner {
+	return &Scanner{rd: newRuneScanner(bufio.NewReader(rd)), mode: mode}
 }
 
 func (s *Scanner) Scan() (*token.Token, error) {
-	err := s.skipSpace()
-	if err != nil {
-		return nil, err
+	if s.mode&ScanWhitespace == 0 {
+		err := s.skipSpace()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	s.rd.Begin()
@@ -30,7 +45,9 @@ func (s *Scanner) Scan() (*token.Token, error) {
 		return nil, err
 	}
 
-	if isIdentifierStart(r) {
+	if unicode.IsSpace(r) {
+		return s.whitespace()
+	} else if isIdentifierStart(r) {
 		return s.identifier()
 	} else if r == '"' {
 		return s.string()
@@ -39,18 +56,16 @@ func (s *Scanner) Scan() (*token.Token, error) {
 	} else if r == '/' {
 		r, err = s.next()
 		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return s.token(token.Invalid), nil
+			}
 			return nil, err
 		}
 		if r == '/' {
-			for r != '\n' {
-				r, err = s.next()
-				if err != nil {
-					return nil, err
-				}
-			}
-			return s.token(token.Comment), nil
+			return s.comment()
 		}
-		panic("TODO")
+		s.rewind()
+		return s.token(token.Invalid), nil
 	}
 
 	node := token.Fixed
@@ -75,6 +90,42 @@ retry:
 	return s.token(node.Type), nil
 }
 
+func (s *Scanner) whitespace() (*token.Token, error) {
+	for {
+		r, err := s.next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if !unicode.IsSpace(r) {
+			s.rewind()
+			break
+		}
+	}
+
+	return s.token(token.Whitespace), nil
+}
+
+func (s *Scanner) comment() (*token.Token, error) {
+	for {
+		r, err := s.next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if r == '\n' {
+			s.rewind()
+			break
+		}
+	}
+
+	return s.token(token.Comment), nil
+}
+
 func (s *Scanner) integer() (*token.Token, error) {
 	var r rune
 	var err error
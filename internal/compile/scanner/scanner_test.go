@@ -5,6 +5,9 @@ import (
 	"errors"
 	"io"
 	"testing"
+	"unicode/utf8"
+
+	"codeberg.org/rileyq/usagi/internal/compile/token"
 )
 
 const src = `
@@ -31,3 +34,43 @@ func TestScanner(t *testing.T) {
 		t.Logf("%#v", tok)
 	}
 }
+
+func TestOperators(t *testing.T) {
+	scn := New(bytes.NewReader([]byte("a<=b==c!=!d>e>=f<g=h")))
+	want := []token.Type{
+		token.Identifier, token.LessEqual, token.Identifier, token.Equal, token.Identifier,
+		token.NotEqual, token.Bang, token.Identifier, token.Greater, token.Identifier,
+		token.GreaterEqual, token.Identifier, token.Less, token.Identifier, token.Assign,
+		token.Identifier,
+	}
+	for i, typ := range want {
+		tok, err := scn.Scan()
+		if err != nil {
+			t.Fatalf("token %d: %v", i, err)
+		}
+		if tok.Type != typ {
+			t.Errorf("token %d: got %s, want %s", i, tok.Type, typ)
+		}
+	}
+}
+
+func FuzzScan(f *testing.F) {
+	f.Add([]byte(src))
+	f.Fuzz(func(t *testing.T, src []byte) {
+		scn := NewWithMode(bytes.NewReader(src), ScanWhitespace)
+		end := token.Pos(1)
+		for {
+			tok, err := scn.Scan()
+			if err != nil {
+				return
+			}
+			if tok.Pos != end {
+				t.Fatalf("token %#v does not start at the end of the previous token (%d)", tok, end)
+			}
+			if utf8.Valid(src) && string(src[tok.Pos-1:tok.End-1]) != tok.Text {
+				t.Fatalf("token %#v does not match its source %q", tok, src[tok.Pos-1:tok.End-1])
+			}
+			end = tok.End
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package semantics
+
+import (
+	"fmt"
+	"math/big"
+
+	"codeberg.org/rileyq/usagi/internal/compile/token"
+)
+
+// defaultIntegerType is the type given to untyped constants that are not
+// converted by their context, such as the value of `let x = 1;`.
+var defaultIntegerType = NewIntegerType(true, 32)
+
+func isUntyped(tv *TypeAndValue) bool {
+	_, untyped := tv.Type().(*UntypedIntegerType)
+	return untyped
+}
+
+// isConstant reports whether v is an integer or bool constant.
+func isConstant(v Value) bool {
+	switch v.(type) {
+	case *IntegerLiteral, *BoolLiteral:
+		return true
+	default:
+		return false
+	}
+}
+
+// cInt is the type C's int, which variadic arguments are promoted to.
+var cInt = NewIntegerType(true, 32)
+
+// isCString reports whether typ is [*]u8, which string literals can be
+// assigned to.
+func isCString(typ Type) bool {
+	p, isPointer := Underlying(typ).(*Pointer)
+	return isPointer && p.many && p.element.Equal(NewIntegerType(false, 8))
+}
+
+func isBool(typ Type) bool {
+	_, isBool := Underlying(typ).(*BoolType)
+	return isBool
+}
+
+func isInteger(typ Type) bool {
+	switch Underlying(typ).(type) {
+	case *IntegerType, *UntypedIntegerType:
+		return true
+	default:
+		return false
+	}
+}
+
+// convertInteger returns the constant v with type typ, or an error if typ
+// cannot represent it.
+func convertInteger(v *IntegerLiteral, typ *IntegerType) (*IntegerLiteral, error) {
+	if !typ.Representable(v.Value()) {
+		return nil, fmt.Errorf("constant %s overflows %s", v, typ)
+	}
+	return NewTypedIntegerLiteral(v.Value(), typ), nil
+}
+
+// isComparison reports whether op compares its operands, resulting in a
+// bool.
+func isComparison(op token.Type) bool {
+	switch op {
+	case token.Less, token.LessEqual, token.Greater, token.GreaterEqual, token.Equal, token.NotEqual:
+		return true
+	default:
+		return false
+	}
+}
+
+// compare applies the comparison operator op to constants of the same
+// type, which are either both integers or both bools.
+func compare(op token.Type, l, r Value) *BoolLiteral {
+	var c int
+	switch l := l.(type) {
+	case *IntegerLiteral:
+		c = l.Value().Cmp(r.(*IntegerLiteral).Value())
+	case *BoolLiteral:
+		if l.Value() != r.(*BoolLiteral).Value() {
+			c = 1
+		}
+	default:
+		panic(fmt.Sprintf("unexpected comparison of %T", l))
+	}
+	switch op {
+	case token.Less:
+		return NewBoolLiteral(c < 0)
+	case token.LessEqual:
+		return NewBoolLiteral(c <= 0)
+	case token.Greater:
+		return NewBoolLiteral(c > 0)
+	case token.GreaterEqual:
+		return NewBoolLiteral(c >= 0)
+	case token.Equal:
+		return NewBoolLiteral(c == 0)
+	case token.NotEqual:
+		return NewBoolLiteral(c != 0)
+	default:
+		panic(fmt.Sprintf("unexpected comparison operator %s", op))
+	}
+}
+
+// foldBinary applies the arithmetic operator op to constants of the same
+// type.
+func foldBinary(op token.Type, l, r *IntegerLiteral) (*IntegerLiteral, error) {
+	result := new(big.Int)
+	switch op {
+	case token.Plus:
+		result.Add(l.Value(), r.Value())
+	case token.Minus:
+		result.Sub(l.Value(), r.Value())
+	default:
+		panic(fmt.Sprintf("unexpected integer operator %s", op))
+	}
+	if l.typ != nil && !l.typ.Representable(result) {
+		return nil, fmt.Errorf("%s %s %s overflows %s", l, op, r, l.typ)
+	}
+	return &IntegerLiteral{result, l.typ}, nil
+}
+
+// negate returns the negation of the constant v.
+func negate(v *IntegerLiteral) (*IntegerLiteral, error) {
+	result := new(big.Int).Neg(v.Value())
+	if v.typ != nil && !v.typ.Representable(result) {
+		return nil, fmt.Errorf("-%s overflows %s", v, v.typ)
+	}
+	return &IntegerLiteral{result, v.typ}, nil
+}
+
+// unifyIntegers gives an untyped operand the type of the other operand.
+func unifyIntegers(l, r *IntegerLiteral) (*IntegerLiteral, *IntegerLiteral, error) {
+	var err error
+	switch {
+	case l.typ == nil && r.typ != nil:
+		l, err = convertInteger(l, r.typ)
+	case l.typ != nil && r.typ == nil:
+		r, err = convertInteger(r, l.typ)
+	}
+	return l, r, err
+}
+
+// convertConstant applies the conversion builtin id to the constant v.
+func convertConstant(id BuiltinID, to *IntegerType, v *IntegerLiteral) (*IntegerLiteral, error) {
+	switch id {
+	case BuiltinAs, BuiltinIntCast:
+		return convertInteger(v, to)
+	case BuiltinTruncate:
+		return NewTypedIntegerLiteral(to.Wrap(v.Value()), to), nil
+	case BuiltinBitCast:
+		if err := conversionError(id, to, v.Type()); err != nil {
+			return nil, err
+		}
+		bits := NewIntegerType(false, v.typ.Bits()).Wrap(v.Value())
+		return NewTypedIntegerLiteral(to.Wrap(bits), to), nil
+	default:
+		panic(fmt.Sprintf("unexpected conversion builtin %s", id))
+	}
+}
+
+// conversionError reports why the conversion builtin id cannot convert a
+// value of type from to type to, or returns nil if it can. Named integer
+// types convert like their underlying types.
+func conversionError(id BuiltinID, to, from Type) error {
+	toInt := Underlying(to).(*IntegerType)
+	fromInt, isTyped := Underlying(from).(*IntegerType)
+	switch {
+	case !isInteger(from):
+		return fmt.Errorf("%s converts integers, not %s", id, from)
+	case id == BuiltinTruncate && isTyped && fromInt.Bits() < toInt.Bits():
+		return fmt.Errorf("cannot truncate %s to larger type %s", from, to)
+	case id == BuiltinBitCast && !isTyped:
+		return fmt.Errorf("cannot bit cast an untyped constant, use @as instead")
+	case id == BuiltinBitCast && fromInt.Bits() != toInt.Bits():
+		return fmt.Errorf("cannot bit cast %s to %s of a different size", from, to)
+	}
+	return nil
+}
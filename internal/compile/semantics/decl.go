@@ -0,0 +1,102 @@
+package semantics
+
+import (
+	"strings"
+
+	"codeberg.org/rileyq/usagi/internal/compile/ast"
+	"codeberg.org/rileyq/usagi/internal/compile/token"
+)
+
+type declState int
+
+const (
+	declUnresolved declState = iota
+	declResolving
+	declResolved
+)
+
+// declInfo tracks the resolution of a module-level binding.
+type declInfo struct {
+	binding *ast.Binding
+	sym     *symbol
+	state   declState
+}
+
+func (d *declInfo) String() string { return d.sym.Name() }
+
+// collect inserts a symbol for every binding in decls into the module
+// scope before any of them are checked, so that declarations may refer to
+// each other regardless of order.
+func (p *pass) collect(decls []ast.Decl) {
+	p.decls = map[*ast.Binding]*declInfo{}
+	p.declsBySymbol = map[Symbol]*declInfo{}
+	for _, decl := range decls {
+		b, isBinding := decl.(*ast.Binding)
+		if !isBinding {
+			continue
+		}
+		sym := NewSymbol(b.Name.Name, NewTypeAndValue(nil, nil))
+		sym.pos, sym.binding, sym.exported = b.Name.Pos(), b, b.Mode.Export()
+		d := &declInfo{binding: b, sym: sym}
+		p.decls[b] = d
+		p.declsBySymbol[sym] = d
+
+		if p.info != nil && p.info.Defs != nil {
+			p.info.Defs[b.Name] = sym
+		}
+		if p.scope.Insert(sym) != nil {
+			p.errorf(b.Name, "%s redeclared in this scope", b.Name.Name)
+		}
+	}
+}
+
+// declOf returns the module-level declaration of sym, or nil if sym is not
+// declared at module level in the module being checked.
+func (p *pass) declOf(sym Symbol) *declInfo {
+	return p.declsBySymbol[sym]
+}
+
+// resolve checks d if it has not been checked yet, reporting an
+// initialization cycle if d depends on itself.
+func (p *pass) resolve(d *declInfo) {
+	switch d.state {
+	case declResolved:
+		return
+	case declResolving:
+		// Named types are bound before their underlying types are
+		// checked, so referring to one while it is being resolved is not
+		// a cycle.
+		if d.binding.Token == token.Struct || d.binding.Token == token.Newtype {
+			return
+		}
+		for i, other := range p.path {
+			if other == d {
+				p.errorf(d.binding.Name, "initialization cycle: %s", cyclePath(p.path[i:], (*declInfo).String))
+				break
+			}
+		}
+		d.sym.tv.typ = Invalid
+		return
+	}
+
+	d.state = declResolving
+	p.path = append(p.path, d)
+
+	oldCur, oldReturnType := p.cur, p.returnType
+	p.cur, p.returnType = p.scope, nil
+	p.bindingValue(d.binding, d.sym)
+	p.cur, p.returnType = oldCur, oldReturnType
+
+	p.path = p.path[:len(p.path)-1]
+	d.state = declResolved
+}
+
+// cyclePath describes the cycle formed by path and its first element.
+func cyclePath[T any](path []T, name func(T) string) string {
+	names := make([]string, 0, len(path)+1)
+	for _, elem := range path {
+		names = append(names, name(elem))
+	}
+	names = append(names, name(path[0]))
+	return strings.Join(names, " refers to ")
+}
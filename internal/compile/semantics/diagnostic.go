@@ -0,0 +1,98 @@
+package semantics
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"codeberg.org/rileyq/usagi/internal/compile/token"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		panic(fmt.Sprintf("unexpected semantics.Severity: %#v", s))
+	}
+}
+
+// A Diagnostic is a problem found by the checker in the range [Pos, End)
+// of the module being checked.
+type Diagnostic struct {
+	Pos, End token.Pos
+	Severity Severity
+	Message  string
+	// Notes give additional context, such as the calls being evaluated
+	// when compile-time evaluation failed.
+	Notes []*Note
+}
+
+type Note struct {
+	Pos, End token.Pos
+	// Module is the name of the module the range is in, if it is not the
+	// module being checked, as when evaluating an imported function.
+	Module  string
+	Message string
+}
+
+func (d *Diagnostic) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d-%d: %s: %s", d.Pos, d.End, d.Severity, d.Message)
+	for _, note := range d.Notes {
+		b.WriteString("\n\t")
+		if note.Module != "" {
+			fmt.Fprintf(&b, "%s:", note.Module)
+		}
+		fmt.Fprintf(&b, "%d-%d: %s", note.Pos, note.End, note.Message)
+	}
+	return b.String()
+}
+
+// Diagnostics is the error returned by Check when it reports at least one
+// error. It holds every diagnostic reported, ordered by position.
+type Diagnostics []*Diagnostic
+
+// Error formats the errors in diags. Warnings are left out so that they
+// do not obscure why the check failed.
+func (diags Diagnostics) Error() string {
+	messages := make([]string, 0, len(diags))
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			messages = append(messages, d.Error())
+		}
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (diags Diagnostics) HasErrors() bool {
+	return slices.ContainsFunc(diags, func(d *Diagnostic) bool {
+		return d.Severity == SeverityError
+	})
+}
+
+// errorCount returns the number of errors in diags.
+func (diags Diagnostics) errorCount() int {
+	n := 0
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			n++
+		}
+	}
+	return n
+}
+
+func (diags Diagnostics) sort() {
+	slices.SortStableFunc(diags, func(a, b *Diagnostic) int {
+		return int(a.Pos - b.Pos)
+	})
+}
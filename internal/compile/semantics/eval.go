@@ -0,0 +1,713 @@
+package semantics
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"codeberg.org/rileyq/usagi/internal/compile/ast"
+	"codeberg.org/rileyq/usagi/internal/compile/token"
+)
+
+const (
+	defaultEvalSteps = 1_000_000
+	defaultEvalDepth = 1_000
+)
+
+// An evaluator interprets expressions at compile time. Names not bound by
+// the evaluator itself are looked up in the scope of the function being
+// evaluated, resolving module-level declarations on demand.
+type evaluator struct {
+	p        *pass
+	steps    int
+	maxSteps int
+	maxDepth int
+	frames   []*evalFrame
+}
+
+type evalFrame struct {
+	fn    *Function
+	call  *ast.CallExpr
+	args  []Value
+	scope *Scope
+}
+
+// env holds the local variables of a block being evaluated.
+type env struct {
+	parent *env
+	vars   map[string]*variable
+}
+
+type variable struct {
+	value Value
+	// typ is the type of the variable, or nil if it takes the type of its
+	// value.
+	typ Type
+}
+
+func newEnv(parent *env) *env {
+	return &env{parent: parent, vars: map[string]*variable{}}
+}
+
+func (e *env) lookup(name string) *variable {
+	for ; e != nil; e = e.parent {
+		if v, found := e.vars[name]; found {
+			return v
+		}
+	}
+	return nil
+}
+
+// evalError is a failed evaluation along with the calls that led to it,
+// innermost first.
+type evalError struct {
+	node  ast.Node
+	msg   string
+	trace []*Note
+}
+
+func (err *evalError) Error() string { return err.msg }
+
+// errInvalid stops evaluation of expressions depending on declarations
+// that failed to check, which have already been reported.
+var errInvalid = errors.New("invalid operand")
+
+// returnSignal unwinds evaluation to the innermost call when a return
+// expression is evaluated.
+type returnSignal struct {
+	value Value
+}
+
+func (*returnSignal) Error() string { return "return outside of a function" }
+
+// breakSignal unwinds evaluation to the innermost while loop when a break
+// expression is evaluated.
+type breakSignal struct{}
+
+func (*breakSignal) Error() string { return "break outside of a loop" }
+
+func (p *pass) newEvaluator() *evaluator {
+	e := &evaluator{p: p, maxSteps: p.evalSteps, maxDepth: p.evalDepth}
+	if e.maxSteps <= 0 {
+		e.maxSteps = defaultEvalSteps
+	}
+	if e.maxDepth <= 0 {
+		e.maxDepth = defaultEvalDepth
+	}
+	return e
+}
+
+// constant evaluates the value of the module-level constant sym, reporting
+// an error with an evaluation trace if it cannot be evaluated.
+func (p *pass) constant(sym *symbol, expr ast.Expr) Value {
+	e := p.newEvaluator()
+	value, err := e.eval(expr, nil)
+	if err == nil {
+		value, err = e.convert(expr, value, sym.Type())
+	}
+	if err == nil {
+		return value
+	}
+	if errors.Is(err, errInvalid) {
+		return nil
+	}
+
+	var evalErr *evalError
+	if !errors.As(err, &evalErr) {
+		panic(err)
+	}
+	p.diags = append(p.diags, &Diagnostic{
+		Pos:      expr.Pos(),
+		End:      expr.End(),
+		Severity: SeverityError,
+		Message:  fmt.Sprintf("cannot evaluate %s at compile time: %s", sym.Name(), evalErr.msg),
+		Notes:    evalErr.trace,
+	})
+	return nil
+}
+
+func (e *evaluator) errorf(node ast.Node, format string, args ...any) error {
+	err := &evalError{node: node, msg: fmt.Sprintf(format, args...)}
+	if len(e.frames) > 0 {
+		err.trace = append(err.trace, &Note{
+			Pos:     node.Pos(),
+			End:     node.End(),
+			Module:  e.noteModule(len(e.frames) - 1),
+			Message: fmt.Sprintf("while evaluating %s", describe(node)),
+		})
+	}
+	err.trace = append(err.trace, e.callTrace()...)
+	return err
+}
+
+// The trace of a failed evaluation shows at most traceHead of the
+// innermost and traceTail of the outermost calls being evaluated.
+const (
+	traceHead = 5
+	traceTail = 5
+)
+
+// callTrace returns a note for each call being evaluated, innermost first.
+// Runs of identical calls, as in unbounded recursion, share a note, and
+// the calls in the middle of a long trace are summarized by one.
+func (e *evaluator) callTrace() []*Note {
+	var notes []*Note
+	var counts []int
+	for i, frame := range slices.Backward(e.frames) {
+		note := &Note{
+			Pos:     frame.call.Pos(),
+			End:     frame.call.End(),
+			Module:  e.noteModule(i - 1),
+			Message: fmt.Sprintf("in call to %s", frame),
+		}
+		if n := len(notes); n > 0 && *notes[n-1] == *note {
+			counts[n-1]++
+			continue
+		}
+		notes = append(notes, note)
+		counts = append(counts, 1)
+	}
+	for i, note := range notes {
+		if counts[i] > 1 {
+			note.Message = fmt.Sprintf("%s (repeated %d times)", note.Message, counts[i])
+		}
+	}
+	if len(notes) <= traceHead+traceTail {
+		return notes
+	}
+	omitted := 0
+	for _, n := range counts[traceHead : len(notes)-traceTail] {
+		omitted += n
+	}
+	summary := &Note{
+		Pos:     notes[traceHead].Pos,
+		End:     notes[traceHead].End,
+		Message: fmt.Sprintf("... %d more calls", omitted),
+	}
+	return slices.Concat(notes[:traceHead], []*Note{summary}, notes[len(notes)-traceTail:])
+}
+
+// module returns the module whose code frame i evaluates, or the module
+// being checked for i < 0.
+func (e *evaluator) module(i int) *Module {
+	if i >= 0 {
+		if m := e.frames[i].fn.module(); m != nil {
+			return m
+		}
+	}
+	return e.p.scope.module
+}
+
+// noteModule returns the name of the module of frame i for a note about
+// its code, or "" if that is the module being checked.
+func (e *evaluator) noteModule(i int) string {
+	if m := e.module(i); m != e.p.scope.module {
+		return m.Name()
+	}
+	return ""
+}
+
+// types returns the types the checker recorded for the code being
+// evaluated. A function of an imported module is evaluated with the types
+// recorded when that module was checked.
+func (e *evaluator) types() map[ast.Expr]*TypeAndValue {
+	if m := e.module(len(e.frames) - 1); m != e.p.scope.module {
+		return m.types
+	}
+	return e.p.types
+}
+
+// callArgs returns the resolved arguments the checker recorded for call,
+// as for types.
+func (e *evaluator) callArgs(call *ast.CallExpr) ([]ast.Expr, bool) {
+	if m := e.module(len(e.frames) - 1); m != e.p.scope.module {
+		args, ok := m.callArgs[call]
+		return args, ok
+	}
+	args, ok := e.p.callArgs[call]
+	return args, ok
+}
+
+func (frame *evalFrame) String() string {
+	var b strings.Builder
+	b.WriteString(frame.fn.Name())
+	b.WriteByte('(')
+	for i, arg := range frame.args {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s: %s", frame.fn.Signature().Params()[i].Name(), valueString(arg))
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+func valueString(value Value) string {
+	if value == nil {
+		return "void"
+	}
+	if s, isString := value.(*StringLiteral); isString {
+		return strconv.Quote(s.Value())
+	}
+	return fmt.Sprint(value)
+}
+
+func (e *evaluator) scope() *Scope {
+	if len(e.frames) == 0 {
+		return e.p.scope
+	}
+	return e.frames[len(e.frames)-1].scope
+}
+
+func (e *evaluator) eval(expr ast.Expr, vars *env) (Value, error) {
+	e.steps++
+	if e.steps > e.maxSteps {
+		return nil, e.errorf(expr, "evaluation exceeded the limit of %d steps", e.maxSteps)
+	}
+
+	switch expr := expr.(type) {
+	case *ast.Literal:
+		switch expr.Tok {
+		case token.String:
+			value, err := strconv.Unquote(expr.Value)
+			if err != nil {
+				return nil, e.errorf(expr, "invalid string literal %s", expr.Value)
+			}
+			return NewStringLiteral(value), nil
+		case token.Integer:
+			value, err := NewIntegerLiteralFromString(expr.Value)
+			if err != nil {
+				return nil, e.errorf(expr, "%v", err)
+			}
+			return value, nil
+		}
+	case *ast.Identifier:
+		return e.identifier(expr, vars)
+	case *ast.BinaryExpr:
+		if expr.Op == token.Assign {
+			return e.assign(expr, vars)
+		}
+		left, err := e.eval(expr.Left, vars)
+		if err != nil {
+			return nil, err
+		}
+		right, err := e.eval(expr.Right, vars)
+		if err != nil {
+			return nil, err
+		}
+		if _, isBool := left.(*BoolLiteral); isBool && isComparison(expr.Op) {
+			if _, isBool := right.(*BoolLiteral); isBool {
+				return compare(expr.Op, left, right), nil
+			}
+		}
+		l, isLeftInt := left.(*IntegerLiteral)
+		r, isRightInt := right.(*IntegerLiteral)
+		if !isLeftInt || !isRightInt {
+			return nil, e.errorf(expr, "operator %s is not defined on %s and %s", expr.Op, valueString(left), valueString(right))
+		}
+		l, r, err = unifyIntegers(l, r)
+		if err != nil {
+			return nil, e.errorf(expr, "%v", err)
+		}
+		if isComparison(expr.Op) {
+			return compare(expr.Op, l, r), nil
+		}
+		result, err := foldBinary(expr.Op, l, r)
+		if err != nil {
+			return nil, e.errorf(expr, "%v", err)
+		}
+		return result, nil
+	case *ast.UnaryExpr:
+		base, err := e.eval(expr.Base, vars)
+		if err != nil {
+			return nil, err
+		}
+		if b, isBool := base.(*BoolLiteral); isBool && expr.Op == token.Bang {
+			return NewBoolLiteral(!b.Value()), nil
+		}
+		integer, isInteger := base.(*IntegerLiteral)
+		if expr.Op != token.Minus || !isInteger {
+			return nil, e.errorf(expr, "operator %s is not defined on %s", expr.Op, valueString(base))
+		}
+		result, err := negate(integer)
+		if err != nil {
+			return nil, e.errorf(expr, "%v", err)
+		}
+		return result, nil
+	case *ast.MemberExpr:
+		base, err := e.eval(expr.Base, vars)
+		if err != nil {
+			return nil, err
+		}
+		return e.member(expr, base)
+	case *ast.CallExpr:
+		return e.call(expr, vars)
+	case *ast.BlockExpr:
+		return nil, e.block(expr.List, newEnv(vars))
+	case *ast.IfExpr:
+		cond, err := e.condition(expr.Cond, vars)
+		if err != nil {
+			return nil, err
+		}
+		if cond {
+			return nil, e.block(expr.Block.List, newEnv(vars))
+		}
+		return nil, nil
+	case *ast.WhileExpr:
+		for {
+			cond, err := e.condition(expr.Cond, vars)
+			if err != nil {
+				return nil, err
+			}
+			if !cond {
+				return nil, nil
+			}
+			err = e.block(expr.Block.List, newEnv(vars))
+			var brk *breakSignal
+			if errors.As(err, &brk) {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	case *ast.ReturnExpr:
+		var value Value
+		if expr.Value != nil {
+			var err error
+			value, err = e.eval(expr.Value, vars)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, &returnSignal{value}
+	case *ast.BreakExpr:
+		return nil, &breakSignal{}
+	}
+
+	// Anything else the checker has already given a value, such as a type
+	// or an import, is constant.
+	if tv := e.constantValue(expr); tv != nil {
+		return tv, nil
+	}
+	return nil, e.errorf(expr, "%s cannot be evaluated at compile time", describe(expr))
+}
+
+// constantValue returns the value the checker found for expr, if any.
+func (e *evaluator) constantValue(expr ast.Expr) Value {
+	if tv := e.types()[expr]; tv != nil {
+		return tv.Value()
+	}
+	return nil
+}
+
+func (e *evaluator) condition(expr ast.Expr, vars *env) (bool, error) {
+	cond, err := e.eval(expr, vars)
+	if err != nil {
+		return false, err
+	}
+	b, isBool := cond.(*BoolLiteral)
+	if !isBool {
+		return false, e.errorf(expr, "condition %s is not a bool", valueString(cond))
+	}
+	return b.Value(), nil
+}
+
+func (e *evaluator) block(stmts []ast.Stmt, vars *env) error {
+	for _, stmt := range stmts {
+		var err error
+		switch stmt := stmt.(type) {
+		case *ast.ExprStmt:
+			_, err = e.eval(stmt.X, vars)
+		case *ast.DeclStmt:
+			err = e.decl(stmt.X, vars)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *evaluator) decl(decl ast.Decl, vars *env) error {
+	b, isBinding := decl.(*ast.Binding)
+	if !isBinding || (b.Token != token.Let && b.Token != token.Const) {
+		return e.errorf(decl, "%s cannot be evaluated at compile time", describe(decl))
+	}
+	v := &variable{typ: e.typeOf(b.Type)}
+	if b.Value != nil {
+		value, err := e.eval(b.Value, vars)
+		if err != nil {
+			return err
+		}
+		if lit, isInteger := value.(*IntegerLiteral); isInteger && lit.typ == nil && v.typ == nil && b.Token == token.Let {
+			v.typ = defaultIntegerType
+		}
+		v.value, err = e.convert(b.Value, value, v.typ)
+		if err != nil {
+			return err
+		}
+	}
+	vars.vars[b.Name.Name] = v
+	return nil
+}
+
+// typeOf returns the type denoted by the type expression expr, or nil if
+// there is none.
+func (e *evaluator) typeOf(expr ast.Expr) Type {
+	if expr == nil {
+		return nil
+	}
+	if typeValue, isType := e.constantValue(expr).(*TypeValue); isType {
+		return typeValue.Type()
+	}
+	return nil
+}
+
+// convert gives value the type typ of the location it is stored in.
+// Integers are checked to fit; the checker has ensured everything else is
+// assignable.
+func (e *evaluator) convert(node ast.Node, value Value, typ Type) (Value, error) {
+	lit, isInteger := value.(*IntegerLiteral)
+	to, isIntegerType := Underlying(typ).(*IntegerType)
+	if !isInteger || !isIntegerType {
+		return value, nil
+	}
+	if lit.typ == nil {
+		converted, err := convertInteger(lit, to)
+		if err != nil {
+			return nil, e.errorf(node, "%v", err)
+		}
+		return converted, nil
+	}
+	return NewTypedIntegerLiteral(lit.Value(), to), nil
+}
+
+func (e *evaluator) identifier(expr *ast.Identifier, vars *env) (Value, error) {
+	integer, err := e.p.integerType(expr.Name)
+	if err != nil {
+		return nil, e.errorf(expr, "%v", err)
+	}
+	if integer != nil {
+		return NewTypeValue(integer), nil
+	}
+	if v := vars.lookup(expr.Name); v != nil {
+		if v.value == nil {
+			return nil, e.errorf(expr, "%s is used before it is initialized", expr.Name)
+		}
+		return v.value, nil
+	}
+
+	sym := e.scope().Lookup(expr.Name)
+	if sym == nil {
+		return nil, e.errorf(expr, "undefined: %s", expr.Name)
+	}
+	if d := e.p.declOf(sym); d != nil {
+		e.p.resolve(d)
+	}
+	if isInvalid(sym.Type()) {
+		return nil, errInvalid
+	}
+	if sym.Value() == nil {
+		return nil, e.errorf(expr, "the value of %s is not known at compile time", expr.Name)
+	}
+	return sym.Value(), nil
+}
+
+func (e *evaluator) assign(expr *ast.BinaryExpr, vars *env) (Value, error) {
+	ident, isIdent := expr.Left.(*ast.Identifier)
+	if !isIdent {
+		return nil, e.errorf(expr.Left, "cannot assign to %s at compile time", describe(expr.Left))
+	}
+	v := vars.lookup(ident.Name)
+	if v == nil {
+		return nil, e.errorf(expr.Left, "cannot assign to %s at compile time", ident.Name)
+	}
+	value, err := e.eval(expr.Right, vars)
+	if err != nil {
+		return nil, err
+	}
+	v.value, err = e.convert(expr.Right, value, v.typ)
+	return nil, err
+}
+
+func (e *evaluator) member(expr *ast.MemberExpr, base Value) (Value, error) {
+	name := expr.Member.Name
+	switch base := base.(type) {
+	case *StructValue:
+		for i, member := range base.structType().Members() {
+			if member.Name() == name {
+				return base.fields[i], nil
+			}
+		}
+	case *TypeValue:
+		if named, isNamed := base.Type().(*Named); isNamed {
+			if method := named.Method(name); method != nil {
+				return method, nil
+			}
+		}
+	case *ModuleImport:
+		if sym := base.Module().LookupExport(name); sym != nil && sym.Value() != nil {
+			return sym.Value(), nil
+		}
+	}
+	return nil, e.errorf(expr, "%s cannot be evaluated at compile time", describe(expr))
+}
+
+func (e *evaluator) call(expr *ast.CallExpr, vars *env) (Value, error) {
+	base, err := e.eval(expr.Base, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	var params []*NameAndType
+	switch base := base.(type) {
+	case *Function:
+		params = base.Signature().Params()
+	case *TypeValue:
+		structType, isStruct := Underlying(base.Type()).(*StructType)
+		if !isStruct {
+			return nil, e.errorf(expr.Base, "cannot call %s", valueString(base))
+		}
+		params = structType.Members()
+	case *ExternalSymbol:
+		return nil, e.errorf(expr, "cannot call external function %s at compile time", base.Name())
+	case *Builtin:
+		return e.builtin(expr, base, vars)
+	default:
+		return nil, e.errorf(expr, "%s cannot be evaluated at compile time", describe(expr))
+	}
+
+	args, err := e.arguments(expr, params, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch base := base.(type) {
+	case *Function:
+		return e.callFunction(expr, base, args)
+	default:
+		return NewStructValue(base.(*TypeValue).Type(), args), nil
+	}
+}
+
+// arguments evaluates the arguments of call in parameter order, using the
+// default value of each parameter the call omits.
+func (e *evaluator) arguments(call *ast.CallExpr, params []*NameAndType, vars *env) ([]Value, error) {
+	resolved, ok := e.callArgs(call)
+	if !ok {
+		// The call is in a function body that has not been checked yet.
+		resolved = make([]ast.Expr, len(params))
+		for i, arg := range call.Args {
+			index := i
+			if named, isNamed := arg.(*ast.NamedArg); isNamed {
+				index = slices.IndexFunc(params, func(param *NameAndType) bool {
+					return param.Name() == named.Name.Name
+				})
+				arg = named.Value
+			}
+			if index < 0 || index >= len(resolved) {
+				return nil, e.errorf(arg, "unexpected argument %s", describe(arg))
+			}
+			resolved[index] = arg
+		}
+	}
+
+	args := make([]Value, len(params))
+	for i, arg := range resolved {
+		if arg == nil {
+			if args[i] = params[i].Default(); args[i] == nil {
+				return nil, e.errorf(call, "missing argument %s", params[i].Name())
+			}
+			continue
+		}
+		value, err := e.eval(arg, vars)
+		if err != nil {
+			return nil, err
+		}
+		args[i], err = e.convert(arg, value, params[i].Type())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+func (e *evaluator) callFunction(call *ast.CallExpr, fn *Function, args []Value) (Value, error) {
+	if fn.decl == nil || fn.decl.Body == nil {
+		return nil, e.errorf(call, "%s has no body to evaluate", fn.Name())
+	}
+	// Evaluation relies on the types the checker records, so the body
+	// is checked first if its check was delayed. The bodies of imported
+	// modules were checked along with them, if at all.
+	if m := fn.module(); m != nil && m != e.p.scope.module {
+		if !m.funcBodies {
+			return nil, e.errorf(call, "%s cannot be evaluated, as module %s was checked without function bodies", fn.Name(), m.Name())
+		}
+	} else {
+		switch e.p.checkBody(fn.decl) {
+		case bodyChecking:
+			return nil, e.errorf(call, "%s is called while its body is being checked", fn.Name())
+		case bodyInvalid:
+			return nil, errInvalid
+		}
+	}
+	if len(e.frames) >= e.maxDepth {
+		return nil, e.errorf(call, "evaluation exceeded the maximum call depth of %d", e.maxDepth)
+	}
+
+	e.frames = append(e.frames, &evalFrame{fn: fn, call: call, args: args, scope: fn.scope})
+	defer func() { e.frames = e.frames[:len(e.frames)-1] }()
+
+	vars := newEnv(nil)
+	for i, param := range fn.Signature().Params() {
+		vars.vars[param.Name()] = &variable{args[i], param.Type()}
+	}
+
+	err := e.block(fn.decl.Body.List, vars)
+	var ret *returnSignal
+	if errors.As(err, &ret) {
+		return e.convert(call, ret.value, fn.Signature().ReturnType())
+	}
+	return nil, err
+}
+
+func (e *evaluator) builtin(call *ast.CallExpr, builtin *Builtin, vars *env) (Value, error) {
+	switch builtin.id {
+	case BuiltinAs, BuiltinIntCast, BuiltinTruncate, BuiltinBitCast:
+	default:
+		if value := e.constantValue(call); value != nil {
+			return value, nil
+		}
+		return nil, e.errorf(call, "%s cannot be evaluated at compile time", builtin)
+	}
+	if len(call.Args) != 2 {
+		return nil, e.errorf(call, "wrong number of arguments for %s: got %d, want 2", builtin, len(call.Args))
+	}
+
+	args := make([]Value, 0, len(call.Args))
+	for _, arg := range call.Args {
+		value, err := e.eval(arg, vars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	var to *IntegerType
+	if typeValue, isType := args[0].(*TypeValue); isType {
+		to, _ = Underlying(typeValue.Type()).(*IntegerType)
+	}
+	v, isInteger := args[1].(*IntegerLiteral)
+	if to == nil || !isInteger {
+		// The checker has already converted the value if it is not an
+		// integer.
+		return args[1], nil
+	}
+	converted, err := convertConstant(builtin.id, to, v)
+	if err != nil {
+		return nil, e.errorf(call, "%v", err)
+	}
+	return converted, nil
+}
@@ -0,0 +1,371 @@
+package semantics
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"codeberg.org/rileyq/usagi/internal/compile/ast"
+	"codeberg.org/rileyq/usagi/internal/compile/parser"
+)
+
+const evalSrc = `
+func sum(n: u32) u32 {
+	let total: u32 = 0;
+	let i: u32 = 0;
+	while i < n {
+		i = i + 1;
+		total = total + i;
+	}
+	return total;
+}
+
+func fib(n: u32) u32 {
+	if n < 2 {
+		return n;
+	}
+	return fib(n - 1) + fib(n - 2);
+}
+
+struct Pair(a: u32, b: u32);
+
+func swap(p: Pair) Pair {
+	return Pair(p.b, p.a);
+}
+
+const total = sum(10);
+const fib10 = fib(10);
+const swapped = swap(Pair(a: 1, b: 2));
+const first = swapped.a;
+const early = later + 1;
+const later = fib(5);
+
+func isPositive(n: i32) bool {
+	if n > 0 {
+		return true;
+	}
+	return false;
+}
+
+const positive = isPositive(5);
+const negative = !isPositive(-1) == true;
+const folded = 2 >= 3;
+
+struct Options(width: u32 = 80, verbose: bool = false);
+
+func offset(x: u32, by: u32 = 2) u32 {
+	return x + by;
+}
+
+const defaulted = offset(40);
+const reordered = offset(by: 5, x: 1);
+const options = Options(verbose: true);
+
+func firstAbove(limit: u32) u32 {
+	let i: u32 = 0;
+	while true {
+		if i > limit {
+			break;
+		}
+		i = i + 1;
+	}
+	return i;
+}
+
+const above = firstAbove(3);
+`
+
+func checkSource(t *testing.T, src string, cfg CheckConfig) (*Module, error) {
+	t.Helper()
+	moduleAst, err := parser.ParseBytes("main", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Module = moduleAst
+	cfg.CheckFuncBodies = true
+	return Check(&cfg)
+}
+
+func TestEval(t *testing.T) {
+	module, err := checkSource(t, evalSrc, CheckConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"total":     "55",
+		"fib10":     "55",
+		"swapped":   "Pair(a: 2, b: 1)",
+		"first":     "2",
+		"early":     "6",
+		"positive":  "true",
+		"negative":  "true",
+		"folded":    "false",
+		"defaulted": "42",
+		"reordered": "6",
+		"options":   "Options(width: 80, verbose: true)",
+		"above":     "4",
+	}
+	for name, value := range want {
+		sym := module.Scope().Lookup(name)
+		if got := valueString(sym.Value()); got != value {
+			t.Errorf("%s = %s, want %s", name, got, value)
+		}
+	}
+}
+
+func TestConstantConversions(t *testing.T) {
+	const src = `
+const a = @truncate(u8, 511);
+const b = @bitCast(i8, @as(u8, 255));
+const c = @intCast(i16, @as(u8, 200));
+const d: u64 = 18446744073709551615;
+const e = -128;
+const f: i8 = e;
+const g = wrap(4660);
+const h = size();
+
+func size() u64 {
+	return @sizeOf(u32);
+}
+
+func wrap(x: u16) u8 {
+	return @truncate(u8, x);
+}
+`
+	module, err := checkSource(t, src, CheckConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"a": "u8 = 255",
+		"b": "i8 = -1",
+		"c": "i16 = 200",
+		"d": "u64 = 18446744073709551615",
+		"e": "untyped integer = -128",
+		"f": "i8 = -128",
+		"g": "u8 = 52",
+		"h": "u64 = 4",
+	}
+	for name, value := range want {
+		sym := module.Scope().Lookup(name)
+		if got := fmt.Sprintf("%s = %s", sym.Type(), valueString(sym.Value())); got != value {
+			t.Errorf("%s: got %s, want %s", name, got, value)
+		}
+		if lit := sym.Value().(*IntegerLiteral); !lit.Type().Equal(sym.Type()) {
+			t.Errorf("%s: value has type %s, want %s", name, lit.Type(), sym.Type())
+		}
+	}
+}
+
+// TestUncheckedConversions covers conversions the checker rejects, which
+// the evaluator must report rather than crash on.
+func TestUncheckedConversions(t *testing.T) {
+	moduleAst, err := parser.ParseBytes("main", []byte("const c = @as(u8);"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := moduleAst.Decls[0].(*ast.Binding).Value.(*ast.CallExpr)
+	_, err = (&pass{}).newEvaluator().builtin(call, NewBuiltin(BuiltinAs), nil)
+	var evalErr *evalError
+	if !errors.As(err, &evalErr) || evalErr.msg != "wrong number of arguments for @as: got 1, want 2" {
+		t.Errorf("got error %v, want wrong number of arguments", err)
+	}
+
+	_, err = convertConstant(BuiltinBitCast, NewIntegerType(false, 8), NewIntegerLiteral(big.NewInt(5)))
+	if err == nil || err.Error() != "cannot bit cast an untyped constant, use @as instead" {
+		t.Errorf("got error %v, want untyped constants to be rejected", err)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		src     string
+		cfg     CheckConfig
+		message string
+		trace   []string
+	}{
+		{
+			src: `
+func forever() u32 {
+	while 0 < 1 {}
+}
+const x = forever();
+`,
+			cfg:     CheckConfig{EvalSteps: 1000},
+			message: "cannot evaluate x at compile time: evaluation exceeded the limit of 1000 steps",
+			trace:   []string{"while evaluating", "in call to forever()"},
+		},
+		{
+			src: `
+func down(n: u32) u32 {
+	return down(n + 1);
+}
+const x = down(0);
+`,
+			cfg:     CheckConfig{EvalDepth: 3},
+			message: "evaluation exceeded the maximum call depth of 3",
+			trace: []string{
+				"while evaluating down(n + 1)",
+				"in call to down(n: 2)",
+				"in call to down(n: 1)",
+				"in call to down(n: 0)",
+			},
+		},
+		{
+			src: `
+func f() u32 {
+	return f();
+}
+const x = f();
+`,
+			message: "evaluation exceeded the maximum call depth of 1000",
+			trace: []string{
+				"while evaluating f()",
+				"in call to f() (repeated 999 times)",
+				"in call to f()",
+			},
+		},
+		{
+			src: `
+func down(n: u32) u32 {
+	return down(n + 1);
+}
+const x = down(0);
+`,
+			cfg:     CheckConfig{EvalDepth: 20},
+			message: "evaluation exceeded the maximum call depth of 20",
+			trace: []string{
+				"while evaluating down(n + 1)",
+				"in call to down(n: 19)",
+				"in call to down(n: 18)",
+				"in call to down(n: 17)",
+				"in call to down(n: 16)",
+				"in call to down(n: 15)",
+				"... 10 more calls",
+				"in call to down(n: 4)",
+				"in call to down(n: 3)",
+				"in call to down(n: 2)",
+				"in call to down(n: 1)",
+				"in call to down(n: 0)",
+			},
+		},
+		{
+			src: `
+const puts: func(s: [*]u8) i32 = @extern("puts");
+func outer(n: u32) i32 {
+	return puts("hi");
+}
+const x = outer(3);
+`,
+			message: "cannot call external function puts at compile time",
+			trace:   []string{`while evaluating puts("hi")`, "in call to outer(n: 3)"},
+		},
+		{
+			src: `
+func inc(x: u8) u8 {
+	return x + 1;
+}
+const x = inc(255);
+`,
+			message: "255 + 1 overflows u8",
+			trace:   []string{"while evaluating x + 1", "in call to inc(x: 255)"},
+		},
+	}
+
+	for _, test := range tests {
+		_, err := checkSource(t, test.src, test.cfg)
+		var diags Diagnostics
+		if !errors.As(err, &diags) || len(diags) != 1 {
+			t.Errorf("got error %v, want one diagnostic", err)
+			continue
+		}
+		d := diags[0]
+		if !strings.Contains(d.Message, test.message) {
+			t.Errorf("got message %q, want %q", d.Message, test.message)
+		}
+		if len(d.Notes) != len(test.trace) {
+			t.Errorf("got trace:\n%s\nwant %d notes", d, len(test.trace))
+			continue
+		}
+		for i, note := range d.Notes {
+			if !strings.HasPrefix(note.Message, test.trace[i]) {
+				t.Errorf("got note %q, want %q", note.Message, test.trace[i])
+			}
+		}
+	}
+}
+
+// TestEvalImported covers calls to functions of an imported module, which
+// are evaluated with the types recorded when that module was checked.
+func TestEvalImported(t *testing.T) {
+	const libSrc = `
+struct S(a: u32, b: u64);
+
+export func widen(x: u8) u32 {
+	const y: u32 = x;
+	return y + 1;
+}
+
+export func size() u64 {
+	return @sizeOf(S);
+}
+
+export func inc(x: u8) u8 {
+	return x + 1;
+}
+`
+	importer := &testImporter{}
+	_, lib, err := loadModule("lib", libSrc, nil, importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	importer.Add("lib", lib)
+
+	module, err := checkSource(t, `
+const lib = @import("lib");
+const b = lib.widen(255);
+const s = lib.size();
+`, CheckConfig{Importer: importer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{"b": "256", "s": "16"} {
+		if got := valueString(module.Scope().Lookup(name).Value()); got != value {
+			t.Errorf("%s = %s, want %s", name, got, value)
+		}
+	}
+
+	_, err = checkSource(t, `
+const lib = @import("lib");
+const x = lib.inc(255);
+`, CheckConfig{Importer: importer})
+	var diags Diagnostics
+	if !errors.As(err, &diags) || len(diags) != 1 {
+		t.Fatalf("got error %v, want one diagnostic", err)
+	}
+	if d := diags[0]; !strings.Contains(d.Message, "255 + 1 overflows u8") || len(d.Notes) != 2 ||
+		d.Notes[0].Module != "lib" || d.Notes[1].Module != "" {
+		t.Errorf("got diagnostic:\n%s\nwant the evaluated expression noted in lib", d)
+	}
+
+	libAst, err := parser.ParseBytes("lib", []byte(libSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shallow, err := Check(&CheckConfig{Module: libAst})
+	if err != nil {
+		t.Fatal(err)
+	}
+	importer.Add("lib", shallow)
+	_, err = checkSource(t, `
+const lib = @import("lib");
+const b = lib.widen(255);
+`, CheckConfig{Importer: importer})
+	if err == nil || !strings.Contains(err.Error(), "module lib was checked without function bodies") {
+		t.Errorf("got error %v, want the call to be rejected", err)
+	}
+}
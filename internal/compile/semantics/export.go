@@ -0,0 +1,676 @@
+package semantics
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"codeberg.org/rileyq/usagi/internal/compile/token"
+)
+
+// Export data is a compact binary encoding of the interface of a checked
+// module, from which modules importing it can be checked without its
+// source. It holds the exported symbols of the module with their types,
+// link names and constant values:
+//
+//	data   = magic version:uvarint count:uvarint dep* module
+//	dep    = name:string fingerprint:[32]byte
+//	module = name:string count:uvarint symbol*
+//	symbol = name:string linkName:string type value
+//
+// The dependencies are the modules imported by the module, with their
+// fingerprints when it was checked, from which importers can tell whether
+// the data is out of date.
+//
+// A type is written in full the first time it appears and as a reference
+// to that first occurrence after, so that shared and recursive types are
+// written once. Named types are identified by their module and name, so
+// that the readers of different export data share them. Function bodies
+// are not part of export data, so imported functions cannot be evaluated
+// at compile time.
+
+// ExportVersion is the version of the export data format written by
+// WriteExportData. Version 2 mangles link names as described in
+// mangle.go, version 3 adds the options of external symbols, version 4
+// the dependencies of the module, and version 5 separates and escapes the
+// identifiers of link names.
+const ExportVersion = 5
+
+const exportMagic = "\x00usagi"
+
+// ErrExportVersion is returned by ReadExportData for export data written
+// in a format version other than ExportVersion.
+var ErrExportVersion = errors.New("unsupported export data version")
+
+const (
+	tagTypeRef byte = iota
+	tagTypeInteger
+	tagTypeUntypedInt
+	tagTypeBool
+	tagTypeNever
+	tagTypePointer
+	tagTypeSignature
+	tagTypeSlice
+	tagTypeArray
+	tagTypeStruct
+	tagTypeUnion
+	tagTypeTrait
+	tagTypeNamed
+)
+
+const (
+	tagValueNone byte = iota
+	tagValueType
+	tagValueInteger
+	tagValueBool
+	tagValueString
+	tagValueStruct
+	tagValueExternal
+	tagValueFunction
+	tagValueBuiltin
+	tagValueModule
+)
+
+// WriteExportData writes the export data of m, which must have checked
+// without errors, to w.
+func WriteExportData(w io.Writer, m *Module) error {
+	data, err := exportData(m)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func exportData(m *Module) ([]byte, error) {
+	ew := &exportWriter{types: map[Type]int{}}
+	ew.buf.WriteString(exportMagic)
+	ew.uvarint(ExportVersion)
+	ew.uvarint(uint64(len(m.deps)))
+	for _, dep := range m.deps {
+		ew.string(dep.Name)
+		ew.buf.Write(dep.Fingerprint[:])
+	}
+	ew.module(m)
+	if ew.err != nil {
+		return nil, ew.err
+	}
+	return ew.buf.Bytes(), nil
+}
+
+// A Fingerprint is the hash of the export data of a module, which changes
+// whenever the interface of the module or of a module it imports does.
+type Fingerprint [sha256.Size]byte
+
+// A Dependency is a module imported by another, with the name it was
+// imported by and its fingerprint at the time.
+type Dependency struct {
+	Name        string
+	Fingerprint Fingerprint
+}
+
+// Dependencies returns the modules imported by m, in order of import.
+func (m *Module) Dependencies() []Dependency { return m.deps }
+
+// Fingerprint returns the fingerprint of m, or the zero Fingerprint if m
+// cannot be written as export data.
+func (m *Module) Fingerprint() Fingerprint {
+	m.fingerprintOnce.Do(func() {
+		if data, err := exportData(m); err == nil {
+			m.fingerprint = sha256.Sum256(data)
+		}
+	})
+	return m.fingerprint
+}
+
+type exportWriter struct {
+	buf   bytes.Buffer
+	types map[Type]int
+	// err is the first value that could not be encoded.
+	err error
+}
+
+func (w *exportWriter) uvarint(x uint64) {
+	w.buf.Write(binary.AppendUvarint(nil, x))
+}
+
+func (w *exportWriter) string(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *exportWriter) bool(b bool) {
+	if b {
+		w.buf.WriteByte(1)
+	} else {
+		w.buf.WriteByte(0)
+	}
+}
+
+func (w *exportWriter) module(m *Module) {
+	var exports []Symbol
+	for sym := range m.Exports() {
+		exports = append(exports, sym)
+	}
+	w.string(m.Name())
+	w.uvarint(uint64(len(exports)))
+	for _, sym := range exports {
+		w.string(sym.Name())
+		w.string(sym.LinkName())
+		w.typ(sym.Type())
+		w.value(sym.Value())
+	}
+}
+
+func (w *exportWriter) typ(typ Type) {
+	if i, found := w.types[typ]; found {
+		w.buf.WriteByte(tagTypeRef)
+		w.uvarint(uint64(i))
+		return
+	}
+	// The index is taken before the type's contents are written, as they
+	// may refer back to it.
+	w.types[typ] = len(w.types)
+
+	switch typ := typ.(type) {
+	case *IntegerType:
+		w.buf.WriteByte(tagTypeInteger)
+		w.intType(typ)
+	case *UntypedIntegerType:
+		w.buf.WriteByte(tagTypeUntypedInt)
+	case *BoolType:
+		w.buf.WriteByte(tagTypeBool)
+	case *NeverType:
+		w.buf.WriteByte(tagTypeNever)
+	case *Pointer:
+		w.buf.WriteByte(tagTypePointer)
+		w.bool(typ.many)
+		w.typ(typ.element)
+	case *Signature:
+		w.buf.WriteByte(tagTypeSignature)
+		w.params(typ.params)
+		w.typ(typ.returnType)
+		w.bool(typ.variadic)
+	case *SliceType:
+		w.buf.WriteByte(tagTypeSlice)
+		w.typ(typ.element)
+	case *ArrayType:
+		w.buf.WriteByte(tagTypeArray)
+		w.uvarint(uint64(typ.length))
+		w.typ(typ.element)
+	case *StructType:
+		w.buf.WriteByte(tagTypeStruct)
+		w.params(typ.members)
+	case *UnionType:
+		w.buf.WriteByte(tagTypeUnion)
+		w.params(typ.members)
+	case *TraitType:
+		w.buf.WriteByte(tagTypeTrait)
+		w.bool(typ.closed)
+		w.params(typ.requirements)
+	case *Named:
+		w.buf.WriteByte(tagTypeNamed)
+		w.string(typ.sym.Name())
+		var module string
+		if scope := typ.sym.Scope(); scope != nil && scope.Module() != nil {
+			module = scope.Module().Name()
+		}
+		w.string(module)
+		w.typ(typ.underlying)
+		w.uvarint(uint64(len(typ.methods)))
+		for _, method := range typ.methods {
+			w.string(method.name)
+			w.typ(method.sig)
+		}
+	default:
+		w.fail(fmt.Errorf("cannot export type %s", typ))
+	}
+}
+
+func (w *exportWriter) intType(typ *IntegerType) {
+	w.bool(typ.signed)
+	w.uvarint(uint64(typ.bits))
+}
+
+// params writes list, the parameters of a signature or the members of an
+// aggregate type.
+func (w *exportWriter) params(list []*NameAndType) {
+	w.uvarint(uint64(len(list)))
+	for _, nt := range list {
+		w.string(nt.name)
+		w.typ(nt.typ)
+		w.value(nt.def)
+	}
+}
+
+func (w *exportWriter) value(value Value) {
+	switch value := value.(type) {
+	case nil:
+		w.buf.WriteByte(tagValueNone)
+	case *TypeValue:
+		w.buf.WriteByte(tagValueType)
+		w.typ(value.typ)
+	case *IntegerLiteral:
+		w.buf.WriteByte(tagValueInteger)
+		w.bool(value.typ != nil)
+		if value.typ != nil {
+			w.intType(value.typ)
+		}
+		w.bool(value.Value().Sign() < 0)
+		abs := value.Value().Bytes()
+		w.uvarint(uint64(len(abs)))
+		w.buf.Write(abs)
+	case *BoolLiteral:
+		w.buf.WriteByte(tagValueBool)
+		w.bool(value.value)
+	case *StringLiteral:
+		w.buf.WriteByte(tagValueString)
+		w.string(value.value)
+	case *StructValue:
+		w.buf.WriteByte(tagValueStruct)
+		w.typ(value.typ)
+		w.uvarint(uint64(len(value.fields)))
+		for _, field := range value.fields {
+			w.value(field)
+		}
+	case *ExternalSymbol:
+		w.buf.WriteByte(tagValueExternal)
+		w.string(value.Name())
+		w.typ(value.Type())
+		opts := value.Options()
+		w.uvarint(uint64(opts.CallingConvention))
+		w.bool(opts.Weak)
+		w.bool(opts.ThreadLocal)
+		w.string(opts.Library)
+	case *Function:
+		w.buf.WriteByte(tagValueFunction)
+		w.string(value.name)
+		w.typ(value.sig)
+	case *Builtin:
+		w.buf.WriteByte(tagValueBuiltin)
+		w.uvarint(uint64(value.id))
+	case *ModuleImport:
+		w.buf.WriteByte(tagValueModule)
+		w.module(value.module)
+	default:
+		w.fail(fmt.Errorf("cannot export value %s", valueString(value)))
+	}
+}
+
+func (w *exportWriter) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// ReadExportData reads export data written by WriteExportData and returns
+// the module it describes. Only the exported symbols of the module are in
+// its scope.
+func ReadExportData(r io.Reader) (*Module, error) {
+	// The data is read in full so that a named type can be read again if
+	// it does not match the one read before.
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	er := &exportReader{r: bytes.NewReader(data), modules: map[string]*Module{}}
+
+	magic := make([]byte, len(exportMagic))
+	if _, err := io.ReadFull(er.r, magic); err != nil || string(magic) != exportMagic {
+		return nil, errors.New("not export data")
+	}
+	if version := er.uvarint(); er.err == nil && version != ExportVersion {
+		return nil, fmt.Errorf("%w %d, want %d", ErrExportVersion, version, ExportVersion)
+	}
+	deps := make([]Dependency, er.count())
+	for i := range deps {
+		deps[i].Name = er.string()
+		er.read(deps[i].Fingerprint[:])
+	}
+	m := er.module()
+	if er.err != nil {
+		return nil, fmt.Errorf("reading export data: %w", er.err)
+	}
+	m.deps = deps
+	m.fingerprintOnce.Do(func() { m.fingerprint = sha256.Sum256(data) })
+	return m, nil
+}
+
+type exportReader struct {
+	r     *bytes.Reader
+	types []Type
+	// modules maps names to the modules read so far and to stand-ins for
+	// the other modules declaring named types.
+	modules map[string]*Module
+	// err is the first error encountered. Once it is set, reads return
+	// zero values.
+	err error
+}
+
+func (r *exportReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *exportReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	b, err := r.r.ReadByte()
+	if err != nil {
+		r.fail(io.ErrUnexpectedEOF)
+	}
+	return b
+}
+
+func (r *exportReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	x, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		r.fail(io.ErrUnexpectedEOF)
+	}
+	return x
+}
+
+// count reads a length. It is limited so that corrupt data cannot make the
+// reader allocate too much.
+func (r *exportReader) count() int {
+	n := r.uvarint()
+	if n > 1<<24 {
+		r.fail(fmt.Errorf("invalid length %d", n))
+		return 0
+	}
+	return int(n)
+}
+
+func (r *exportReader) bytes() []byte {
+	b := make([]byte, r.count())
+	if r.err != nil {
+		return nil
+	}
+	r.read(b)
+	return b
+}
+
+// read fills b.
+func (r *exportReader) read(b []byte) {
+	if r.err != nil {
+		return
+	}
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		r.fail(io.ErrUnexpectedEOF)
+	}
+}
+
+func (r *exportReader) string() string { return string(r.bytes()) }
+
+func (r *exportReader) bool() bool { return r.byte() != 0 }
+
+func (r *exportReader) module() *Module {
+	m := r.moduleNamed(r.string())
+	for range r.count() {
+		name := r.string()
+		linkName := r.string()
+		typ := r.typ()
+		value := r.value()
+		if r.err != nil {
+			return nil
+		}
+
+		if m.scope.symbols[name] != nil {
+			r.fail(fmt.Errorf("%s redeclared in module %s", name, m.Name()))
+			return nil
+		}
+		// A named type declared by the module is bound to the symbol it
+		// was read with, which other export data may have been read with
+		// first. The symbol is complete once read, as the type may be
+		// shared with concurrent checks.
+		if named := declaredType(value, name, m); named != nil && named.sym.LinkName() == linkName {
+			m.scope.symbols[name] = named.sym
+			continue
+		}
+		sym := NewSymbol(name, NewTypeAndValue(typ, value))
+		sym.linkName, sym.exported = linkName, true
+		m.scope.Insert(sym)
+	}
+	return m
+}
+
+// declaredType returns the named type value is, if it is declared by m
+// with name.
+func declaredType(value Value, name string, m *Module) *Named {
+	tv, isType := value.(*TypeValue)
+	if !isType {
+		return nil
+	}
+	named, isNamed := tv.typ.(*Named)
+	if !isNamed || named.sym.Name() != name || named.sym.Scope().Module().Name() != m.Name() {
+		return nil
+	}
+	return named
+}
+
+// moduleNamed returns the module called name, creating it if it has not
+// been read.
+func (r *exportReader) moduleNamed(name string) *Module {
+	if m, found := r.modules[name]; found {
+		return m
+	}
+	scope := NewScope(Universe, token.NoPos, token.NoPos, fmt.Sprintf("module %q", name))
+	m := &Module{name: name, scope: scope}
+	scope.module = m
+	r.modules[name] = m
+	return m
+}
+
+func (r *exportReader) typ() Type {
+	tag := r.byte()
+	if r.err != nil {
+		return Invalid
+	}
+	if tag == tagTypeRef {
+		i := r.uvarint()
+		if i >= uint64(len(r.types)) || r.types[i] == nil {
+			r.fail(fmt.Errorf("invalid type reference %d", i))
+			return Invalid
+		}
+		return r.types[i]
+	}
+
+	// Only named types can refer to themselves, so every other type is
+	// stored once its contents have been read.
+	index := len(r.types)
+	r.types = append(r.types, nil)
+	var typ Type
+	switch tag {
+	case tagTypeInteger:
+		typ = r.intType()
+	case tagTypeUntypedInt:
+		typ = UntypedInt
+	case tagTypeBool:
+		typ = Bool
+	case tagTypeNever:
+		typ = Never
+	case tagTypePointer:
+		many := r.bool()
+		typ = newPointer(r.typ(), many)
+	case tagTypeSignature:
+		params := r.params()
+		returnType := r.typ()
+		typ = newSignature(params, returnType, r.bool())
+	case tagTypeSlice:
+		typ = NewSliceType(r.typ())
+	case tagTypeArray:
+		length := r.uvarint()
+		typ = NewArrayType(r.typ(), int64(length))
+	case tagTypeStruct:
+		typ = NewStructType(r.params())
+	case tagTypeUnion:
+		typ = NewUnionType(r.params())
+	case tagTypeTrait:
+		closed := r.bool()
+		typ = NewTraitType(closed, r.params())
+	case tagTypeNamed:
+		typ = r.named(index)
+	default:
+		r.fail(fmt.Errorf("invalid type tag %d", tag))
+		return Invalid
+	}
+	r.types[index] = typ
+	return typ
+}
+
+// named reads a named type, stored at index in r.types. A type read
+// before from any export data is used if it is declared in the same way,
+// so that it is the same type whichever module it is imported through.
+func (r *exportReader) named(index int) *Named {
+	name := r.string()
+	module := r.moduleNamed(r.string())
+	start := r.r.Size() - int64(r.r.Len())
+	if named := typeCtx.lookupNamed(module.Name(), name); named != nil {
+		r.types[index] = named
+		underlying, methods := r.namedContents(named)
+		if r.err != nil || sameNamed(named, underlying, methods) {
+			return named
+		}
+		// The type has changed since, so it is read again as a new type.
+		r.r.Seek(start, io.SeekStart)
+		r.types = r.types[:index+1]
+	}
+
+	named := NewNamed(nil, nil)
+	// The type is exported by its module, or is part of the interface of
+	// one that is exported.
+	sym := NewSymbol(name, NewTypeAndValue(named, NewTypeValue(named)))
+	sym.scope, sym.exported = module.scope, true
+	named.sym = sym
+	r.types[index] = named
+	named.underlying, named.methods = r.namedContents(named)
+	if r.err == nil {
+		typeCtx.addNamed(module.Name(), name, named)
+	}
+	return named
+}
+
+// namedContents reads the underlying type and methods of named.
+func (r *exportReader) namedContents(named *Named) (Type, []*Function) {
+	underlying := r.typ()
+	var methods []*Function
+	for range r.count() {
+		name := r.string()
+		sig, isSig := r.typ().(*Signature)
+		if !isSig {
+			r.fail(fmt.Errorf("method %s.%s is not a function", named, name))
+			break
+		}
+		methods = append(methods, NewFunction(name, sig, nil, nil))
+	}
+	return underlying, methods
+}
+
+// sameNamed reports whether named has the underlying type and methods.
+func sameNamed(named *Named, underlying Type, methods []*Function) bool {
+	if !identical(named.underlying, underlying) || len(named.methods) != len(methods) {
+		return false
+	}
+	for i, m := range methods {
+		if named.methods[i].name != m.name || !identical(named.methods[i].sig, m.sig) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *exportReader) intType() *IntegerType {
+	signed := r.bool()
+	return NewIntegerType(signed, int(r.uvarint()))
+}
+
+func (r *exportReader) params() []*NameAndType {
+	list := make([]*NameAndType, r.count())
+	for i := range list {
+		name := r.string()
+		typ := r.typ()
+		list[i] = &NameAndType{name: name, typ: typ, def: r.value()}
+	}
+	return list
+}
+
+func (r *exportReader) value() Value {
+	tag := r.byte()
+	if r.err != nil {
+		return nil
+	}
+	switch tag {
+	case tagValueNone:
+		return nil
+	case tagValueType:
+		return NewTypeValue(r.typ())
+	case tagValueInteger:
+		var typ *IntegerType
+		if r.bool() {
+			typ = r.intType()
+		}
+		negative := r.bool()
+		value := new(big.Int).SetBytes(r.bytes())
+		if negative {
+			value.Neg(value)
+		}
+		if typ == nil {
+			return NewIntegerLiteral(value)
+		}
+		return NewTypedIntegerLiteral(value, typ)
+	case tagValueBool:
+		return NewBoolLiteral(r.bool())
+	case tagValueString:
+		return NewStringLiteral(r.string())
+	case tagValueStruct:
+		typ := r.typ()
+		fields := make([]Value, r.count())
+		for i := range fields {
+			fields[i] = r.value()
+		}
+		return NewStructValue(typ, fields)
+	case tagValueExternal:
+		name := r.string()
+		typ := r.typ()
+		var opts ExternOptions
+		cc := r.uvarint()
+		if cc >= uint64(len(callingConventions)) {
+			r.fail(fmt.Errorf("invalid calling convention %d", cc))
+			return nil
+		}
+		opts.CallingConvention = CallingConvention(cc)
+		opts.Weak = r.bool()
+		opts.ThreadLocal = r.bool()
+		opts.Library = r.string()
+		return NewExternalSymbol(name, typ, opts)
+	case tagValueFunction:
+		name := r.string()
+		sig, isSig := r.typ().(*Signature)
+		if !isSig {
+			r.fail(fmt.Errorf("function %s has no signature", name))
+			return nil
+		}
+		return NewFunction(name, sig, nil, nil)
+	case tagValueBuiltin:
+		id := BuiltinID(r.uvarint())
+		if id <= 0 || id > BuiltinExport {
+			r.fail(fmt.Errorf("invalid builtin %d", id))
+			return nil
+		}
+		return NewBuiltin(id)
+	case tagValueModule:
+		return NewModuleImport(r.module())
+	default:
+		r.fail(fmt.Errorf("invalid value tag %d", tag))
+		return nil
+	}
+}
@@ -0,0 +1,179 @@
+package semantics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+const exportSrc = `
+export const answer: u32 = 42;
+export const negative = -7;
+export const enabled = true;
+export const Word = union(bytes: [4]u8, value: u32);
+export struct Node(next: [*]Node, value: i32);
+export struct Point(x: i32, y: i32 = 1);
+export newtype Meters = u32;
+export const origin = Point(x: 0, y: 0);
+export const puts: func(s: [*]u8, ...) i32 = @extern("puts");
+export const errno: i32 = @extern("errno", weak: true, threadLocal: true, library: "c");
+export const greet = @export("usagi_greet", func () void {});
+export func double(m: Meters) Meters {
+	return m + m;
+}
+impl Meters {
+	func half(m: Meters) Meters {
+		return m;
+	}
+}
+const hidden = 1;
+`
+
+func TestExportData(t *testing.T) {
+	_, lib, err := loadModule("lib", exportSrc, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteExportData(&buf, lib); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	read, err := ReadExportData(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if read.Name() != lib.Name() {
+		t.Errorf("got module %s, want %s", read.Name(), lib.Name())
+	}
+	describeExports := func(m *Module) []string {
+		var exports []string
+		for sym := range m.Exports() {
+			exports = append(exports, fmt.Sprintf("%s %s: %s = %s", sym.LinkName(), sym.Name(), sym.Type(), valueString(sym.Value())))
+		}
+		return exports
+	}
+	got, want := describeExports(read), describeExports(lib)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got exports:\n%q\nwant:\n%q", got, want)
+	}
+	if read.LookupExport("hidden") != nil {
+		t.Errorf("unexported hidden was written")
+	}
+	node := read.LookupExport("Node").Type().(*Named)
+	if node.Symbol() != read.LookupExport("Node") {
+		t.Errorf("Node is not declared by the symbol it is exported as")
+	}
+	if next := node.Underlying().(*StructType).Member("next").Type().(*Pointer); next.Element() != node {
+		t.Errorf("Node.next points to %s, want Node", next.Element())
+	}
+
+	importer := &testImporter{}
+	importer.Add("lib", read)
+	const src = `
+const lib = @import("lib");
+const p = lib.Point(x: 2);
+const size = @sizeOf(lib.Word);
+const value = p.y + lib.origin.x;
+func f(m: lib.Meters) lib.Meters {
+	lib.puts("hello %d", lib.answer);
+	return lib.Meters.half(lib.double(m));
+}
+`
+	_, main, err := loadModule("main", src, nil, importer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := valueString(main.Scope().Lookup("value").Value()); got != "1" {
+		t.Errorf("value = %s, want 1", got)
+	}
+
+	for _, test := range []struct {
+		data []byte
+		want string
+	}{
+		{append([]byte(exportMagic), 99), "unsupported export data version 99, want 5"},
+		{data[:len(data)/2], "unexpected EOF"},
+		{[]byte("package lib"), "not export data"},
+	} {
+		_, err := ReadExportData(bytes.NewReader(test.data))
+		if err == nil || !bytes.Contains([]byte(err.Error()), []byte(test.want)) {
+			t.Errorf("got error %v, want %q", err, test.want)
+		}
+	}
+	if _, err := ReadExportData(bytes.NewReader(append([]byte(exportMagic), 1))); !errors.Is(err, ErrExportVersion) {
+		t.Errorf("got error %v, want ErrExportVersion", err)
+	}
+}
+
+// TestExportSharedTypes covers a type read from the export data of both
+// the module declaring it and a module using it, which must be the same
+// type whichever is read first.
+func TestExportSharedTypes(t *testing.T) {
+	write := func(name, src string, importer Importer) []byte {
+		t.Helper()
+		_, m, err := loadModule(name, src, nil, importer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := WriteExportData(&buf, m); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	read := func(data []byte) *Module {
+		t.Helper()
+		m, err := ReadExportData(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	shapesSrc := "export struct Square(side: u32);"
+	shapesData := write("shapes", shapesSrc, nil)
+	importer := &testImporter{}
+	importer.Add("shapes", read(shapesData))
+	areaData := write("area", `
+const shapes = @import("shapes");
+export func area(s: shapes.Square) u32 {
+	return s.side + s.side;
+}
+`, importer)
+
+	// The module using the type is read first, as it is when it is the
+	// first to be imported.
+	area := read(areaData)
+	shapes := read(shapesData)
+	if deps := area.Dependencies(); len(deps) != 1 || deps[0].Name != "shapes" || deps[0].Fingerprint != shapes.Fingerprint() {
+		t.Errorf("got dependencies %v, want shapes with fingerprint %x", deps, shapes.Fingerprint())
+	}
+	importer = &testImporter{}
+	importer.Add("area", area)
+	importer.Add("shapes", shapes)
+	if _, _, err := loadModule("main", `
+const area = @import("area");
+const shapes = @import("shapes");
+func f() u32 {
+	return area.area(shapes.Square(side: 2));
+}
+`, nil, importer); err != nil {
+		t.Error(err)
+	}
+	square := shapes.LookupExport("Square")
+	if square.Type().(*Named).Symbol() != square {
+		t.Errorf("Square is not declared by the symbol it is exported as")
+	}
+
+	// A type declared differently since is read as a new type.
+	changed := read(write("shapes", "export struct Square(side: u64);", nil))
+	if changed.LookupExport("Square").Type().Equal(square.Type()) {
+		t.Errorf("changed Square is the same type as before")
+	}
+	if side := changed.LookupExport("Square").Type().(*Named).Underlying().(*StructType).Member("side").Type(); !side.Equal(NewIntegerType(false, 64)) {
+		t.Errorf("changed Square.side is %s, want u64", side)
+	}
+}
@@ -0,0 +1,182 @@
+package semantics
+
+import (
+	"codeberg.org/rileyq/usagi/internal/compile/ast"
+	"codeberg.org/rileyq/usagi/internal/compile/token"
+)
+
+// A flowBlock is a basic block of a function body: statements that run one
+// after another, followed by a jump to any of its successors.
+type flowBlock struct {
+	stmts     []ast.Stmt
+	succs     []*flowBlock
+	reachable bool
+}
+
+// A flowGraph is the control-flow graph of a function body.
+type flowGraph struct {
+	entry *flowBlock
+	// end is the block that falls off the end of the body.
+	end *flowBlock
+	// blocks maps each statement to the block it starts in.
+	blocks map[ast.Stmt]*flowBlock
+}
+
+type flowBuilder struct {
+	p     *pass
+	graph *flowGraph
+	cur   *flowBlock
+	// breaks holds the block following each enclosing while loop.
+	breaks []*flowBlock
+}
+
+// newFlowGraph builds the control-flow graph of body, which must have been
+// checked, and marks the blocks reachable from its entry.
+func (p *pass) newFlowGraph(body *ast.BlockExpr) *flowGraph {
+	entry := &flowBlock{}
+	b := &flowBuilder{
+		p:     p,
+		graph: &flowGraph{entry: entry, blocks: map[ast.Stmt]*flowBlock{}},
+		cur:   entry,
+	}
+	b.stmts(body.List)
+	b.graph.end = b.cur
+
+	work := []*flowBlock{entry}
+	entry.reachable = true
+	for len(work) > 0 {
+		block := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, succ := range block.succs {
+			if !succ.reachable {
+				succ.reachable = true
+				work = append(work, succ)
+			}
+		}
+	}
+	return b.graph
+}
+
+func (b *flowBuilder) stmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		b.stmt(stmt)
+	}
+}
+
+func (b *flowBuilder) stmt(stmt ast.Stmt) {
+	exprStmt, isExpr := stmt.(*ast.ExprStmt)
+	if isExpr {
+		if loop, isWhile := exprStmt.X.(*ast.WhileExpr); isWhile {
+			b.loop(stmt, loop)
+			return
+		}
+	}
+
+	b.add(stmt)
+	if !isExpr {
+		return
+	}
+	switch x := exprStmt.X.(type) {
+	case *ast.BlockExpr:
+		b.stmts(x.List)
+	case *ast.IfExpr:
+		then, after := &flowBlock{}, &flowBlock{}
+		b.jump(then)
+		b.jump(after)
+		b.cur = then
+		b.stmts(x.Block.List)
+		b.jump(after)
+		b.cur = after
+	case *ast.BreakExpr:
+		if len(b.breaks) > 0 {
+			b.jump(b.breaks[len(b.breaks)-1])
+		}
+		b.cur = &flowBlock{}
+	default:
+		// Returns and calls to noreturn functions end the block.
+		if tv := b.p.types[x]; tv != nil && isNever(tv.Type()) {
+			b.cur = &flowBlock{}
+		}
+	}
+}
+
+// loop adds stmt, the while loop x. Its condition starts a block of its
+// own, which every iteration jumps back to.
+func (b *flowBuilder) loop(stmt ast.Stmt, x *ast.WhileExpr) {
+	cond, body, after := &flowBlock{}, &flowBlock{}, &flowBlock{}
+	b.jump(cond)
+	b.cur = cond
+	b.add(stmt)
+	b.jump(body)
+	// Only a break leaves a loop whose condition is always true.
+	if tv := b.p.types[x.Cond]; tv == nil || !isTrue(tv.Value()) {
+		b.jump(after)
+	}
+
+	b.breaks = append(b.breaks, after)
+	b.cur = body
+	b.stmts(x.Block.List)
+	b.jump(cond)
+	b.breaks = b.breaks[:len(b.breaks)-1]
+	b.cur = after
+}
+
+func (b *flowBuilder) add(stmt ast.Stmt) {
+	b.graph.blocks[stmt] = b.cur
+	b.cur.stmts = append(b.cur.stmts, stmt)
+}
+
+func (b *flowBuilder) jump(to *flowBlock) {
+	b.cur.succs = append(b.cur.succs, to)
+}
+
+func isTrue(v Value) bool {
+	lit, isBool := v.(*BoolLiteral)
+	return isBool && lit.Value()
+}
+
+// flow checks the control flow of body, the body of a function returning
+// returnType. It reports functions that can reach the end of their body
+// without returning a value, and warns about statements that can never
+// run.
+func (p *pass) flow(body *ast.BlockExpr, returnType Type) {
+	graph := p.newFlowGraph(body)
+	p.unreachable(graph, body.List)
+
+	if !graph.end.reachable || isVoid(returnType) || isInvalid(returnType) {
+		return
+	}
+	message := "missing return"
+	if isNever(returnType) {
+		message = "function declared noreturn can return"
+	}
+	p.diags = append(p.diags, &Diagnostic{
+		Pos:      body.Rbrace,
+		End:      body.Rbrace + token.Pos(len("}")),
+		Severity: SeverityError,
+		Message:  message,
+	})
+}
+
+// unreachable warns about the first unreachable statement of stmts and of
+// each reachable block nested in them.
+func (p *pass) unreachable(graph *flowGraph, stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		if !graph.blocks[stmt].reachable {
+			p.warnf(stmt, "unreachable code")
+			return
+		}
+		exprStmt, isExpr := stmt.(*ast.ExprStmt)
+		if !isExpr {
+			continue
+		}
+		switch x := exprStmt.X.(type) {
+		case *ast.BlockExpr:
+			p.unreachable(graph, x.List)
+		case *ast.IfExpr:
+			p.unreachable(graph, x.Block.List)
+		case *ast.WhileExpr:
+			p.unreachable(graph, x.Block.List)
+		}
+	}
+}
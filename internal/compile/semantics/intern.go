@@ -0,0 +1,193 @@
+package semantics
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"weak"
+)
+
+// A typeContext interns types: constructing a type that is structurally
+// identical to one constructed before returns the earlier one, so that
+// identical types are pointer-equal and can be used as map keys. Every
+// type has an id, shared by the types identical to it, which makes Equal a
+// single comparison.
+//
+// Members and parameters with default values are the exception, as their
+// defaults matter to calls but not to the identity of the type. Types with
+// them are never shared, but are given the id of the identical types
+// without them.
+//
+// The context only holds its entries weakly, so that a long-running
+// process does not keep every type it has checked: an entry is released
+// once no type refers to it, and an identical type constructed after that
+// is given a new id, which no live type can be compared to.
+type typeContext struct {
+	mu      sync.Mutex
+	entries map[string]weak.Pointer[typeEntry]
+	next    uint64
+	// named maps the module and name of each named type read from export
+	// data to the type, so that the readers of different export data
+	// resolve a type to the same one. It is held weakly like entries.
+	named map[namedKey]weak.Pointer[Named]
+}
+
+type namedKey struct{ module, name string }
+
+// A typeEntry is the id of the types with a key, and the type interned for
+// it, if one without default values has been constructed. Each of the
+// types refers to the entry to keep it alive.
+type typeEntry struct {
+	id  uint64
+	typ Type
+}
+
+// typeCtx is shared by every check, so that types from different modules
+// can be compared.
+var typeCtx = &typeContext{
+	entries: map[string]weak.Pointer[typeEntry]{},
+	named:   map[namedKey]weak.Pointer[Named]{},
+}
+
+// identity is embedded in every type to hold its id, and the entry it was
+// interned with if it is structural.
+type identity struct {
+	id    uint64
+	entry *typeEntry
+}
+
+func (i *identity) typeID() uint64 { return i.id }
+
+func (i *identity) setEntry(entry *typeEntry) { i.id, i.entry = entry.id, entry }
+
+// identical reports whether a and b are the same type, disregarding any
+// default values.
+func identical(a, b Type) bool {
+	return b != nil && a.typeID() == b.typeID()
+}
+
+// newID returns an id shared by no other type.
+func (ctx *typeContext) newID() uint64 {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.next++
+	return ctx.next
+}
+
+// intern returns the type identified by key, which is typ unless an
+// identical type was interned before. If typ has default values, it is
+// returned with the id of the identical types instead.
+func intern[T interface {
+	Type
+	setEntry(*typeEntry)
+}](key string, typ T, defaults bool) T {
+	typeCtx.mu.Lock()
+	defer typeCtx.mu.Unlock()
+	entry := typeCtx.entries[key].Value()
+	if entry == nil {
+		typeCtx.next++
+		entry = &typeEntry{id: typeCtx.next}
+		ptr := weak.Make(entry)
+		typeCtx.entries[key] = ptr
+		runtime.AddCleanup(entry, typeCtx.release, releasedEntry{key, ptr})
+	} else if !defaults && entry.typ != nil {
+		return entry.typ.(T)
+	}
+	typ.setEntry(entry)
+	if !defaults {
+		entry.typ = typ
+	}
+	return typ
+}
+
+type releasedEntry struct {
+	key string
+	ptr weak.Pointer[typeEntry]
+}
+
+// release removes an entry no type refers to any more, unless its key has
+// been given a new entry since.
+func (ctx *typeContext) release(released releasedEntry) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if ctx.entries[released.key] == released.ptr {
+		delete(ctx.entries, released.key)
+	}
+}
+
+// lookupNamed returns the named type called name declared by module, if
+// one has been read from export data and not released.
+func (ctx *typeContext) lookupNamed(module, name string) *Named {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return ctx.named[namedKey{module, name}].Value()
+}
+
+// addNamed records named as the type called name declared by module,
+// replacing any type recorded before.
+func (ctx *typeContext) addNamed(module, name string, named *Named) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	key := namedKey{module, name}
+	ptr := weak.Make(named)
+	ctx.named[key] = ptr
+	runtime.AddCleanup(named, ctx.releaseNamed, releasedNamed{key, ptr})
+}
+
+type releasedNamed struct {
+	key namedKey
+	ptr weak.Pointer[Named]
+}
+
+// releaseNamed removes a named type that is no longer used, unless another
+// type has been recorded for its key since.
+func (ctx *typeContext) releaseNamed(released releasedNamed) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if ctx.named[released.key] == released.ptr {
+		delete(ctx.named, released.key)
+	}
+}
+
+// size returns the number of entries in ctx.
+func (ctx *typeContext) size() int {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return len(ctx.entries)
+}
+
+// A typeKey builds the key identifying a type from the ids of the types
+// it is made of.
+type typeKey []byte
+
+func newTypeKey(kind byte) typeKey { return typeKey{kind} }
+
+func (k typeKey) typ(typ Type) typeKey {
+	if typ == nil {
+		return append(k, " -"...)
+	}
+	return strconv.AppendUint(append(k, ' '), typ.typeID(), 10)
+}
+
+func (k typeKey) int(n int64) typeKey {
+	return strconv.AppendInt(append(k, ' '), n, 10)
+}
+
+func (k typeKey) bool(b bool) typeKey {
+	if b {
+		return append(k, '1')
+	}
+	return append(k, '0')
+}
+
+// list adds the names and types of list to k, and reports whether any of
+// them has a default value.
+func (k typeKey) list(list []*NameAndType) (typeKey, bool) {
+	defaults := false
+	k = k.int(int64(len(list)))
+	for _, nt := range list {
+		k = append(k.int(int64(len(nt.name))), nt.name...).typ(nt.typ)
+		defaults = defaults || nt.def != nil
+	}
+	return k, defaults
+}
@@ -0,0 +1,508 @@
+package semantics
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Link names of symbols without one given by @extern are mangled from the
+// path of the symbol, so that every symbol of a program has a distinct
+// name, made only of letters, digits and underscores:
+//
+//	symbol    = "_U" path
+//	path      = module { scope } ident [ "G" { type } "E" ]
+//	module    = "M" ident { ident } "_"
+//	scope     = "F" ident             function
+//	          | "B" number "_"        block or function literal, numbered
+//	                                  among the scopes of its parent
+//	          | "I" type              impl of type
+//	ident     = [ "u" ] number [ "_" ] { byte }
+//	                                  the number of bytes, then the bytes,
+//	                                  separated by "_" if they start with
+//	                                  a digit or "_"
+//	type      = "i" number "_"        signed integer of number bits
+//	          | "u" number "_"        unsigned integer, u0 being void
+//	          | "b"                   bool
+//	          | "n"                   noreturn
+//	          | "P" type              pointer
+//	          | "Q" type              many-item pointer
+//	          | "S" type              slice
+//	          | "A" number "_" type   array
+//	          | "F" { ident type } [ "V" ] "E" type
+//	                                  function, "V" marking it variadic
+//	          | "R" { ident type } "E"
+//	                                  struct
+//	          | "W" { ident type } "E"
+//	                                  union
+//	          | "K" [ "C" ] { ident type } "E"
+//	                                  trait, "C" marking it closed
+//	          | "N" path              named type
+//
+// The module is the slash-separated path of the module, split into its
+// elements. A path ends with the type arguments of a generic
+// instantiation, if any. An identifier with bytes other than letters,
+// digits and underscores is marked by "u" and escaped, each such byte
+// written as "_" and two lowercase hex digits and each underscore as "__".
+//
+// Demangle turns link names back into paths such as
+// std/io.(std/io.File).read.{block#0}.n and main.max[i32].
+
+// A SymbolPath locates a symbol among the scopes that declare it.
+type SymbolPath struct {
+	// Module is the slash-separated path of the module.
+	Module string
+	// Scopes lists the scopes between the module and the symbol,
+	// outermost first.
+	Scopes []PathScope
+	Name   string
+	// TypeArgs are the type arguments of a generic instantiation.
+	TypeArgs []Type
+}
+
+type PathScopeKind int
+
+const (
+	FuncScope PathScopeKind = iota
+	BlockScope
+	ImplScope
+)
+
+// A PathScope is a scope in a SymbolPath: the function Name, the block
+// numbered Index among the scopes of its parent, or the impl of Type.
+type PathScope struct {
+	Kind  PathScopeKind
+	Name  string
+	Index int
+	Type  Type
+}
+
+// Mangle returns the link name of the symbol at path.
+func (path *SymbolPath) Mangle() string {
+	var b strings.Builder
+	b.WriteString("_U")
+	mangleDef(&b, path)
+	return b.String()
+}
+
+// symbolPath returns the path of sym. Methods are in the scope of the
+// impl of their receiver, and the functions enclosing a scope are found
+// through the symbols they are bound to.
+func symbolPath(sym *symbol) *SymbolPath {
+	path := &SymbolPath{Name: sym.name}
+	if sym.recv != nil {
+		path.Scopes = append(path.Scopes, PathScope{Kind: ImplScope, Type: sym.recv})
+	}
+	for s := sym.scope; s != nil && s.module != nil && s != s.module.scope; s = s.parent {
+		switch {
+		case s.fn != nil:
+			path.Scopes = append(path.Scopes, PathScope{Kind: FuncScope, Name: s.fn.name})
+			if s.fn.recv != nil {
+				path.Scopes = append(path.Scopes, PathScope{Kind: ImplScope, Type: s.fn.recv})
+			}
+		default:
+			path.Scopes = append(path.Scopes, PathScope{Kind: BlockScope, Index: slices.Index(s.parent.children, s)})
+		}
+	}
+	slices.Reverse(path.Scopes)
+	if sym.scope != nil && sym.scope.module != nil {
+		path.Module = sym.scope.module.name
+	}
+	return path
+}
+
+func mangleDef(b *strings.Builder, path *SymbolPath) {
+	b.WriteByte('M')
+	for elem := range strings.SplitSeq(path.Module, "/") {
+		mangleIdent(b, elem)
+	}
+	b.WriteByte('_')
+	for _, scope := range path.Scopes {
+		switch {
+		case scope.Kind == FuncScope:
+			b.WriteByte('F')
+			mangleIdent(b, scope.Name)
+		case scope.Kind == BlockScope:
+			fmt.Fprintf(b, "B%d_", scope.Index)
+		default:
+			b.WriteByte('I')
+			mangleType(b, scope.Type)
+		}
+	}
+	mangleIdent(b, path.Name)
+	if len(path.TypeArgs) > 0 {
+		b.WriteByte('G')
+		for _, arg := range path.TypeArgs {
+			mangleType(b, arg)
+		}
+		b.WriteByte('E')
+	}
+}
+
+func mangleIdent(b *strings.Builder, ident string) {
+	if !isWord(ident) {
+		var escaped strings.Builder
+		for _, c := range []byte(ident) {
+			switch {
+			case c == '_':
+				escaped.WriteString("__")
+			case isWordByte(c):
+				escaped.WriteByte(c)
+			default:
+				fmt.Fprintf(&escaped, "_%02x", c)
+			}
+		}
+		b.WriteByte('u')
+		ident = escaped.String()
+	}
+	b.WriteString(strconv.Itoa(len(ident)))
+	if ident != "" && (ident[0] == '_' || '0' <= ident[0] && ident[0] <= '9') {
+		b.WriteByte('_')
+	}
+	b.WriteString(ident)
+}
+
+func mangleType(b *strings.Builder, typ Type) {
+	switch typ := typ.(type) {
+	case *IntegerType:
+		if typ.signed {
+			b.WriteByte('i')
+		} else {
+			b.WriteByte('u')
+		}
+		fmt.Fprintf(b, "%d_", typ.bits)
+	case *BoolType:
+		b.WriteByte('b')
+	case *NeverType:
+		b.WriteByte('n')
+	case *Pointer:
+		if typ.many {
+			b.WriteByte('Q')
+		} else {
+			b.WriteByte('P')
+		}
+		mangleType(b, typ.element)
+	case *SliceType:
+		b.WriteByte('S')
+		mangleType(b, typ.element)
+	case *ArrayType:
+		fmt.Fprintf(b, "A%d_", typ.length)
+		mangleType(b, typ.element)
+	case *Signature:
+		b.WriteByte('F')
+		mangleList(b, typ.params)
+		if typ.variadic {
+			b.WriteByte('V')
+		}
+		b.WriteByte('E')
+		mangleType(b, typ.returnType)
+	case *StructType:
+		b.WriteByte('R')
+		mangleList(b, typ.members)
+		b.WriteByte('E')
+	case *UnionType:
+		b.WriteByte('W')
+		mangleList(b, typ.members)
+		b.WriteByte('E')
+	case *TraitType:
+		b.WriteByte('K')
+		if typ.closed {
+			b.WriteByte('C')
+		}
+		mangleList(b, typ.requirements)
+		b.WriteByte('E')
+	case *Named:
+		b.WriteByte('N')
+		if sym, isSymbol := typ.sym.(*symbol); isSymbol {
+			mangleDef(b, symbolPath(sym))
+		} else {
+			mangleDef(b, &SymbolPath{Name: typ.sym.Name()})
+		}
+	default:
+		panic(fmt.Sprintf("semantics: cannot mangle %s", typ))
+	}
+}
+
+func mangleList(b *strings.Builder, list []*NameAndType) {
+	for _, nt := range list {
+		mangleIdent(b, nt.name)
+		mangleType(b, nt.typ)
+	}
+}
+
+// ErrNotMangled is returned by Demangle for names that are not valid
+// mangled link names.
+var ErrNotMangled = errors.New("not a mangled name")
+
+// Demangle returns the path of the symbol whose link name is name, in the
+// form module.scope.name, where functions are written by name, blocks as
+// {block#n}, impls as (type) and type arguments in
+// brackets after the name.
+func Demangle(name string) (string, error) {
+	text, n := demangle(name)
+	if n == 0 || n != len(name) {
+		return "", fmt.Errorf("%w: %s", ErrNotMangled, name)
+	}
+	return text, nil
+}
+
+// DemangleAll returns text with every mangled link name in it replaced by
+// its demangled form. Names are only recognized as whole words.
+func DemangleAll(text string) string {
+	var b strings.Builder
+	last := 0
+	for i := 0; ; {
+		j := strings.Index(text[i:], "_U")
+		if j < 0 {
+			break
+		}
+		start := i + j
+		i = start + 2
+		if start > 0 && isWordByte(text[start-1]) {
+			continue
+		}
+		demangled, n := demangle(text[start:])
+		if n == 0 || start+n < len(text) && isWordByte(text[start+n]) {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(demangled)
+		last, i = start+n, start+n
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// isWord reports whether s is made only of letters, digits and
+// underscores.
+func isWord(s string) bool {
+	for i := range len(s) {
+		if !isWordByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// demangle demangles the link name at the start of s, returning its
+// demangled form and its length, or 0 if s does not start with one.
+func demangle(s string) (string, int) {
+	if !strings.HasPrefix(s, "_U") {
+		return "", 0
+	}
+	d := &demangler{s: s, pos: 2}
+	text := d.path()
+	if d.failed {
+		return "", 0
+	}
+	return text, d.pos
+}
+
+// A demangler reads the grammar of link names from s. Once it fails, it
+// reads only zeros.
+type demangler struct {
+	s      string
+	pos    int
+	failed bool
+}
+
+func (d *demangler) fail() {
+	d.failed = true
+	d.pos = len(d.s)
+}
+
+func (d *demangler) peek() byte {
+	if d.pos >= len(d.s) {
+		return 0
+	}
+	return d.s[d.pos]
+}
+
+func (d *demangler) next() byte {
+	c := d.peek()
+	if c == 0 {
+		d.fail()
+		return 0
+	}
+	d.pos++
+	return c
+}
+
+func (d *demangler) expect(c byte) {
+	if d.next() != c {
+		d.fail()
+	}
+}
+
+func (d *demangler) number() int64 {
+	start := d.pos
+	for '0' <= d.peek() && d.peek() <= '9' {
+		d.pos++
+	}
+	n, err := strconv.ParseInt(d.s[start:d.pos], 10, 64)
+	if err != nil {
+		d.fail()
+	}
+	return n
+}
+
+func (d *demangler) ident() string {
+	escaped := d.peek() == 'u'
+	if escaped {
+		d.pos++
+	}
+	n := d.number()
+	if d.peek() == '_' {
+		d.pos++
+	}
+	if d.failed || n > int64(len(d.s)-d.pos) {
+		d.fail()
+		return ""
+	}
+	ident := d.s[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	if escaped {
+		return d.unescape(ident)
+	}
+	return ident
+}
+
+// unescape returns the identifier escaped as ident.
+func (d *demangler) unescape(ident string) string {
+	var b strings.Builder
+	for i := 0; i < len(ident); i++ {
+		if ident[i] != '_' {
+			b.WriteByte(ident[i])
+			continue
+		}
+		if strings.HasPrefix(ident[i+1:], "_") {
+			b.WriteByte('_')
+			i++
+			continue
+		}
+		if i+3 > len(ident) {
+			d.fail()
+			return ""
+		}
+		c, err := strconv.ParseUint(ident[i+1:i+3], 16, 8)
+		if err != nil {
+			d.fail()
+			return ""
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String()
+}
+
+func (d *demangler) path() string {
+	var b strings.Builder
+	d.expect('M')
+	b.WriteString(d.ident())
+	for !d.failed && d.peek() != '_' {
+		b.WriteByte('/')
+		b.WriteString(d.ident())
+	}
+	d.expect('_')
+	for !d.failed {
+		switch d.peek() {
+		case 'F':
+			d.pos++
+			b.WriteByte('.')
+			b.WriteString(d.ident())
+			continue
+		case 'B':
+			d.pos++
+			fmt.Fprintf(&b, ".{block#%d}", d.number())
+			d.expect('_')
+			continue
+		case 'I':
+			d.pos++
+			fmt.Fprintf(&b, ".(%s)", d.typ())
+			continue
+		}
+		break
+	}
+	b.WriteByte('.')
+	b.WriteString(d.ident())
+	if d.peek() == 'G' {
+		d.pos++
+		var args []string
+		for !d.failed && d.peek() != 'E' {
+			args = append(args, d.typ())
+		}
+		d.expect('E')
+		fmt.Fprintf(&b, "[%s]", strings.Join(args, ", "))
+	}
+	return b.String()
+}
+
+func (d *demangler) typ() string {
+	switch c := d.next(); c {
+	case 'i', 'u':
+		bits := d.number()
+		d.expect('_')
+		if c == 'u' && bits == 0 {
+			return "void"
+		}
+		return fmt.Sprintf("%c%d", c, bits)
+	case 'b':
+		return "bool"
+	case 'n':
+		return "noreturn"
+	case 'P':
+		return "*" + d.typ()
+	case 'Q':
+		return "[*]" + d.typ()
+	case 'S':
+		return "[]" + d.typ()
+	case 'A':
+		length := d.number()
+		d.expect('_')
+		return fmt.Sprintf("[%d]%s", length, d.typ())
+	case 'F':
+		list := d.list()
+		if d.peek() == 'V' {
+			d.pos++
+			list = append(list, "...")
+		}
+		d.expect('E')
+		return fmt.Sprintf("func(%s) %s", strings.Join(list, ", "), d.typ())
+	case 'R', 'W':
+		list := d.list()
+		d.expect('E')
+		if c == 'R' {
+			return fmt.Sprintf("struct(%s)", strings.Join(list, ", "))
+		}
+		return fmt.Sprintf("union(%s)", strings.Join(list, ", "))
+	case 'K':
+		closed := ""
+		if d.peek() == 'C' {
+			d.pos++
+			closed = "closed "
+		}
+		list := d.list()
+		d.expect('E')
+		return fmt.Sprintf("%strait(%s)", closed, strings.Join(list, ", "))
+	case 'N':
+		return d.path()
+	}
+	d.fail()
+	return ""
+}
+
+// list reads names and types up to the next V or E.
+func (d *demangler) list() []string {
+	var list []string
+	for !d.failed && d.peek() != 'V' && d.peek() != 'E' {
+		name := d.ident()
+		list = append(list, name+": "+d.typ())
+	}
+	return list
+}
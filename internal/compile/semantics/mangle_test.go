@@ -0,0 +1,154 @@
+package semantics
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"codeberg.org/rileyq/usagi/internal/compile/ast"
+)
+
+func TestLinkNames(t *testing.T) {
+	const src = `
+export struct Point(x: i32, y: i32);
+impl Point {
+	func sum(p: Point) i32 {
+		const half = func(n: i32) i32 { return n; };
+		return half(p.x + p.y);
+	}
+}
+func f(x: i32) i32 {
+	if x < 0 {
+		const g = func(n: i32) i32 { return n; };
+		return g(x);
+	}
+	while x > 0 {
+		const g = func(n: i32) i32 { return n; };
+		return g(x);
+	}
+	return 0;
+}
+const puts: func(s: [*]u8) i32 = @extern("puts");
+`
+	info := &Info{Defs: map[*ast.Identifier]Symbol{}}
+	if _, _, err := loadModule("app/main", src, info, nil); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, sym := range info.Defs {
+		linkName := sym.LinkName()
+		if sym.Name() == "puts" {
+			if linkName != "puts" {
+				t.Errorf("puts has link name %s, want puts", linkName)
+			}
+			continue
+		}
+		demangled, err := Demangle(linkName)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		got = append(got, linkName+" "+demangled)
+	}
+	slices.Sort(got)
+	want := []string{
+		"_UM3app4main_1f app/main.f",
+		"_UM3app4main_5Point app/main.Point",
+		"_UM3app4main_F1f1x app/main.f.x",
+		"_UM3app4main_F1fB0_1g app/main.f.{block#0}.g",
+		"_UM3app4main_F1fB0_F1g1n app/main.f.{block#0}.g.n",
+		"_UM3app4main_F1fB1_1g app/main.f.{block#1}.g",
+		"_UM3app4main_F1fB1_F1g1n app/main.f.{block#1}.g.n",
+		"_UM3app4main_F4puts1s app/main.puts.s",
+		"_UM3app4main_INM3app4main_5Point3sum app/main.(app/main.Point).sum",
+		"_UM3app4main_INM3app4main_5PointF3sum1p app/main.(app/main.Point).sum.p",
+		"_UM3app4main_INM3app4main_5PointF3sum4half app/main.(app/main.Point).sum.half",
+		"_UM3app4main_INM3app4main_5PointF3sumF4half1n app/main.(app/main.Point).sum.half.n",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got link names:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestMangleTypes(t *testing.T) {
+	_, module, err := loadModule("lib", `export struct File(fd: i32);`, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := module.Scope().Lookup("File").Type()
+	u8 := NewIntegerType(false, 8)
+
+	tests := []struct {
+		path          *SymbolPath
+		mangled, want string
+	}{
+		{
+			&SymbolPath{Module: "std/io", Scopes: []PathScope{{Kind: ImplScope, Type: file}}, Name: "show"},
+			"_UM3std2io_INM3lib_4File4show",
+			"std/io.(lib.File).show",
+		},
+		// Identifiers starting with a digit or underscore are separated
+		// from their length, and other bytes are escaped.
+		{
+			&SymbolPath{Module: "gfx/2d", Name: "draw"},
+			"_UM3gfx2_2d_4draw",
+			"gfx/2d.draw",
+		},
+		{
+			&SymbolPath{Module: "my-lib", Scopes: []PathScope{{Kind: FuncScope, Name: "_init"}}, Name: "a_b.c"},
+			"_UMu8my_2dlib_F5__initu8a__b_2ec",
+			"my-lib._init.a_b.c",
+		},
+		{
+			&SymbolPath{Module: "main", Name: "-x"},
+			"_UM4main_u4__2dx",
+			"main.-x",
+		},
+		{
+			&SymbolPath{Module: "main", Name: "max", TypeArgs: []Type{
+				NewIntegerType(true, 32), NewManyPointer(u8), NewPointer(Bool), NewSliceType(NewArrayType(u8, 4)),
+			}},
+			"_UM4main_3maxGi32_Qu8_PbSA4_u8_E",
+			"main.max[i32, [*]u8, *bool, [][4]u8]",
+		},
+		{
+			&SymbolPath{Module: "main", Scopes: []PathScope{{Kind: FuncScope, Name: "f"}, {Kind: BlockScope, Index: 3}}, Name: "id", TypeArgs: []Type{
+				NewVariadicSignature([]*NameAndType{NewNameAndType("fmt", NewManyPointer(u8))}, NewIntegerType(false, 0)),
+				NewStructType([]*NameAndType{NewNameAndType("a", Never)}),
+				NewUnionType([]*NameAndType{NewNameAndType("b", file)}),
+				NewTraitType(true, nil),
+			}},
+			"_UM4main_F1fB3_2idGF3fmtQu8_VEu0_R1anEW1bNM3lib_4FileEKCEE",
+			"main.f.{block#3}.id[func(fmt: [*]u8, ...) void, struct(a: noreturn), union(b: lib.File), closed trait()]",
+		},
+	}
+	for _, test := range tests {
+		mangled := test.path.Mangle()
+		if mangled != test.mangled {
+			t.Errorf("got %s, want %s", mangled, test.mangled)
+		}
+		if !isWord(mangled) {
+			t.Errorf("%s is not made of letters, digits and underscores", mangled)
+		}
+		demangled, err := Demangle(mangled)
+		if err != nil || demangled != test.want {
+			t.Errorf("Demangle(%s) = %q, %v, want %q", mangled, demangled, err, test.want)
+		}
+	}
+}
+
+func TestDemangle(t *testing.T) {
+	for _, name := range []string{"", "_U", "puts", "_UM4main", "_UM4main_", "_UM99main_1f", "_UM4main_1fX", "_UM4main_I1f", "_UM4main_1fGi32_", "_UM4main_u3a_z", "_UM4main_u3_zz"} {
+		if demangled, err := Demangle(name); !errors.Is(err, ErrNotMangled) {
+			t.Errorf("Demangle(%q) = %q, %v, want ErrNotMangled", name, demangled, err)
+		}
+	}
+
+	const text = "call _UM4main_1f@PLT\n" +
+		"mov x_UM4main_1f, _UM4main_1fx, _UM4main_, (_UM3std2io_INM3std2io_4File4read)\n"
+	const want = "call main.f@PLT\n" +
+		"mov x_UM4main_1f, _UM4main_1fx, _UM4main_, (std/io.(std/io.File).read)\n"
+	if got := DemangleAll(text); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
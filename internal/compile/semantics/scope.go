@@ -8,6 +8,7 @@ import (
 	"slices"
 	"strings"
 
+	"codeberg.org/rileyq/usagi/internal/compile/ast"
 	"codeberg.org/rileyq/usagi/internal/compile/token"
 )
 
@@ -19,6 +20,12 @@ type Scope struct {
 	module   *Module
 	children []*Scope
 	symbols  map[string]Symbol
+	// frozen is set for scopes shared by concurrent checks, such as
+	// Universe, which record no children and reject new symbols.
+	frozen bool
+	// fn is the symbol bound to the function whose parameters s holds,
+	// if s is the scope of a named function.
+	fn *symbol
 }
 
 func NewScope(parent *Scope, pos, end token.Pos, comment string) *Scope {
@@ -31,13 +38,18 @@ func NewScope(parent *Scope, pos, end token.Pos, comment string) *Scope {
 		symbols:  map[string]Symbol{},
 	}
 	if parent != nil {
-		parent.children = append(parent.children, s)
+		if !parent.frozen {
+			parent.children = append(parent.children, s)
+		}
 		s.module = parent.module
 	}
 	return s
 }
 
 func (s *Scope) Insert(symbol Symbol) Symbol {
+	if s.frozen {
+		panic(fmt.Sprintf("semantics: Insert %s into frozen %s scope", symbol.Name(), s.comment))
+	}
 	name := symbol.Name()
 	sym, found := s.symbols[name]
 	if found {
@@ -48,6 +60,22 @@ func (s *Scope) Insert(symbol Symbol) Symbol {
 	return nil
 }
 
+// LookupParent follows the parent chain of scopes starting at s until it
+// finds a scope where name is declared and in scope at pos, returning
+// that scope and the symbol. Symbols declared in functions and blocks are
+// in scope only after their declarations, while those of modules and
+// Universe are in scope throughout. If pos is NoPos, every symbol is
+// considered.
+func (s *Scope) LookupParent(name string, pos token.Pos) (*Scope, Symbol) {
+	for scope := s; scope != nil; scope = scope.parent {
+		sym, found := scope.symbols[name]
+		if found && (pos == token.NoPos || sym.scopePos() <= pos) {
+			return scope, sym
+		}
+	}
+	return nil, nil
+}
+
 func (s *Scope) Lookup(name string) Symbol {
 	sym, found := s.symbols[name]
 	if found {
@@ -61,6 +89,37 @@ func (s *Scope) Lookup(name string) Symbol {
 
 func (s *Scope) Module() *Module { return s.module }
 
+// Pos and End return the extent of the source covered by s. They are
+// NoPos for Universe.
+func (s *Scope) Pos() token.Pos { return s.pos }
+func (s *Scope) End() token.Pos { return s.end }
+
+func (s *Scope) Parent() *Scope     { return s.parent }
+func (s *Scope) Children() []*Scope { return s.children }
+
+// Contains reports whether pos is within the extent of s.
+func (s *Scope) Contains(pos token.Pos) bool {
+	return s.pos <= pos && pos < s.end
+}
+
+// Innermost returns the innermost scope containing pos among s and its
+// descendants, or nil if there is none. Scopes without a position, such
+// as Universe, are searched but never returned.
+func (s *Scope) Innermost(pos token.Pos) *Scope {
+	if s.pos != token.NoPos && !s.Contains(pos) {
+		return nil
+	}
+	for _, child := range s.children {
+		if inner := child.Innermost(pos); inner != nil {
+			return inner
+		}
+	}
+	if s.pos == token.NoPos {
+		return nil
+	}
+	return s
+}
+
 func (s *Scope) Symbols() iter.Seq[Symbol] {
 	return func(yield func(Symbol) bool) {
 		for _, key := range slices.Sorted(maps.Keys(s.symbols)) {
@@ -71,6 +130,17 @@ func (s *Scope) Symbols() iter.Seq[Symbol] {
 	}
 }
 
+// Exports returns the exported symbols declared in s, sorted by name.
+func (s *Scope) Exports() iter.Seq[Symbol] {
+	return func(yield func(Symbol) bool) {
+		for sym := range s.Symbols() {
+			if sym.Exported() && !yield(sym) {
+				return
+			}
+		}
+	}
+}
+
 func (s *Scope) WriteTo(w io.Writer) (int64, error) {
 	return s.writeTo(w, 0)
 }
@@ -145,8 +215,16 @@ type Symbol interface {
 	Value() Value
 	LinkName() string
 	Scope() *Scope
+	// Pos returns the position of the name in the declaration of the
+	// symbol, or NoPos if it is predeclared.
+	Pos() token.Pos
+	// Exported reports whether the symbol was declared with export, making
+	// it visible to modules that import its own.
+	Exported() bool
 
 	setScope(scope *Scope)
+	// scopePos returns the position from which the symbol is in scope.
+	scopePos() token.Pos
 }
 
 type symbol struct {
@@ -154,12 +232,31 @@ type symbol struct {
 	name     string
 	linkName string
 	tv       *TypeAndValue
+	pos      token.Pos
+	visible  token.Pos
+
+	// binding is the binding that declared the symbol, if any, and param
+	// is set for function parameters. They decide whether the symbol can
+	// be assigned to.
+	binding  *ast.Binding
+	param    bool
+	exported bool
+	// recv is the type a method is defined for by an impl.
+	recv Type
+	// used and mutated record whether a local binding is ever read or
+	// assigned to after its initialization.
+	used, mutated bool
 }
 
-func (sym *symbol) Name() string  { return sym.name }
-func (sym *symbol) Type() Type    { return sym.tv.Type() }
-func (sym *symbol) Value() Value  { return sym.tv.Value() }
-func (sym *symbol) Scope() *Scope { return sym.scope }
+func (sym *symbol) Name() string   { return sym.name }
+func (sym *symbol) Pos() token.Pos { return sym.pos }
+
+func (sym *symbol) scopePos() token.Pos { return sym.visible }
+func (sym *symbol) Type() Type          { return sym.tv.Type() }
+func (sym *symbol) Value() Value        { return sym.tv.Value() }
+func (sym *symbol) Scope() *Scope       { return sym.scope }
+
+func (sym *symbol) Exported() bool { return sym.exported }
 
 func (sym *symbol) QualifiedName() string {
 	return fmt.Sprintf("%s.%s", sym.scope.Module().Name(), sym.Name())
@@ -169,8 +266,7 @@ func (sym *symbol) LinkName() string {
 	if len(sym.linkName) > 0 {
 		return sym.linkName
 	}
-	qualName := sym.QualifiedName()
-	return fmt.Sprintf("_U%d%s", len(qualName), qualName)
+	return symbolPath(sym).Mangle()
 }
 
 func (sym *symbol) setScope(scope *Scope) { sym.scope = scope }
@@ -190,11 +286,11 @@ func (sym *symbol) String() string {
 }
 
 func NewSymbol(name string, tv *TypeAndValue) *symbol {
-	return &symbol{nil, name, "", tv}
+	return &symbol{scope: nil, name: name, tv: tv}
 }
 
 func NewSymbolFromValue(name string, value Value) *symbol {
-	return &symbol{nil, name, "", NewTypeAndValue(value.Type(), value)}
+	return &symbol{scope: nil, name: name, tv: NewTypeAndValue(value.Type(), value)}
 }
 
 type TypeAndValue struct {
@@ -207,11 +303,27 @@ func NewTypeAndValue(typ Type, val Value) *TypeAndValue { return &TypeAndValue{t
 func (tv *TypeAndValue) Type() Type   { return tv.typ }
 func (tv *TypeAndValue) Value() Value { return tv.val }
 
+// Universe is the outermost scope of every module. It is read-only once
+// the package is initialized, so that modules can be checked concurrently;
+// module scopes are not recorded as its children.
 var Universe *Scope
 
 func init() {
 	Universe = NewScope(nil, token.NoPos, token.NoPos, "universe")
 	Universe.Insert(NewSymbolFromValue("Type", NewTypeValue(NewTraitType(true, nil))))
+	Universe.Insert(NewSymbolFromValue("bool", NewTypeValue(Bool)))
+	Universe.Insert(NewSymbolFromValue("noreturn", NewTypeValue(Never)))
+	Universe.Insert(NewSymbolFromValue("true", NewBoolLiteral(true)))
+	Universe.Insert(NewSymbolFromValue("false", NewBoolLiteral(false)))
 	Universe.Insert(NewSymbolFromValue("@import", NewBuiltin(BuiltinImport)))
 	Universe.Insert(NewSymbolFromValue("@extern", NewBuiltin(BuiltinExtern)))
+	Universe.Insert(NewSymbolFromValue("@as", NewBuiltin(BuiltinAs)))
+	Universe.Insert(NewSymbolFromValue("@intCast", NewBuiltin(BuiltinIntCast)))
+	Universe.Insert(NewSymbolFromValue("@truncate", NewBuiltin(BuiltinTruncate)))
+	Universe.Insert(NewSymbolFromValue("@bitCast", NewBuiltin(BuiltinBitCast)))
+	Universe.Insert(NewSymbolFromValue("@sizeOf", NewBuiltin(BuiltinSizeOf)))
+	Universe.Insert(NewSymbolFromValue("@alignOf", NewBuiltin(BuiltinAlignOf)))
+	Universe.Insert(NewSymbolFromValue("@offsetOf", NewBuiltin(BuiltinOffsetOf)))
+	Universe.Insert(NewSymbolFromValue("@export", NewBuiltin(BuiltinExport)))
+	Universe.frozen = true
 }
@@ -2,9 +2,17 @@ package semantics
 
 import (
 	"fmt"
+	"iter"
+	"maps"
+	"math"
+	"math/big"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 
 	"codeberg.org/rileyq/usagi/internal/compile/ast"
+	"codeberg.org/rileyq/usagi/internal/compile/ast/printer"
 	"codeberg.org/rileyq/usagi/internal/compile/token"
 )
 
@@ -13,14 +21,59 @@ type CheckConfig struct {
 	Info            *Info
 	Importer        Importer
 	CheckFuncBodies bool
+
+	// Dir is the directory containing the source of Module. Relative
+	// imports are resolved against it if Importer is an ImporterFrom.
+	Dir string
+
+	// EvalSteps and EvalDepth limit the number of expressions evaluated
+	// and the depth of calls made while evaluating a constant at compile
+	// time. Zero means a default limit.
+	EvalSteps int
+	EvalDepth int
+
+	// Target is the machine the module is compiled for. If nil, it is
+	// x86_64-linux.
+	Target *Target
+
+	// Sizes computes the layout of types for @sizeOf, @alignOf and
+	// @offsetOf. If nil, the layout of Target is used.
+	Sizes Sizes
+
+	// Warn, if not nil, is called with each warning once the module has
+	// been checked, in order of position, even if there were errors.
+	Warn func(*Diagnostic)
 }
 
 func Check(cfg *CheckConfig) (*Module, error) {
 	var p pass
 	p.info = cfg.Info
 	p.importer = cfg.Importer
+	p.dir = cfg.Dir
 	p.checkFuncBodies = cfg.CheckFuncBodies
-	return p.Apply(cfg.Module)
+	p.evalSteps = cfg.EvalSteps
+	p.evalDepth = cfg.EvalDepth
+	p.target = cfg.Target
+	if p.target == nil {
+		p.target, _ = LookupTarget(defaultTarget)
+	}
+	if err := p.target.validate(); err != nil {
+		p.diags = append(p.diags, &Diagnostic{Severity: SeverityError, Message: err.Error()})
+		return nil, p.diags
+	}
+	p.sizes = cfg.Sizes
+	if p.sizes == nil {
+		p.sizes = p.target.Sizes()
+	}
+	module, err := p.Apply(cfg.Module)
+	if cfg.Warn != nil {
+		for _, d := range p.diags {
+			if d.Severity == SeverityWarning {
+				cfg.Warn(d)
+			}
+		}
+	}
+	return module, err
 }
 
 type pass struct {
@@ -29,24 +82,144 @@ type pass struct {
 	resultLocation  *symbol
 	info            *Info
 	importer        Importer
+	dir             string
 	checkFuncBodies bool
 	returnType      Type
+	diags           Diagnostics
+	evalSteps       int
+	evalDepth       int
+	target          *Target
+	sizes           Sizes
+	types           map[ast.Expr]*TypeAndValue
+	callArgs        map[*ast.CallExpr][]ast.Expr
+
+	decls         map[*ast.Binding]*declInfo
+	declsBySymbol map[Symbol]*declInfo
+	path          []*declInfo
+	aggregates    []Type
+	delayed       []func()
+	bodies        map[*ast.FuncExpr]*funcBody
+
+	// locals are the let and const bindings declared in the function
+	// body being checked, and uninit those of its lets that are not
+	// definitely initialized at the current point.
+	locals []*symbol
+	uninit map[*symbol]bool
+	// loops is the number of while loops enclosing the expression being
+	// checked in the current function body.
+	loops int
+	// deps are the modules imported so far.
+	deps []Dependency
 }
 
 func (p *pass) Apply(moduleAst *ast.Module) (*Module, error) {
 	module := p.module(moduleAst)
+	p.diags.sort()
+	if p.diags.HasErrors() {
+		return module, p.diags
+	}
 	return module, nil
 }
 
+func (p *pass) errorf(node ast.Node, format string, args ...any) {
+	p.report(node, SeverityError, fmt.Sprintf(format, args...))
+}
+
+func (p *pass) warnf(node ast.Node, format string, args ...any) {
+	p.report(node, SeverityWarning, fmt.Sprintf(format, args...))
+}
+
+func (p *pass) report(node ast.Node, severity Severity, message string) {
+	p.diags = append(p.diags, &Diagnostic{
+		Pos:      node.Pos(),
+		End:      node.End(),
+		Severity: severity,
+		Message:  message,
+	})
+}
+
+// assign checks that tv, the result of node, can be assigned to a location
+// of type to and returns it as stored there, converting untyped constants.
+// It reports an error at node if the assignment is not possible.
+func (p *pass) assign(node ast.Expr, tv *TypeAndValue, to Type, context string) *TypeAndValue {
+	from := tv.Type()
+	if isInvalid(from) || isInvalid(to) {
+		return tv
+	}
+	if lit, isConst := tv.Value().(*IntegerLiteral); isConst && isUntyped(tv) {
+		if toInt, isInt := Underlying(to).(*IntegerType); isInt {
+			if !toInt.Representable(lit.Value()) {
+				p.errorf(node, "constant %s overflows %s%s", lit, to, context)
+				return invalid()
+			}
+			converted := NewTypeAndValue(to, NewTypedIntegerLiteral(lit.Value(), toInt))
+			p.record(node, converted)
+			return converted
+		}
+	}
+	if lit, isString := tv.Value().(*StringLiteral); isString && isCString(to) {
+		converted := NewTypeAndValue(to, lit)
+		p.record(node, converted)
+		return converted
+	}
+	if !from.IsAssignableTo(to) {
+		p.errorf(node, "%s is not assignable to %s%s", from, to, context)
+		return invalid()
+	}
+	return tv
+}
+
+func (p *pass) record(expr ast.Expr, tv *TypeAndValue) {
+	if p.types == nil {
+		p.types = map[ast.Expr]*TypeAndValue{}
+	}
+	p.types[expr] = tv
+	if p.info != nil && p.info.Types != nil {
+		p.info.Types[expr] = tv
+	}
+}
+
+func (p *pass) recordScope(node ast.Node, scope *Scope) {
+	if p.info != nil && p.info.Scopes != nil {
+		p.info.Scopes[node] = scope
+	}
+}
+
+func invalid() *TypeAndValue { return NewTypeAndValue(Invalid, nil) }
+
 func (p *pass) module(m *ast.Module) *Module {
-	scope := NewScope(Universe, m.Pos(), m.End(), fmt.Sprintf("module %q", m.Name))
+	// The module has no position of its own, so its scope covers its
+	// declarations.
+	var pos, end token.Pos
+	if len(m.Decls) > 0 {
+		pos, end = m.Decls[0].Pos(), m.Decls[len(m.Decls)-1].End()
+	}
+	scope := NewScope(Universe, pos, end, fmt.Sprintf("module %q", m.Name))
+	p.recordScope(m, scope)
 	curModule := &Module{name: m.Name, scope: scope}
 	scope.module = curModule
 	p.cur = scope
 	p.scope = scope
+	p.collect(m.Decls)
+	// Methods are defined before the bindings are checked so that
+	// constants can call them regardless of order.
 	for _, decl := range m.Decls {
-		p.decl(decl)
+		if _, isBinding := decl.(*ast.Binding); !isBinding {
+			p.decl(decl)
+		}
+	}
+	for _, decl := range m.Decls {
+		if b, isBinding := decl.(*ast.Binding); isBinding {
+			p.resolve(p.decls[b])
+		}
+	}
+	for len(p.delayed) > 0 {
+		check := p.delayed[0]
+		p.delayed = p.delayed[1:]
+		check()
 	}
+	curModule.types, curModule.callArgs, curModule.funcBodies = p.types, p.callArgs, p.checkFuncBodies
+	curModule.deps = p.deps
 	p.scope = nil
 	p.cur = nil
 	return curModule
@@ -56,41 +229,170 @@ func (p *pass) decl(decl ast.Decl) {
 	switch decl := decl.(type) {
 	case *ast.Binding:
 		p.binding(decl)
+	case *ast.ImplDecl:
+		p.impl(decl)
 	default:
-		panic(fmt.Errorf("unhandled decl node %T", decl))
+		p.errorf(decl, "%s is not supported", describe(decl))
 	}
 }
 
 func (p *pass) binding(b *ast.Binding) {
-	var typeResult *TypeAndValue
-	var valueResult *TypeAndValue
-
 	sym := NewSymbol(b.Name.Name, NewTypeAndValue(nil, nil))
+	sym.pos, sym.visible = b.Name.Pos(), b.End()
+	sym.binding, sym.exported = b, b.Mode.Export()
+	p.bindingValue(b, sym)
+	if p.returnType != nil && (b.Token == token.Let || b.Token == token.Const) {
+		p.locals = append(p.locals, sym)
+		if b.Value == nil {
+			p.uninit[sym] = true
+		}
+	}
+
+	if p.info != nil && p.info.Defs != nil {
+		p.info.Defs[b.Name] = sym
+	}
+
+	if p.cur.Insert(sym) != nil {
+		p.errorf(b.Name, "%s redeclared in this scope", b.Name.Name)
+	}
+}
+
+// bindingValue checks the type and value of b and stores them in sym.
+func (p *pass) bindingValue(b *ast.Binding, sym *symbol) {
+	oldResultLocation := p.resultLocation
 	p.resultLocation = sym
+	defer func() { p.resultLocation = oldResultLocation }()
+
+	if b.Token == token.Struct || b.Token == token.Newtype {
+		// The type is bound before its underlying type is checked so that
+		// it can refer to itself.
+		named := NewNamed(sym, nil)
+		sym.tv.typ = named
+		sym.tv.val = NewTypeValue(named)
+		p.underlying(b.Value, named)
+		return
+	}
 
 	if b.Type != nil {
-		typeResult = p.expr(b.Type)
-		sym.tv.typ = typeResult.Value().(*TypeValue).Type()
+		sym.tv.typ = p.typeExpr(b.Type)
 	}
 
+	errs := len(p.diags)
 	if b.Value != nil {
-		valueResult = p.expr(b.Value)
-
-		if typeResult != nil && !valueResult.Type().IsAssignableTo(typeResult.Type()) {
-			panic(fmt.Errorf("%s is not assignable to %s", valueResult.Type(), typeResult.Type()))
-		} else {
+		valueResult := p.expr(b.Value)
+		switch {
+		case sym.tv.typ != nil:
+			valueResult = p.assign(b.Value, valueResult, sym.tv.typ, "")
+		case b.Token != token.Const && isUntyped(valueResult):
+			// Only constants may remain untyped.
+			valueResult = p.assign(b.Value, valueResult, defaultIntegerType, "")
+			sym.tv.typ = valueResult.Type()
+		default:
 			sym.tv.typ = valueResult.Type()
 		}
+		// A let may be assigned another value, so its initializer is not
+		// its value.
+		if b.Token != token.Let {
+			sym.tv.val = valueResult.Value()
+		}
+	}
 
-		sym.tv.val = valueResult.Value()
+	if sym.tv.typ == nil {
+		p.errorf(b.Name, "missing type or value for %s", b.Name.Name)
+		sym.tv.typ = Invalid
 	}
 
-	if p.info != nil && p.info.Defs != nil {
-		p.info.Defs[b.Name] = sym
+	// Module-level constants whose value the checker could not determine
+	// are evaluated at compile time.
+	if b.Token == token.Const && p.returnType == nil && p.cur == p.scope &&
+		b.Value != nil && sym.tv.val == nil && len(p.diags) == errs {
+		sym.tv.val = p.constant(sym, b.Value)
+	}
+}
+
+// A funcBody is the check of a function body, which runs at most once:
+// when the delayed checks run, or earlier if the function is called at
+// compile time.
+type funcBody struct {
+	check func()
+	state bodyState
+}
+
+type bodyState int
+
+const (
+	bodyUnchecked bodyState = iota
+	bodyChecking
+	bodyValid
+	bodyInvalid
+)
+
+// checkBody checks the body of the function declared by decl unless it has
+// been checked already, and returns the result.
+func (p *pass) checkBody(decl *ast.FuncExpr) bodyState {
+	body := p.bodies[decl]
+	if body == nil {
+		// The function was declared by an imported module, which has
+		// been checked in full.
+		return bodyValid
+	}
+	if body.state == bodyUnchecked {
+		body.state = bodyChecking
+		errs := p.diags.errorCount()
+		body.check()
+		body.state = bodyValid
+		if p.diags.errorCount() > errs {
+			body.state = bodyInvalid
+		}
+	}
+	return body.state
+}
+
+// impl adds the functions defined by decl to the method set of its type.
+func (p *pass) impl(decl *ast.ImplDecl) {
+	typ := p.typeExpr(decl.Type)
+	if isInvalid(typ) {
+		return
+	}
+	named, isNamed := typ.(*Named)
+	if !isNamed {
+		p.errorf(decl.Type, "cannot define methods on %s, which is not a named type", typ)
+		return
+	}
+	if scope := named.Symbol().Scope(); scope != nil && scope.module != p.scope.module {
+		p.errorf(decl.Type, "cannot define methods on %s, which is declared in module %s", typ, scope.module.Name())
+		return
+	}
+	if len(decl.Traits) > 0 {
+		p.errorf(decl.Traits[0], "implementing traits is not supported")
 	}
 
-	p.resultLocation = nil
-	p.cur.Insert(sym)
+	structType, _ := named.Underlying().(*StructType)
+	for _, def := range decl.Definitions {
+		if def.Token != token.Func {
+			p.errorf(def.Name, "%s is not a function, only methods can be defined in an impl", def.Name.Name)
+			continue
+		}
+		sym := NewSymbol(def.Name.Name, NewTypeAndValue(nil, nil))
+		sym.pos, sym.scope, sym.recv = def.Name.Pos(), p.cur, named
+		p.bindingValue(def, sym)
+		if p.info != nil && p.info.Defs != nil {
+			p.info.Defs[def.Name] = sym
+		}
+
+		name := def.Name.Name
+		fn, isFunc := sym.Value().(*Function)
+		switch {
+		case !isFunc:
+			p.errorf(def.Name, "method %s.%s has no body", named, name)
+		case named.Method(name) != nil:
+			p.errorf(def.Name, "method %s.%s redeclared", named, name)
+		case structType != nil && structType.Member(name) != nil:
+			p.errorf(def.Name, "%s has both a member and a method called %s", named, name)
+		default:
+			named.methods = append(named.methods, fn)
+		}
+	}
 }
 
 func (p *pass) stmt(stmt ast.Stmt) {
@@ -106,12 +408,38 @@ func (p *pass) stmt(stmt ast.Stmt) {
 
 func (p *pass) expr(expr ast.Expr) *TypeAndValue {
 	tv := p.expr2(expr)
-	if tv.Type() != nil && p.info != nil && p.info.Types != nil {
-		p.info.Types[expr] = tv
-	}
+	p.record(expr, tv)
 	return tv
 }
 
+// typeExpr checks expr and returns the type it denotes, or Invalid if it
+// does not denote one.
+func (p *pass) typeExpr(expr ast.Expr) Type {
+	tv := p.expr(expr)
+	if isInvalid(tv.Type()) {
+		return Invalid
+	}
+	typeValue, isType := tv.Value().(*TypeValue)
+	if !isType {
+		p.errorf(expr, "%s is not a type", describe(expr))
+		return Invalid
+	}
+	return typeValue.Type()
+}
+
+// integerType returns the integer type called name, or nil if there is
+// none. Like NewIntegerTypeFromName, it fails for names with too many bits.
+func (p *pass) integerType(name string) (*IntegerType, error) {
+	switch name {
+	case "usize":
+		return p.target.SizeType(false), nil
+	case "isize":
+		return p.target.SizeType(true), nil
+	default:
+		return NewIntegerTypeFromName(name)
+	}
+}
+
 func (p *pass) expr2(expr ast.Expr) *TypeAndValue {
 	switch expr := expr.(type) {
 	case *ast.Literal:
@@ -119,32 +447,54 @@ func (p *pass) expr2(expr ast.Expr) *TypeAndValue {
 		case token.String:
 			value, err := strconv.Unquote(expr.Value)
 			if err != nil {
-				panic(err)
+				p.errorf(expr, "invalid string literal %s", expr.Value)
+				return invalid()
 			}
 			val := NewStringLiteral(value)
 			return NewTypeAndValue(val.Type(), val)
 		case token.Integer:
 			value, err := NewIntegerLiteralFromString(expr.Value)
 			if err != nil {
-				panic(err)
+				p.errorf(expr, "%v", err)
+				return invalid()
 			}
 			return NewTypeAndValue(value.Type(), value)
 		default:
 			panic(fmt.Errorf("unknown token %q for literal", expr.Tok))
 		}
 	case *ast.Identifier:
-		integer := NewIntegerTypeFromName(expr.Name)
+		integer, err := p.integerType(expr.Name)
+		if err != nil {
+			p.errorf(expr, "%v", err)
+			return invalid()
+		}
 		if integer != nil {
 			return NewTypeAndValue(integer, NewTypeValue(integer))
 		}
 		sym := p.cur.Lookup(expr.Name)
-		if sym != nil {
-			if p.info != nil && p.info.Uses != nil {
-				p.info.Uses[expr] = sym
+		if sym == nil {
+			p.errorf(expr, "undefined: %s", expr.Name)
+			return invalid()
+		}
+		if p.info != nil && p.info.Uses != nil {
+			p.info.Uses[expr] = sym
+		}
+		// Symbols of Universe and imported modules are shared with other
+		// checks and are never marked.
+		if local, isSymbol := sym.(*symbol); isSymbol && local.scope.module == p.scope.module {
+			local.used = true
+			if p.uninit[local] {
+				p.errorf(expr, "%s is used before it is initialized", expr.Name)
+				delete(p.uninit, local)
 			}
-			return NewTypeAndValue(sym.Type(), sym.Value())
 		}
-		return nil
+		if d := p.declOf(sym); d != nil {
+			p.resolve(d)
+		}
+		if sym.Type() == nil {
+			return invalid()
+		}
+		return NewTypeAndValue(sym.Type(), sym.Value())
 	case *ast.FuncExpr:
 		var comment string
 		if p.resultLocation != nil {
@@ -153,35 +503,98 @@ func (p *pass) expr2(expr ast.Expr) *TypeAndValue {
 			comment = "func"
 		}
 
-		funcScope := NewScope(p.cur, token.NoPos, token.NoPos, comment)
+		funcScope := NewScope(p.cur, expr.Pos(), expr.End(), comment)
+		funcScope.fn = p.resultLocation
+		p.recordScope(expr, funcScope)
 		p.cur = funcScope
 		defer func() {
 			p.cur = funcScope.parent
 		}()
 
 		params := make([]*NameAndType, 0, len(expr.Params))
-		for _, param := range expr.Params {
-			typ := p.expr(param.Type).Value().(*TypeValue).Type()
-			tv := NewNameAndType(param.Name.Name, typ)
+		variadic := false
+		for i, param := range expr.Params {
+			if _, isVarArg := param.Type.(*ast.VarArgExpr); isVarArg {
+				if i != len(expr.Params)-1 {
+					p.errorf(param, "... must be the last parameter")
+				}
+				variadic = true
+				continue
+			}
+			typ := p.typeExpr(param.Type)
+			var name string
+			if param.Name != nil {
+				name = param.Name.Name
+			}
+			tv := NewNameAndType(name, typ)
+			tv.def = p.defaultValue(param.Default, name, typ)
 			params = append(params, tv)
-			funcScope.Insert(NewSymbol(tv.Name(), NewTypeAndValue(tv.Type(), nil)))
+			if param.Name == nil {
+				continue
+			}
+			sym := NewSymbol(tv.Name(), NewTypeAndValue(tv.Type(), nil))
+			sym.pos, sym.visible = param.Name.Pos(), param.End()
+			sym.param = true
+			if p.info != nil && p.info.Defs != nil {
+				p.info.Defs[param.Name] = sym
+			}
+			if funcScope.Insert(sym) != nil {
+				p.errorf(param.Name, "duplicate parameter %s", name)
+			}
 		}
-		returnType := p.expr(expr.ReturnType).Value().(*TypeValue).Type()
-		sig := NewSignature(params, returnType)
+		returnType := p.typeExpr(expr.ReturnType)
+		sig := newSignature(params, returnType, variadic)
 		if expr.Body == nil {
 			return NewTypeAndValue(sig, NewTypeValue(sig))
 		}
+		if variadic {
+			p.errorf(expr, "only external functions can be variadic")
+		}
+		var name string
+		if p.resultLocation != nil {
+			name = p.resultLocation.Name()
+		}
+		fn := NewFunction(name, sig, expr, funcScope.parent)
+		if p.bodies == nil {
+			p.bodies = map[*ast.FuncExpr]*funcBody{}
+		}
+		p.bodies[expr] = &funcBody{check: func() {
+			oldCur, oldReturnType, oldResultLocation := p.cur, p.returnType, p.resultLocation
+			oldLocals, oldUninit, oldLoops := p.locals, p.uninit, p.loops
+			p.cur, p.returnType, p.resultLocation = funcScope, returnType, nil
+			p.locals, p.uninit, p.loops = nil, map[*symbol]bool{}, 0
+			defer func() {
+				p.cur, p.returnType, p.resultLocation = oldCur, oldReturnType, oldResultLocation
+				p.locals, p.uninit, p.loops = oldLocals, oldUninit, oldLoops
+			}()
+			p.stmts(expr.Body.List)
+			p.unusedLocals()
+			p.flow(expr.Body, returnType)
+		}}
 		if p.checkFuncBodies {
-			oldReturnType := p.returnType
-			p.returnType = returnType
-			defer func() { p.returnType = oldReturnType }()
-			for _, stmt := range expr.Body.List {
-				p.stmt(stmt)
+			// Bodies of module-level functions are checked once every
+			// declaration has been resolved, so that they may refer to
+			// functions declared after them and to themselves.
+			if p.returnType == nil {
+				p.delayed = append(p.delayed, func() { p.checkBody(expr) })
+			} else {
+				p.checkBody(expr)
 			}
 		}
-		return NewTypeAndValue(sig, nil)
+		return NewTypeAndValue(sig, fn)
 	case *ast.ManyPointerExpr:
-		typ := NewManyPointer(p.expr(expr.Base).Value().(*TypeValue).Type())
+		typ := p.typeExpr(expr.Base)
+		if isInvalid(typ) {
+			return invalid()
+		}
+		typ = NewManyPointer(typ)
+		return NewTypeAndValue(typ, NewTypeValue(typ))
+	case *ast.SliceExpr:
+		typ := p.typeExpr(expr.Base)
+		if isInvalid(typ) {
+			return invalid()
+		}
+		typ = NewSliceType(typ)
 		return NewTypeAndValue(typ, NewTypeValue(typ))
 	case *ast.CallExpr:
 		base := p.expr(expr.Base)
@@ -189,151 +602,1003 @@ func (p *pass) expr2(expr ast.Expr) *TypeAndValue {
 		for _, argNode := range expr.Args {
 			args = append(args, p.expr(argNode))
 		}
-		return p.call(base, args)
+		return p.call(expr, base, args)
 	case *ast.MemberExpr:
 		base := p.expr(expr.Base)
-		return p.member(base, expr.Member.Name)
+		return p.member(expr, base)
 	case *ast.StructExpr:
-		members := make([]*NameAndType, 0, len(expr.Members))
-		for _, member := range expr.Members {
-			name := member.Name.Name
-			typ := p.expr(member.Type).Value().(*TypeValue).Type()
-			members = append(members, NewNameAndType(name, typ))
-		}
-		typ := NewStructType(members)
+		typ := NewStructType(p.members(expr.Members, newPlaceholderType()))
 		return NewTypeAndValue(typ, NewTypeValue(typ))
+	case *ast.UnionExpr:
+		typ := NewUnionType(p.members(expr.Members, newPlaceholderType()))
+		return NewTypeAndValue(typ, NewTypeValue(typ))
+	case *ast.ArrayExpr:
+		return p.array(expr)
 	case *ast.ReturnExpr:
-		value := p.expr(expr.Value)
-		if !value.Type().IsAssignableTo(p.returnType) {
-			panic(fmt.Errorf("%s is not assignable to return type %s", value.Type(), p.returnType))
+		if p.returnType == nil {
+			p.errorf(expr, "return outside of a function body")
+			return invalid()
+		}
+		if isNever(p.returnType) {
+			p.errorf(expr, "return in a function declared noreturn")
+			if expr.Value != nil {
+				p.expr(expr.Value)
+			}
+			return NewTypeAndValue(Never, nil)
+		}
+		if expr.Value == nil {
+			if !isVoid(p.returnType) && !isInvalid(p.returnType) {
+				p.errorf(expr, "missing return value of type %s", p.returnType)
+			}
+			return NewTypeAndValue(Never, nil)
 		}
-		return NewTypeAndValue(NewIntegerType(false, 0), value.Value())
+		p.assign(expr.Value, p.expr(expr.Value), p.returnType, " in return statement")
+		return NewTypeAndValue(Never, nil)
+	case *ast.BreakExpr:
+		if p.loops == 0 {
+			p.errorf(expr, "break outside of a loop")
+		}
+		return NewTypeAndValue(Never, nil)
 	case *ast.BinaryExpr:
+		if expr.Op == token.Assign {
+			p.assignment(expr)
+			return NewTypeAndValue(NewIntegerType(false, 0), nil)
+		}
 		left := p.expr(expr.Left)
 		right := p.expr(expr.Right)
 		switch expr.Op {
-		case token.Plus:
-			l, isLeftInt := left.Type().(*IntegerType)
-			r, isRightInt := right.Type().(*IntegerType)
-			if !isLeftInt || !isRightInt || !l.Equal(r) {
-				panic(fmt.Errorf("cannot add %s and %s", left.Type(), right.Type()))
+		case token.Plus, token.Minus:
+			left, right, ok := p.operands(expr, left, right)
+			if !ok {
+				return invalid()
 			}
-			if left.Value() != nil && right.Value() != nil {
-				l := left.Value().(*IntegerLiteral)
-				r := right.Value().(*IntegerLiteral)
-				value := NewIntegerLiteral(l.Value().Add(l.Value(), r.Value()))
-				return NewTypeAndValue(value.Type(), value)
+			lv, isLeftConst := left.Value().(*IntegerLiteral)
+			rv, isRightConst := right.Value().(*IntegerLiteral)
+			if isLeftConst && isRightConst {
+				value, err := foldBinary(expr.Op, lv, rv)
+				if err != nil {
+					p.errorf(expr, "constant overflow: %v", err)
+					return invalid()
+				}
+				if isUntyped(left) {
+					return NewTypeAndValue(value.Type(), value)
+				}
+				return NewTypeAndValue(left.Type(), value)
 			}
-			return NewTypeAndValue(l, nil)
-		case token.Assign:
-			leftType := left.Type()
-			rightType := right.Type()
-			if !rightType.IsAssignableTo(leftType) {
-				panic(fmt.Errorf("%s is not assignable to %s", rightType, leftType))
+			return NewTypeAndValue(left.Type(), nil)
+		case token.Less, token.LessEqual, token.Greater, token.GreaterEqual, token.Equal, token.NotEqual:
+			left, right, ok := p.operands(expr, left, right)
+			if !ok {
+				return invalid()
 			}
-			return NewTypeAndValue(NewIntegerType(false, 0), nil)
+			if isConstant(left.Value()) && isConstant(right.Value()) {
+				return NewTypeAndValue(Bool, compare(expr.Op, left.Value(), right.Value()))
+			}
+			return NewTypeAndValue(Bool, nil)
 		default:
-			panic(fmt.Sprintf("unexpected token.Type: %#v", expr.Op))
+			p.errorf(expr, "operator %s is not supported", expr.Op)
+			return invalid()
 		}
+	case *ast.UnaryExpr:
+		base := p.expr(expr.Base)
+		switch expr.Op {
+		case token.Minus:
+			return p.negate(expr, base)
+		case token.Bang:
+			return p.not(expr, base)
+		default:
+			p.errorf(expr, "operator %s is not supported", expr.Op)
+			return invalid()
+		}
+	case *ast.BlockExpr:
+		p.block(expr)
+		return NewTypeAndValue(NewIntegerType(false, 0), nil)
+	case *ast.IfExpr:
+		p.condition(expr.Cond)
+		p.conditionalBlock(expr.Block)
+		return NewTypeAndValue(NewIntegerType(false, 0), nil)
+	case *ast.WhileExpr:
+		p.condition(expr.Cond)
+		p.loops++
+		p.conditionalBlock(expr.Block)
+		p.loops--
+		return NewTypeAndValue(NewIntegerType(false, 0), nil)
 	case *ast.NamedArg:
 		arg := NewNamedArgument(expr.Name.Name, p.expr(expr.Value))
 		return NewTypeAndValue(arg.Type(), arg.Value())
+	case *ast.BadExpr:
+		return invalid()
 	default:
-		panic(fmt.Errorf("unhandled expr node %T", expr))
+		p.errorf(expr, "%s is not supported", describe(expr))
+		return invalid()
 	}
 }
 
-func (p *pass) member(base *TypeAndValue, member string) *TypeAndValue {
-	if moduleImport, isImport := base.Value().(*ModuleImport); isImport {
-		sym := moduleImport.Module().Scope().Lookup(member)
+// underlying checks expr, the underlying type of named.
+func (p *pass) underlying(expr ast.Expr, named *Named) {
+	// While the members of a struct or union are checked, a placeholder
+	// stands for the underlying type so that members depending on named
+	// can be found.
+	var typ Type
+	switch expr := expr.(type) {
+	case *ast.StructExpr:
+		named.underlying = newPlaceholderType()
+		typ = NewStructType(p.members(expr.Members, named))
+	case *ast.UnionExpr:
+		named.underlying = newPlaceholderType()
+		typ = NewUnionType(p.members(expr.Members, named))
+	}
+	if typ != nil {
+		named.underlying = typ
+		p.record(expr, NewTypeAndValue(typ, NewTypeValue(typ)))
+		return
+	}
+
+	typ = p.typeExpr(expr)
+	if other, isNamed := typ.(*Named); isNamed && other.underlying == nil {
+		// other is still being declared, so it must depend on named.
+		path := []string{other.String()}
+		if i := slices.IndexFunc(p.path, func(d *declInfo) bool { return d.sym == other.sym }); i >= 0 {
+			path = nil
+			for _, d := range p.path[i:] {
+				path = append(path, d.String())
+			}
+		}
+		p.errorf(expr, "invalid recursive type: %s", cyclePath(path, func(name string) string { return name }))
+		typ = Invalid
+	}
+	named.underlying = Underlying(typ)
+}
+
+// members checks the members of decl, a struct or union type or a named
+// type with one as its underlying type.
+func (p *pass) members(fields []*ast.Field, decl Type) []*NameAndType {
+	p.aggregates = append(p.aggregates, decl)
+	defer func() { p.aggregates = p.aggregates[:len(p.aggregates)-1] }()
+
+	members := make([]*NameAndType, 0, len(fields))
+	for _, member := range fields {
+		name := member.Name.Name
+		if slices.ContainsFunc(members, func(m *NameAndType) bool { return m.Name() == name }) {
+			p.errorf(member.Name, "duplicate member %s", name)
+		}
+		memberType := p.typeExpr(member.Type)
+		// Members contain arrays by value, so they must not contain
+		// the type being declared either.
+		contained := Underlying(memberType)
+		for {
+			array, isArray := contained.(*ArrayType)
+			if !isArray {
+				break
+			}
+			contained = Underlying(array.Element())
+		}
+		i := slices.IndexFunc(p.aggregates, func(typ Type) bool { return Underlying(typ) == contained })
+		if i >= 0 {
+			p.errorf(member.Type, "invalid recursive type: %s", cyclePath(p.aggregates[i:], func(typ Type) string { return fmt.Sprint(typ) }))
+			memberType = Invalid
+		}
+		nt := NewNameAndType(name, memberType)
+		nt.def = p.defaultValue(member.Default, name, memberType)
+		members = append(members, nt)
+	}
+	return members
+}
+
+// defaultValue checks def, the default value of the parameter or member
+// name, and returns its value, or nil if there is none.
+func (p *pass) defaultValue(def ast.Expr, name string, typ Type) Value {
+	if def == nil {
+		return nil
+	}
+	tv := p.expr(def)
+	if isInvalid(tv.Type()) {
+		return nil
+	}
+	if tv.Value() == nil {
+		p.errorf(def, "default value for %s must be a constant", name)
+		return nil
+	}
+	return p.assign(def, tv, typ, fmt.Sprintf(" in default value for %s", name)).Value()
+}
+
+func (p *pass) array(expr *ast.ArrayExpr) *TypeAndValue {
+	length := p.expr(expr.Len)
+	elem := p.typeExpr(expr.Base)
+	if isInvalid(length.Type()) || isInvalid(elem) {
+		return invalid()
+	}
+	lit, isConst := length.Value().(*IntegerLiteral)
+	if !isConst {
+		p.errorf(expr.Len, "array length %s must be a constant integer", describe(expr.Len))
+		return invalid()
+	}
+	if lit.Value().Sign() < 0 || !lit.Value().IsInt64() {
+		p.errorf(expr.Len, "invalid array length %s", lit)
+		return invalid()
+	}
+	n := lit.Value().Int64()
+	if size := p.sizes.Sizeof(elem); size > 0 && n > math.MaxInt64/size {
+		p.errorf(expr, "array type [%d]%s is too large", n, elem)
+		return invalid()
+	}
+	typ := NewArrayType(elem, n)
+	return NewTypeAndValue(typ, NewTypeValue(typ))
+}
+
+// operands checks that left and right are integers of the same type,
+// giving an untyped constant operand the type of the other operand, or
+// bools compared for equality.
+func (p *pass) operands(expr *ast.BinaryExpr, left, right *TypeAndValue) (*TypeAndValue, *TypeAndValue, bool) {
+	if isInvalid(left.Type()) || isInvalid(right.Type()) {
+		return left, right, false
+	}
+	// An operand that never produces a value takes the type of the other.
+	switch {
+	case isNever(left.Type()) && !isNever(right.Type()):
+		left = NewTypeAndValue(right.Type(), nil)
+	case isNever(right.Type()) && !isNever(left.Type()):
+		right = NewTypeAndValue(left.Type(), nil)
+	}
+	if isBool(left.Type()) && left.Type().Equal(right.Type()) {
+		if expr.Op == token.Equal || expr.Op == token.NotEqual {
+			return left, right, true
+		}
+		p.errorf(expr, "operator %s is not defined on %s", expr.Op, left.Type())
+		return left, right, false
+	}
+	if isInteger(left.Type()) && isInteger(right.Type()) {
+		switch {
+		case isUntyped(left) && !isUntyped(right):
+			left = p.assign(expr.Left, left, right.Type(), "")
+			return left, right, !isInvalid(left.Type())
+		case !isUntyped(left) && isUntyped(right):
+			right = p.assign(expr.Right, right, left.Type(), "")
+			return left, right, !isInvalid(right.Type())
+		case left.Type().Equal(right.Type()):
+			return left, right, true
+		}
+	}
+	verb := "compare"
+	switch expr.Op {
+	case token.Plus:
+		verb = "add"
+	case token.Minus:
+		verb = "subtract"
+	}
+	p.errorf(expr, "cannot %s %s and %s", verb, left.Type(), right.Type())
+	return left, right, false
+}
+
+func (p *pass) negate(expr *ast.UnaryExpr, base *TypeAndValue) *TypeAndValue {
+	switch typ := Underlying(base.Type()).(type) {
+	case *InvalidType:
+		return invalid()
+	case *IntegerType:
+		if !typ.Signed() {
+			p.errorf(expr, "cannot negate unsigned %s", base.Type())
+			return invalid()
+		}
+	case *UntypedIntegerType:
+	default:
+		p.errorf(expr, "cannot negate %s", base.Type())
+		return invalid()
+	}
+	if v, isConst := base.Value().(*IntegerLiteral); isConst {
+		negated, err := negate(v)
+		if err != nil {
+			p.errorf(expr, "constant overflow: %v", err)
+			return invalid()
+		}
+		return NewTypeAndValue(base.Type(), negated)
+	}
+	return NewTypeAndValue(base.Type(), nil)
+}
+
+func (p *pass) not(expr *ast.UnaryExpr, base *TypeAndValue) *TypeAndValue {
+	if isInvalid(base.Type()) {
+		return invalid()
+	}
+	if !isBool(base.Type()) {
+		p.errorf(expr, "operator ! is not defined on %s", base.Type())
+		return invalid()
+	}
+	if v, isConst := base.Value().(*BoolLiteral); isConst {
+		return NewTypeAndValue(base.Type(), NewBoolLiteral(!v.Value()))
+	}
+	return NewTypeAndValue(base.Type(), nil)
+}
+
+func (p *pass) condition(expr ast.Expr) {
+	cond := p.expr(expr)
+	if !isBool(cond.Type()) && !isInvalid(cond.Type()) {
+		p.errorf(expr, "condition must be bool, not %s", cond.Type())
+	}
+}
+
+func (p *pass) block(block *ast.BlockExpr) {
+	scope := NewScope(p.cur, block.Pos(), block.End(), "block")
+	p.recordScope(block, scope)
+	p.cur = scope
+	defer func() { p.cur = scope.parent }()
+	p.stmts(block.List)
+}
+
+// conditionalBlock checks block, which may not run, so the lets it
+// initializes are not definitely initialized after it.
+func (p *pass) conditionalBlock(block *ast.BlockExpr) {
+	uninit := maps.Clone(p.uninit)
+	p.block(block)
+	p.uninit = uninit
+}
+
+// assignment checks expr, an assignment to a place.
+func (p *pass) assignment(expr *ast.BinaryExpr) {
+	left, root := p.place(expr.Left)
+	right := p.expr(expr.Right)
+	p.assign(expr.Right, right, left.Type(), "")
+	if root == nil {
+		return
+	}
+	if _, isWhole := expr.Left.(*ast.Identifier); isWhole && p.uninit[root] {
+		delete(p.uninit, root)
+		return
+	}
+	root.mutated = true
+}
+
+// place checks expr, the target of an assignment, which must be a let
+// binding or a member of one. It returns the type of expr and the binding,
+// or nil if expr is not a place.
+func (p *pass) place(expr ast.Expr) (*TypeAndValue, *symbol) {
+	switch target := expr.(type) {
+	case *ast.Identifier:
+		if integer, err := p.integerType(target.Name); integer != nil || err != nil {
+			break
+		}
+		sym := p.cur.Lookup(target.Name)
 		if sym == nil {
-			panic(fmt.Errorf("member %q not found in module", member))
+			p.errorf(target, "undefined: %s", target.Name)
+			return invalid(), nil
+		}
+		if p.info != nil && p.info.Uses != nil {
+			p.info.Uses[target] = sym
+		}
+		if d := p.declOf(sym); d != nil {
+			p.resolve(d)
+		}
+		local, isSymbol := sym.(*symbol)
+		switch {
+		case isSymbol && local.param:
+			p.errorf(target, "cannot assign to parameter %s", target.Name)
+		case isSymbol && local.binding != nil && local.binding.Token == token.Const:
+			p.errorf(target, "cannot assign to constant %s", target.Name)
+		case isSymbol && local.binding != nil && local.binding.Token == token.Let:
+			tv := NewTypeAndValue(sym.Type(), nil)
+			if sym.Type() == nil {
+				tv = invalid()
+			}
+			p.record(target, tv)
+			return tv, local
+		default:
+			p.errorf(target, "cannot assign to %s", target.Name)
+		}
+		return invalid(), nil
+	case *ast.MemberExpr:
+		base, root := p.place(target.Base)
+		if root == nil {
+			return invalid(), nil
+		}
+		// Assigning to a member reads the rest of the binding.
+		root.used = true
+		if p.uninit[root] {
+			p.errorf(target.Base, "%s is used before it is initialized", root.Name())
+			delete(p.uninit, root)
+		}
+		tv := p.member(target, base)
+		p.record(target, tv)
+		return tv, root
+	}
+	p.expr(expr)
+	p.errorf(expr, "cannot assign to %s", describe(expr))
+	return invalid(), nil
+}
+
+// unusedLocals warns about the locals of the function body just checked
+// that are never used, and about lets that could be consts.
+func (p *pass) unusedLocals() {
+	for _, sym := range p.locals {
+		switch {
+		case !sym.used:
+			p.warnf(sym.binding.Name, "%s declared and not used", sym.Name())
+		case sym.binding.Token == token.Let && sym.binding.Value != nil && !sym.mutated:
+			p.warnf(sym.binding.Name, "%s is never mutated, declare it with const", sym.Name())
+		}
+	}
+}
+
+func (p *pass) stmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		p.stmt(stmt)
+	}
+}
+
+func (p *pass) member(expr *ast.MemberExpr, base *TypeAndValue) *TypeAndValue {
+	member := expr.Member.Name
+	if isInvalid(base.Type()) {
+		return invalid()
+	}
+
+	if moduleImport, isImport := base.Value().(*ModuleImport); isImport {
+		module := moduleImport.Module()
+		sym := module.scope.symbols[member]
+		switch {
+		case sym == nil:
+			p.errorf(expr.Member, "member %q not found in module %q", member, module.Name())
+			return invalid()
+		case !sym.Exported():
+			p.errorf(expr.Member, "%s is not exported by module %s", member, module.Name())
+			return invalid()
 		}
 		return NewTypeAndValue(sym.Type(), sym.Value())
 	}
 
-	if structType, isStruct := base.Type().(*StructType); isStruct {
-		for _, field := range structType.Members() {
-			if field.name == member {
-				return NewTypeAndValue(field.Type(), nil)
+	if typeValue, isType := base.Value().(*TypeValue); isType {
+		if named, isNamed := typeValue.Type().(*Named); isNamed {
+			if method := named.Method(member); method != nil {
+				return NewTypeAndValue(method.Type(), method)
 			}
+			p.errorf(expr.Member, "%s has no method %q", named, member)
+			return invalid()
 		}
 	}
 
-	panic(fmt.Errorf("unhandled base %q for member expression", base))
+	var field *NameAndType
+	switch typ := Underlying(base.Type()).(type) {
+	case *StructType:
+		field = typ.Member(member)
+	case *UnionType:
+		field = typ.Member(member)
+	default:
+		p.errorf(expr, "%s has no members", base.Type())
+		return invalid()
+	}
+	if field == nil {
+		p.errorf(expr.Member, "%s has no member %q", base.Type(), member)
+		return invalid()
+	}
+	return NewTypeAndValue(field.Type(), nil)
 }
 
-func (p *pass) call(base *TypeAndValue, args []*TypeAndValue) *TypeAndValue {
+func (p *pass) call(expr *ast.CallExpr, base *TypeAndValue, args []*TypeAndValue) *TypeAndValue {
+	if isInvalid(base.Type()) {
+		return invalid()
+	}
+
 	if builtin, isBuiltin := base.Value().(*Builtin); isBuiltin {
-		return p.builtin(builtin, args)
+		return p.builtin(expr, builtin, args)
 	}
 
 	if sig, isSig := base.Type().(*Signature); isSig {
+		callee := describe(expr.Base)
+		mapping, ok := p.arguments(expr, callee, sig.Params(), args, sig.Variadic())
+		if !ok {
+			return NewTypeAndValue(sig.ReturnType(), nil)
+		}
+		for i, arg := range mapping {
+			if arg >= 0 {
+				p.assign(p.argumentValue(expr.Args[arg]), args[arg], sig.Params()[i].Type(), " in argument to "+callee)
+			}
+		}
+		for i := len(sig.Params()); i < len(expr.Args); i++ {
+			if _, isNamed := expr.Args[i].(*ast.NamedArg); !isNamed {
+				p.promote(expr.Args[i], args[i])
+			}
+		}
 		return NewTypeAndValue(sig.ReturnType(), nil)
 	}
 
-	if structType, isStruct := base.Value().(*TypeValue).Type().(*StructType); isStruct {
-		if len(args) != len(structType.Members()) {
-			panic(fmt.Errorf("wrong arguments for struct constructor"))
+	if typeValue, isType := base.Value().(*TypeValue); isType {
+		typ := typeValue.Type()
+		if structType, isStruct := Underlying(typ).(*StructType); isStruct {
+			mapping, ok := p.arguments(expr, fmt.Sprint(typ), structType.Members(), args, false)
+			if !ok {
+				return NewTypeAndValue(typ, nil)
+			}
+
+			for i, arg := range mapping {
+				if arg >= 0 {
+					p.assign(p.argumentValue(expr.Args[arg]), args[arg], structType.Members()[i].Type(), "")
+				}
+			}
+
+			return NewTypeAndValue(typ, nil)
 		}
+	}
+
+	p.errorf(expr.Base, "cannot call %s of type %s", describe(expr.Base), base.Type())
+	return invalid()
+}
 
-		for i := range args {
-			if !args[i].typ.IsAssignableTo(structType.Members()[i].Type()) {
-				panic(fmt.Errorf("%s is not assignable to %s", args[i].typ, structType.Members()[i].Type()))
+// arguments matches the arguments of call to params, the parameters of
+// callee. Positional arguments come first and are matched in order; named
+// arguments are matched by name. The result holds the index in call.Args
+// of the argument for each parameter, or -1 if it takes its default value.
+// Positional arguments beyond the parameters are an error unless extra is
+// set.
+func (p *pass) arguments(call *ast.CallExpr, callee string, params []*NameAndType, args []*TypeAndValue, extra bool) ([]int, bool) {
+	mapping := make([]int, len(params))
+	for i := range mapping {
+		mapping[i] = -1
+	}
+
+	ok := true
+	named := false
+	for i, arg := range call.Args {
+		namedArg, isNamed := arg.(*ast.NamedArg)
+		if !isNamed {
+			if named {
+				p.errorf(arg, "positional argument %s follows named arguments", describe(arg))
+				ok = false
+				continue
+			}
+			if i >= len(params) {
+				if extra {
+					continue
+				}
+				p.errorf(call, "wrong number of arguments for %s: got %d, want %d", callee, len(args), len(params))
+				return nil, false
 			}
+			mapping[i] = i
+			continue
 		}
 
-		return NewTypeAndValue(structType, nil)
+		named = true
+		name := namedArg.Name.Name
+		index := slices.IndexFunc(params, func(param *NameAndType) bool { return param.Name() == name })
+		switch {
+		case index < 0:
+			p.errorf(namedArg.Name, "%s has no parameter named %s", callee, name)
+			ok = false
+		case mapping[index] >= 0:
+			p.errorf(namedArg.Name, "duplicate argument %s in call to %s", name, callee)
+			ok = false
+		default:
+			mapping[index] = i
+		}
+	}
+
+	if !ok {
+		return nil, false
+	}
+	for i, param := range params {
+		if mapping[i] < 0 && param.Default() == nil {
+			p.errorf(call, "missing argument %s in call to %s", param.Name(), callee)
+			ok = false
+		}
+	}
+	if !ok {
+		return nil, false
+	}
+
+	resolved := make([]ast.Expr, len(params))
+	for i, arg := range mapping {
+		if arg >= 0 {
+			resolved[i] = p.argumentValue(call.Args[arg])
+		}
+	}
+	if p.callArgs == nil {
+		p.callArgs = map[*ast.CallExpr][]ast.Expr{}
+	}
+	p.callArgs[call] = resolved
+	if p.info != nil && p.info.Arguments != nil {
+		p.info.Arguments[call] = resolved
+	}
+	return mapping, true
+}
+
+// promote applies the C default argument promotions to arg, an argument
+// passed to the ... parameter of an external function, and records its
+// promoted type: constants without a type, bools and integers narrower than
+// i32 become i32, and string literals become [*]u8.
+func (p *pass) promote(arg ast.Expr, tv *TypeAndValue) *TypeAndValue {
+	typ := tv.Type()
+	switch {
+	case isInvalid(typ):
+		return tv
+	case isUntyped(tv):
+		return p.assign(arg, tv, cInt, " in variadic argument")
+	case isBool(typ), isInteger(typ) && Underlying(typ).(*IntegerType).bits < cInt.bits:
+		promoted := NewTypeAndValue(cInt, nil)
+		switch value := tv.Value().(type) {
+		case *IntegerLiteral:
+			promoted = NewTypeAndValue(cInt, NewTypedIntegerLiteral(value.Value(), cInt))
+		case *BoolLiteral:
+			n := int64(0)
+			if value.Value() {
+				n = 1
+			}
+			promoted = NewTypeAndValue(cInt, NewTypedIntegerLiteral(big.NewInt(n), cInt))
+		}
+		p.record(arg, promoted)
+		return promoted
+	case isInteger(typ):
+		return tv
+	}
+	switch Underlying(typ).(type) {
+	case *Pointer:
+		return tv
+	case *SliceType:
+		if _, isString := tv.Value().(*StringLiteral); isString {
+			return p.assign(arg, tv, NewManyPointer(NewIntegerType(false, 8)), " in variadic argument")
+		}
 	}
+	p.errorf(arg, "cannot pass %s as a variadic argument", typ)
+	return invalid()
+}
 
-	panic(fmt.Errorf("unhandled base for call: %T", base.Type()))
+// argumentValue returns the value of arg, without its name if it is a named
+// argument.
+func (p *pass) argumentValue(arg ast.Expr) ast.Expr {
+	if named, isNamed := arg.(*ast.NamedArg); isNamed {
+		return named.Value
+	}
+	return arg
 }
 
-func (p *pass) builtin(builtin *Builtin, args []*TypeAndValue) *TypeAndValue {
+func (p *pass) builtin(expr *ast.CallExpr, builtin *Builtin, args []*TypeAndValue) *TypeAndValue {
 	switch builtin.id {
 	case BuiltinImport:
 		if len(args) != 1 {
-			panic(fmt.Errorf("Incorrect number of args for %s", builtin))
+			p.errorf(expr, "wrong number of arguments for %s: got %d, want 1", builtin, len(args))
+			return invalid()
+		}
+		name, ok := p.stringArgument(expr.Args[0], args[0], builtin)
+		if !ok {
+			return invalid()
 		}
-		name := args[0].Value().(*StringLiteral).Value()
 		if p.importer == nil {
-			panic(fmt.Errorf("@import used but no importer is set"))
+			p.errorf(expr, "@import used but no importer is set")
+			return invalid()
+		}
+		var module *Module
+		var err error
+		if from, isFrom := p.importer.(ImporterFrom); isFrom {
+			module, err = from.ImportFrom(name, p.dir)
+		} else {
+			module, err = p.importer.Import(name)
 		}
-		module, err := p.importer.Import(name)
 		if err != nil {
-			panic(err)
+			p.errorf(expr.Args[0], "could not import %q: %v", name, err)
+			return invalid()
+		}
+		if !slices.ContainsFunc(p.deps, func(dep Dependency) bool { return dep.Name == name }) {
+			p.deps = append(p.deps, Dependency{name, module.Fingerprint()})
 		}
 		val := NewModuleImport(module)
 		return NewTypeAndValue(val.Type(), val)
+	case BuiltinAs, BuiltinIntCast, BuiltinTruncate, BuiltinBitCast:
+		return p.conversion(expr, builtin, args)
+	case BuiltinSizeOf, BuiltinAlignOf, BuiltinOffsetOf:
+		return p.layout(expr, builtin, args)
 	case BuiltinExtern:
-		if len(args) != 1 {
-			panic(fmt.Errorf("Incorrect number of args for %s", builtin))
-		}
-		typ := p.resultLocation.Type()
-		linkName := args[0].Value().(*StringLiteral).Value()
-		p.resultLocation.linkName = linkName
-		return NewTypeAndValue(typ, NewExternalSymbol(linkName, typ))
+		return p.extern(expr, builtin, args)
+	case BuiltinExport:
+		return p.export(expr, builtin, args)
 	default:
 		panic(fmt.Sprintf("unexpected semantics.BuiltinID: %#v", builtin.id))
 	}
 }
 
+// extern evaluates @extern, whose options after the link name are usually
+// given as named arguments.
+func (p *pass) extern(expr *ast.CallExpr, builtin *Builtin, args []*TypeAndValue) *TypeAndValue {
+	mapping, ok := p.arguments(expr, builtin.String(), builtin.Type().(*Signature).Params(), args, false)
+	if !ok {
+		return invalid()
+	}
+	linkName, ok := p.stringArgument(p.argumentValue(expr.Args[mapping[0]]), args[mapping[0]], builtin)
+	if !ok {
+		return invalid()
+	}
+	if linkName == "" {
+		p.errorf(expr.Args[mapping[0]], "link name must not be empty")
+		ok = false
+	}
+
+	var opts ExternOptions
+	if i := mapping[1]; i >= 0 {
+		name, isString := p.stringArgument(p.argumentValue(expr.Args[i]), args[i], builtin)
+		if !isString {
+			return invalid()
+		}
+		cc, err := LookupCallingConvention(name)
+		switch {
+		case err != nil:
+			p.errorf(expr.Args[i], "%v", err)
+			ok = false
+		case !p.target.Supports(cc):
+			p.errorf(expr.Args[i], "calling convention %s is not supported on %s", cc, p.target)
+			ok = false
+		}
+		opts.CallingConvention = cc
+	}
+	for j, flag := range []*bool{&opts.Weak, &opts.ThreadLocal} {
+		if i := mapping[2+j]; i >= 0 {
+			value, isBool := p.boolArgument(p.argumentValue(expr.Args[i]), args[i], builtin)
+			if !isBool {
+				return invalid()
+			}
+			*flag = value
+		}
+	}
+	if i := mapping[4]; i >= 0 {
+		library, isString := p.stringArgument(p.argumentValue(expr.Args[i]), args[i], builtin)
+		if !isString {
+			return invalid()
+		}
+		if library == "" {
+			p.errorf(expr.Args[i], "library name must not be empty")
+			ok = false
+		}
+		opts.Library = library
+	}
+
+	if p.resultLocation == nil || p.resultLocation.Type() == nil {
+		p.errorf(expr, "%s must be the value of a binding with an explicit type", builtin)
+		return invalid()
+	}
+	typ := p.resultLocation.Type()
+	_, isFunc := Underlying(typ).(*Signature)
+	if isFunc && opts.ThreadLocal {
+		p.errorf(expr, "external function %s cannot be thread-local", linkName)
+		ok = false
+	}
+	if !isFunc && mapping[1] >= 0 {
+		p.errorf(expr.Args[mapping[1]], "calling convention given for %s, which is not a function", linkName)
+		ok = false
+	}
+	if !ok {
+		return invalid()
+	}
+	p.resultLocation.linkName = linkName
+	return NewTypeAndValue(typ, NewExternalSymbol(linkName, typ, opts))
+}
+
+// export evaluates @export, which gives a function declared at module
+// level the link name it is known by outside Usagi.
+func (p *pass) export(expr *ast.CallExpr, builtin *Builtin, args []*TypeAndValue) *TypeAndValue {
+	mapping, ok := p.arguments(expr, builtin.String(), builtin.Type().(*Signature).Params(), args, false)
+	if !ok {
+		return invalid()
+	}
+	linkName, ok := p.stringArgument(p.argumentValue(expr.Args[mapping[0]]), args[mapping[0]], builtin)
+	if !ok {
+		return invalid()
+	}
+	value := args[mapping[1]]
+	if isInvalid(value.Type()) {
+		return invalid()
+	}
+	if _, isFunc := value.Value().(*Function); !isFunc {
+		p.errorf(p.argumentValue(expr.Args[mapping[1]]), "argument to %s must be a function", builtin)
+		return invalid()
+	}
+	if linkName == "" {
+		p.errorf(expr.Args[mapping[0]], "link name must not be empty")
+		return invalid()
+	}
+	if p.resultLocation == nil || p.returnType != nil || p.cur != p.scope {
+		p.errorf(expr, "%s must be the value of a module-level binding", builtin)
+		return invalid()
+	}
+	p.resultLocation.linkName = linkName
+	return value
+}
+
+func (p *pass) conversion(expr *ast.CallExpr, builtin *Builtin, args []*TypeAndValue) *TypeAndValue {
+	if len(args) != 2 {
+		p.errorf(expr, "wrong number of arguments for %s: got %d, want 2", builtin, len(args))
+		return invalid()
+	}
+	if isInvalid(args[0].Type()) || isInvalid(args[1].Type()) {
+		return invalid()
+	}
+	typeValue, isType := args[0].Value().(*TypeValue)
+	if !isType {
+		p.errorf(expr.Args[0], "first argument to %s must be a type", builtin)
+		return invalid()
+	}
+	to := typeValue.Type()
+
+	if builtin.id == BuiltinAs {
+		value := p.assign(expr.Args[1], args[1], to, " in "+builtin.String())
+		if isInvalid(value.Type()) {
+			return value
+		}
+		if v, isConst := value.Value().(*IntegerLiteral); isConst {
+			return NewTypeAndValue(to, NewTypedIntegerLiteral(v.Value(), Underlying(to).(*IntegerType)))
+		}
+		return NewTypeAndValue(to, value.Value())
+	}
+
+	toInt, isInt := Underlying(to).(*IntegerType)
+	if !isInt {
+		p.errorf(expr.Args[0], "%s converts to integer types, not %s", builtin, to)
+		return invalid()
+	}
+	if err := conversionError(builtin.id, to, args[1].Type()); err != nil {
+		p.errorf(expr, "%v", err)
+		return invalid()
+	}
+	if v, isConst := args[1].Value().(*IntegerLiteral); isConst {
+		converted, err := convertConstant(builtin.id, toInt, v)
+		if err != nil {
+			p.errorf(expr.Args[1], "%v", err)
+			return invalid()
+		}
+		return NewTypeAndValue(to, converted)
+	}
+	return NewTypeAndValue(to, nil)
+}
+
+// layout evaluates @sizeOf, @alignOf and @offsetOf, which result in
+// untyped constants.
+func (p *pass) layout(expr *ast.CallExpr, builtin *Builtin, args []*TypeAndValue) *TypeAndValue {
+	want := 1
+	if builtin.id == BuiltinOffsetOf {
+		want = 2
+	}
+	if len(args) != want {
+		p.errorf(expr, "wrong number of arguments for %s: got %d, want %d", builtin, len(args), want)
+		return invalid()
+	}
+	if isInvalid(args[0].Type()) {
+		return invalid()
+	}
+	typeValue, isType := args[0].Value().(*TypeValue)
+	if !isType {
+		p.errorf(expr.Args[0], "first argument to %s must be a type", builtin)
+		return invalid()
+	}
+	typ := typeValue.Type()
+	switch underlying := Underlying(typ).(type) {
+	case nil:
+		p.errorf(expr.Args[0], "%s of %s depends on itself", builtin, typ)
+		return invalid()
+	case *TraitType, *UntypedIntegerType:
+		p.errorf(expr.Args[0], "%s has no layout", typ)
+		return invalid()
+	case *StructType, *UnionType:
+		if slices.ContainsFunc(p.aggregates, func(decl Type) bool { return Underlying(decl) == underlying }) {
+			p.errorf(expr.Args[0], "%s of %s depends on itself", builtin, typ)
+			return invalid()
+		}
+	}
+
+	var result int64
+	switch builtin.id {
+	case BuiltinSizeOf:
+		result = p.sizes.Sizeof(typ)
+	case BuiltinAlignOf:
+		result = p.sizes.Alignof(typ)
+	case BuiltinOffsetOf:
+		member, ok := p.stringArgument(expr.Args[1], args[1], builtin)
+		if !ok {
+			return invalid()
+		}
+		switch underlying := Underlying(typ).(type) {
+		case *StructType:
+			i := slices.IndexFunc(underlying.Members(), func(m *NameAndType) bool { return m.Name() == member })
+			if i < 0 {
+				p.errorf(expr.Args[1], "%s has no member %q", typ, member)
+				return invalid()
+			}
+			result = p.sizes.Offsetsof(underlying.Members())[i]
+		case *UnionType:
+			if underlying.Member(member) == nil {
+				p.errorf(expr.Args[1], "%s has no member %q", typ, member)
+				return invalid()
+			}
+		default:
+			p.errorf(expr.Args[0], "%s has no members", typ)
+			return invalid()
+		}
+	}
+	val := NewIntegerLiteral(big.NewInt(result))
+	return NewTypeAndValue(val.Type(), val)
+}
+
+// stringArgument returns the value of a string literal argument to
+// builtin, reporting an error if arg is not one.
+func (p *pass) stringArgument(node ast.Expr, arg *TypeAndValue, builtin *Builtin) (string, bool) {
+	if isInvalid(arg.Type()) {
+		return "", false
+	}
+	s, isString := arg.Value().(*StringLiteral)
+	if !isString {
+		p.errorf(node, "argument to %s must be a string literal", builtin)
+		return "", false
+	}
+	return s.Value(), true
+}
+
+// boolArgument returns the value of a constant bool argument to builtin,
+// reporting an error if arg is not one.
+func (p *pass) boolArgument(node ast.Expr, arg *TypeAndValue, builtin *Builtin) (bool, bool) {
+	if isInvalid(arg.Type()) {
+		return false, false
+	}
+	b, isBool := arg.Value().(*BoolLiteral)
+	if !isBool {
+		p.errorf(node, "argument to %s must be a constant bool", builtin)
+		return false, false
+	}
+	return b.Value(), true
+}
+
+// describe returns a short description of node for use in diagnostics.
+func describe(node ast.Node) string {
+	var b strings.Builder
+	err := printer.Fprint(&b, node)
+	if err != nil || strings.Contains(b.String(), "\n") {
+		return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+	}
+	return b.String()
+}
+
 type Module struct {
 	name  string
 	scope *Scope
+
+	// types and callArgs are what the checker recorded about the source of
+	// the module, with which its functions are evaluated at compile time
+	// by the modules importing it. funcBodies is set if function bodies
+	// were checked, and so recorded.
+	types      map[ast.Expr]*TypeAndValue
+	callArgs   map[*ast.CallExpr][]ast.Expr
+	funcBodies bool
+
+	// deps are the modules imported by the module, in order of import.
+	deps            []Dependency
+	fingerprintOnce sync.Once
+	fingerprint     Fingerprint
 }
 
 func (m *Module) Name() string { return m.name }
 
 func (m *Module) Scope() *Scope { return m.scope }
 
+// Exports returns the symbols m makes visible to modules importing it,
+// sorted by name.
+func (m *Module) Exports() iter.Seq[Symbol] { return m.scope.Exports() }
+
+// LookupExport returns the exported symbol of m called name, or nil if m
+// does not export one.
+func (m *Module) LookupExport(name string) Symbol {
+	if sym := m.scope.symbols[name]; sym != nil && sym.Exported() {
+		return sym
+	}
+	return nil
+}
+
 type Info struct {
 	Types  map[ast.Expr]*TypeAndValue
 	Defs   map[*ast.Identifier]Symbol
 	Uses   map[*ast.Identifier]Symbol
 	Scopes map[ast.Node]*Scope
+	// Arguments maps each checked call to the argument given for each
+	// parameter, in parameter order, with nil for defaulted parameters.
+	Arguments map[*ast.CallExpr][]ast.Expr
 }
 
 type Importer interface {
 	Import(name string) (*Module, error)
 }
+
+// An ImporterFrom is an Importer that can resolve relative imports, such
+// as @import("./util"), against the directory of the importing module.
+type ImporterFrom interface {
+	Importer
+	ImportFrom(name, dir string) (*Module, error)
+}
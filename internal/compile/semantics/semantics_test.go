@@ -2,14 +2,19 @@ package semantics
 
 import (
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 
 	"codeberg.org/rileyq/usagi/internal/compile/ast"
 	"codeberg.org/rileyq/usagi/internal/compile/parser"
+	"codeberg.org/rileyq/usagi/internal/compile/token"
 )
 
 const std = `
-const printf: func(fmt: [*]u8) i32 = @extern("printf");
+export const printf: func(fmt: [*]u8, ...) i32 = @extern("printf");
 `
 
 const main = `
@@ -72,6 +77,780 @@ func TestSemantics(t *testing.T) {
 	t.Log(Universe)
 }
 
+func TestDiagnostics(t *testing.T) {
+	type diag struct{ text, message string }
+	tests := []struct {
+		src   string
+		diags []diag
+	}{
+		{
+			`const x: i32 = "s";`,
+			[]diag{{`"s"`, "[]u8 is not assignable to i32"}},
+		},
+		{
+			`const x = y; const z = w;`,
+			[]diag{{"y", "undefined: y"}, {"w", "undefined: w"}},
+		},
+		{
+			// Errors in x do not cascade into its uses.
+			`const x = y + 1; const z = x.a; const w: i32 = z;`,
+			[]diag{{"y", "undefined: y"}},
+		},
+		{
+			`struct S(a: i32); const s = S(1, 2);`,
+			[]diag{{"S(1, 2)", "wrong number of arguments"}},
+		},
+		{
+			`struct S(a: i32, b: i32); const s = S(a: 1, c: 2);`,
+			[]diag{{"c", "S has no parameter named c"}},
+		},
+		{
+			`struct S(a: i32, b: i32); const s = S(1, a: 2, b: 3);`,
+			[]diag{{"a", "duplicate argument a in call to S"}},
+		},
+		{
+			`struct S(a: i32, b: i32); const s = S(b: 1, 2);`,
+			[]diag{{"2", "positional argument 2 follows named arguments"}},
+		},
+		{
+			`struct S(a: i32, b: i32 = 1); const s = S(b: 2);`,
+			[]diag{{"S(b: 2)", "missing argument a in call to S"}},
+		},
+		{
+			`func f(x: u32, y: u32) u32 { return x; } const z = f(y: 1);`,
+			[]diag{{"f(y: 1)", "missing argument x in call to f"}},
+		},
+		{
+			`const c = 1; func f(p: u32) u32 { c = 2; p = 3; f = f; u32 = 4; f(p) = p; return p; }`,
+			[]diag{
+				{"c", "cannot assign to constant c"},
+				{"p", "cannot assign to parameter p"},
+				{"f", "cannot assign to f"},
+				{"u32", "cannot assign to u32"},
+				{"f(p)", "cannot assign to f(p)"},
+			},
+		},
+		{
+			`struct S(a: u32); func f() u32 { const s = S(1); s.a = 2; return s.a; }`,
+			[]diag{{"s", "cannot assign to constant s"}},
+		},
+		{
+			`func f(c: bool) u32 { let x: u32; if c { x = 1; } return x; }`,
+			[]diag{{"x", "x is used before it is initialized"}},
+		},
+		{
+			`struct S(a: u32); func f() u32 { let s: S; s.a = 1; let y: u32; y = y + 1; return s.a + y; }`,
+			[]diag{{"s", "s is used before it is initialized"}, {"y", "y is used before it is initialized"}},
+		},
+		{
+			`func f(x: u32) u32 { if x > 0 { return 1; } }`,
+			[]diag{{"}", "missing return"}},
+		},
+		{
+			`func f(x: u32) u32 { while true { if x > 0 { break; } } }`,
+			[]diag{{"}", "missing return"}},
+		},
+		{
+			`func f() u32 { return; }`,
+			[]diag{{"return", "missing return value of type u32"}},
+		},
+		{
+			`func f() void { break; }`,
+			[]diag{{"break", "break outside of a loop"}},
+		},
+		{
+			`func f() noreturn { return; }`,
+			[]diag{{"return", "return in a function declared noreturn"}},
+		},
+		{
+			`func f() noreturn {}`,
+			[]diag{{"}", "function declared noreturn can return"}},
+		},
+		{
+			`func add(a: i32, b: i32) i32 { return a + b; } const x = add(1, 2, 3);`,
+			[]diag{{"add(1, 2, 3)", "wrong number of arguments for add: got 3, want 2"}},
+		},
+		{
+			`func f(a: u8) u8 { return a; } const x = f(300);`,
+			[]diag{{"300", "constant 300 overflows u8 in argument to f"}},
+		},
+		{
+			`func f(a: u8) u8 { return a; } func g(x: u32) u8 { return f(a: x); }`,
+			[]diag{{"x", "u32 is not assignable to u8 in argument to f"}},
+		},
+		{
+			`func f(x: u32, ...) u32 { return x; }`,
+			[]diag{{"(x: u32, ...) u32 { return x; }", "only external functions can be variadic"}},
+		},
+		{
+			`const f: func(..., x: u32) u32 = @extern("f");`,
+			[]diag{{"...", "... must be the last parameter"}},
+		},
+		{
+			`const printf: func(fmt: [*]u8, ...) i32 = @extern("printf");
+struct S(a: i32);
+func f(s: S) i32 { return printf("%d", s); }`,
+			[]diag{{"s", "cannot pass S as a variadic argument"}},
+		},
+		{
+			`const f: func() void = @extern("f", callconv: "pascal");`,
+			[]diag{{`callconv: "pascal"`, `unknown calling convention "pascal"`}},
+		},
+		{
+			`const f: func() void = @extern("f", callconv: "stdcall");`,
+			[]diag{{`callconv: "stdcall"`, "calling convention stdcall is not supported on x86_64-linux"}},
+		},
+		{
+			`const errno: i32 = @extern("errno", callconv: "c");`,
+			[]diag{{`callconv: "c"`, "calling convention given for errno, which is not a function"}},
+		},
+		{
+			`const f: func() void = @extern("f", threadLocal: true);`,
+			[]diag{{`@extern("f", threadLocal: true)`, "external function f cannot be thread-local"}},
+		},
+		{
+			`const f: func() void = @extern("f", weak: 1);`,
+			[]diag{{"1", "argument to @extern must be a constant bool"}},
+		},
+		{
+			`const f: func() void = @extern("", library: "");`,
+			[]diag{{`""`, "link name must not be empty"}, {`library: ""`, "library name must not be empty"}},
+		},
+		{
+			`const f: func() void = @extern("f", strong: true);`,
+			[]diag{{"strong", "@extern has no parameter named strong"}},
+		},
+		{
+			`const x: u32 = 1; const y = @export("y", x);`,
+			[]diag{{"x", "argument to @export must be a function"}},
+		},
+		{
+			`func f() void { const g = @export("g", func () void {}); }`,
+			[]diag{{`@export("g", func () void {})`, "@export must be the value of a module-level binding"}},
+		},
+		{
+			`func f() u8 { return @as(u8); } const c = f();`,
+			[]diag{{"@as(u8)", "wrong number of arguments for @as: got 1, want 2"}},
+		},
+		{
+			`func f() u8 { return @bitCast(u8, 5); } const c = f();`,
+			[]diag{{"@bitCast(u8, 5)", "cannot bit cast an untyped constant"}},
+		},
+		{
+			`const x: u99999 = 1;`,
+			[]diag{{"u99999", "invalid integer type u99999"}},
+		},
+		{
+			`func f(x: u8 = 256) u8 { return x; }`,
+			[]diag{{"256", "constant 256 overflows u8 in default value for x"}},
+		},
+		{
+			`func f(x: u32, y: u32 = x) u32 { return y; }`,
+			[]diag{{"x", "default value for y must be a constant"}},
+		},
+		{
+			`struct S(a: i32); func f(s: S) i32 { return s.b; }`,
+			[]diag{{"b", `has no member "b"`}},
+		},
+		{
+			`func f(a: i32, b: u8) i32 { return a + b; }`,
+			[]diag{{"a + b", "cannot add i32 and u8"}},
+		},
+		{
+			`func f() u8 { return 256; }`,
+			[]diag{{"256", "constant 256 overflows u8 in return statement"}},
+		},
+		{
+			`const a: u8 = -1; const b: i8 = 128; const c: i8 = -128; const d = 255 + 1; const e: u8 = d;`,
+			[]diag{{"-1", "constant -1 overflows u8"}, {"128", "constant 128 overflows i8"}, {"d", "constant 256 overflows u8"}},
+		},
+		{
+			`func f(a: i32, b: u16) u64 { let c: u64 = a; let d: i32 = b; let e: i16 = b; return c; }`,
+			[]diag{{"a", "i32 is not assignable to u64"}, {"b", "u16 is not assignable to i16"}},
+		},
+		{
+			`func f(a: u8) u8 { return -a; } const x: u8 = 255; const y = x + 1;`,
+			[]diag{{"-a", "cannot negate unsigned u8"}, {"x + 1", "constant overflow: 255 + 1 overflows u8"}},
+		},
+		{
+			`const a = @intCast(u8, 256); const b = @truncate(u16, @as(u8, 1)); const c = @bitCast(i16, @as(u8, 1)); const d = @as(u8, -1);`,
+			[]diag{
+				{"256", "constant 256 overflows u8"},
+				{"@truncate(u16, @as(u8, 1))", "cannot truncate u8 to larger type u16"},
+				{"@bitCast(i16, @as(u8, 1))", "cannot bit cast u8 to i16 of a different size"},
+				{"-1", "constant -1 overflows u8 in @as"},
+			},
+		},
+		{
+			`const x = 1; const x = 2;`,
+			[]diag{{"x", "x redeclared"}},
+		},
+		{
+			`const a = b; const b = c; const c = a;`,
+			[]diag{{"a", "initialization cycle: a refers to b refers to c refers to a"}},
+		},
+		{
+			`struct A(b: B); struct B(a: A);`,
+			[]diag{{"A", "invalid recursive type: A refers to B refers to A"}},
+		},
+		{
+			`newtype Meters = u32; const a: u32 = 1; const m: Meters = a;`,
+			[]diag{{"a", "u32 is not assignable to Meters"}},
+		},
+		{
+			`newtype M = u32; newtype N = u32; func f(m: M, n: N) M { return m + n; } func g(m: M) M { return -m; }`,
+			[]diag{{"m + n", "cannot add M and N"}, {"-m", "cannot negate unsigned M"}},
+		},
+		{
+			`struct P(x: i32); const Q = P; func f(q: Q) i32 { return q.y; }`,
+			[]diag{{"y", `P has no member "y"`}},
+		},
+		{
+			`newtype A = B; newtype B = A;`,
+			[]diag{{"A", "invalid recursive type: A refers to B refers to A"}},
+		},
+		{
+			`struct S(a: i32); impl S { func a(s: S) i32 { return s.a; } func f(s: S) i32; } impl u8 {}`,
+			[]diag{
+				{"a", "S has both a member and a method called a"},
+				{"f", "method S.f has no body"},
+				{"u8", "cannot define methods on u8, which is not a named type"},
+			},
+		},
+		{
+			`const a = @sizeOf(1); const b = @offsetOf(u8, "x"); struct S(a: i32); const c = @offsetOf(S, "b");`,
+			[]diag{
+				{"1", "first argument to @sizeOf must be a type"},
+				{"u8", "u8 has no members"},
+				{`"b"`, `S has no member "b"`},
+			},
+		},
+		{
+			`newtype A = [-1]u8; func f(n: u32, x: [n]u8) void {} struct R(a: [2]R); struct Q(a: [@sizeOf(Q)]u8);`,
+			[]diag{
+				{"-1", "invalid array length -1"},
+				{"n", "array length n must be a constant integer"},
+				{"[2]R", "invalid recursive type: R refers to R"},
+				{"Q", "@sizeOf of Q depends on itself"},
+			},
+		},
+		{
+			`func f(x: i32) void { if x {} while 1 {} if x <= 1 {} }`,
+			[]diag{{"x", "condition must be bool, not i32"}, {"1", "condition must be bool, not untyped integer"}},
+		},
+		{
+			`const a = !1; const b = true < false; const c = true == 1; const d: bool = 0 != 0;`,
+			[]diag{
+				{"!1", "operator ! is not defined on untyped integer"},
+				{"true < false", "operator < is not defined on bool"},
+				{"true == 1", "cannot compare bool and untyped integer"},
+			},
+		},
+		{
+			`const x: 1 = 1; const y = 2(3);`,
+			[]diag{{"1", "1 is not a type"}, {"2", "cannot call 2"}},
+		},
+	}
+
+	for _, test := range tests {
+		_, _, err := loadModule("main", test.src, nil, nil)
+		var diags Diagnostics
+		if !errors.As(err, &diags) {
+			t.Errorf("%s: got error %v, want diagnostics", test.src, err)
+			continue
+		}
+		// Warnings are tested by TestWarnings.
+		diags = slices.DeleteFunc(diags, func(d *Diagnostic) bool { return d.Severity == SeverityWarning })
+		if len(diags) != len(test.diags) {
+			t.Errorf("%s: got diagnostics:\n%v\nwant %d", test.src, diags, len(test.diags))
+			continue
+		}
+		for i, d := range diags {
+			text := test.src[d.Pos-1 : d.End-1]
+			if text != test.diags[i].text || !strings.Contains(d.Message, test.diags[i].message) || d.Severity != SeverityError {
+				t.Errorf("%s: got %s at %q, want %q at %q", test.src, d.Message, text, test.diags[i].message, test.diags[i].text)
+			}
+		}
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	const src = `struct S(a: u32);
+func f(n: u32) u32 {
+	let unused = 1;
+	let fixed = n;
+	let counter: u32 = 0;
+	let later: u32;
+	later = n;
+	let s = S(n);
+	s.a = 2;
+	while counter < fixed {
+		counter = counter + 1;
+	}
+	return counter + later + s.a;
+}
+`
+	moduleAst, err := parser.ParseBytes("main", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	_, err = Check(&CheckConfig{
+		Module:          moduleAst,
+		CheckFuncBodies: true,
+		Warn: func(d *Diagnostic) {
+			got = append(got, fmt.Sprintf("%s: %s", src[d.Pos-1:d.End-1], d.Message))
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"unused: unused declared and not used",
+		"fixed: fixed is never mutated, declare it with const",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got warnings %q, want %q", got, want)
+	}
+}
+
+func TestDiagnosticsError(t *testing.T) {
+	const src = `func f() u32 { let unused = 1; return true; }`
+	_, _, err := loadModule("main", src, nil, nil)
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	if got, want := err.Error(), "39-43: error: bool is not assignable to u32 in return statement"; got != want {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+}
+
+func TestLetValues(t *testing.T) {
+	// Only the initial value of x is constant, so x + 1 does not overflow.
+	const src = `func f() u8 { let x: u8 = 255; x = 0; let y: u8 = x + 1; return y; }`
+	if _, _, err := loadModule("main", src, nil, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFlow(t *testing.T) {
+	const src = `const exit: func(code: i32) noreturn = @extern("exit");
+func sign(x: i32) i32 {
+	if x < 0 {
+		return -1;
+		exit(2);
+	}
+	if x > 0 {
+		exit(1);
+		return 1;
+	}
+	while true {
+		if x == 0 {
+			break;
+			return 0;
+		}
+	}
+	return x;
+}
+func spin() u32 {
+	while true {}
+	return 0;
+}
+`
+	moduleAst, err := parser.ParseBytes("main", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	_, err = Check(&CheckConfig{
+		Module:          moduleAst,
+		CheckFuncBodies: true,
+		Warn: func(d *Diagnostic) {
+			got = append(got, fmt.Sprintf("%s: %s", src[d.Pos-1:d.End-1], d.Message))
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"exit(2);: unreachable code",
+		"return 1;: unreachable code",
+		"return 0;: unreachable code",
+		"return 0;: unreachable code",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got warnings %q, want %q", got, want)
+	}
+}
+
+func TestDeclarationOrder(t *testing.T) {
+	const src = `
+const x: i32 = y;
+const y = 1;
+
+func even(n: u8) u8 {
+	return odd(n);
+}
+
+func odd(n: u8) u8 {
+	return even(n);
+}
+
+struct List(head: [*]Node);
+struct Node(next: [*]Node, list: [*]List);
+`
+	_, module, err := loadModule("main", src, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"x", "y", "even", "odd", "List", "Node"} {
+		if sym := module.Scope().Lookup(name); sym == nil || isInvalid(sym.Type()) {
+			t.Errorf("%s was not resolved: %v", name, sym)
+		}
+	}
+}
+
+func TestNamedTypes(t *testing.T) {
+	const src = `
+newtype Meters = u32;
+const Length = Meters;
+newtype Point = struct(x: i32, y: i32);
+struct Vec(x: i32, y: i32);
+const A = struct(x: i32);
+const B = struct(x: i32);
+
+impl Meters {
+	func double(m: Meters) Meters {
+		return m + m;
+	}
+}
+
+const start: Length = 5;
+const doubled = Meters.double(@intCast(Meters, 21));
+`
+	module, err := checkSource(t, src, CheckConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	typeOf := func(name string) Type {
+		return module.Scope().Lookup(name).Value().(*TypeValue).Type()
+	}
+
+	meters, isNamed := typeOf("Meters").(*Named)
+	if !isNamed {
+		t.Fatalf("Meters is %T, want *Named", typeOf("Meters"))
+	}
+	if meters.Symbol() != module.Scope().Lookup("Meters") {
+		t.Errorf("Meters is declared by %v", meters.Symbol())
+	}
+	if !meters.Underlying().Equal(NewIntegerType(false, 32)) || meters.Equal(meters.Underlying()) {
+		t.Errorf("Meters has underlying type %s", meters.Underlying())
+	}
+	if !typeOf("Length").Equal(meters) {
+		t.Errorf("alias Length is %s, want Meters", typeOf("Length"))
+	}
+	if typeOf("Point").Equal(typeOf("Vec")) || !Underlying(typeOf("Point")).Equal(Underlying(typeOf("Vec"))) {
+		t.Errorf("Point and Vec should be distinct types with the same underlying type")
+	}
+	if !typeOf("A").Equal(typeOf("B")) {
+		t.Errorf("identical struct types %s and %s are not equal", typeOf("A"), typeOf("B"))
+	}
+	if methods := meters.Methods(); len(methods) != 1 || meters.Method("double") != methods[0] {
+		t.Errorf("Meters has methods %v", methods)
+	}
+
+	for name, want := range map[string]string{"start": "5", "doubled": "42"} {
+		sym := module.Scope().Lookup(name)
+		if !sym.Type().Equal(meters) || valueString(sym.Value()) != want {
+			t.Errorf("%s: got %s = %s, want Meters = %s", name, sym.Type(), valueString(sym.Value()), want)
+		}
+	}
+}
+
+func TestScopes(t *testing.T) {
+	const src = `const x = 1;
+func f(a: i32) i32 {
+	let y = a;
+	if a < 0 {
+		let x = 2;
+		return x;
+	}
+	return y;
+}
+`
+	info := &Info{Scopes: map[ast.Node]*Scope{}}
+	moduleAst, module, err := loadModule("main", src, info, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Scopes) != 3 {
+		t.Errorf("got %d scopes, want module, function and block", len(info.Scopes))
+	}
+	if info.Scopes[moduleAst] != module.Scope() {
+		t.Errorf("module scope was not recorded")
+	}
+	for node, scope := range info.Scopes {
+		if _, isModule := node.(*ast.Module); !isModule && (scope.Pos() != node.Pos() || scope.End() != node.End()) {
+			t.Errorf("scope of %T covers %d-%d, want %d-%d", node, scope.Pos(), scope.End(), node.Pos(), node.End())
+		}
+	}
+
+	pos := func(text string) token.Pos {
+		return token.Pos(strings.Index(src, text) + 1)
+	}
+	tests := []struct {
+		at, name string
+		want     string // the text declaring the symbol found
+	}{
+		{"return x", "x", "x = 2"},
+		{"let x", "x", "x = 1"},
+		{"let y", "y", ""},
+		{"return y", "y", "y = a"},
+		{"let y", "a", "a: i32"},
+	}
+	for _, test := range tests {
+		inner := module.Scope().Innermost(pos(test.at))
+		if inner == nil {
+			t.Errorf("no scope contains %q", test.at)
+			continue
+		}
+		_, sym := inner.LookupParent(test.name, pos(test.at))
+		switch {
+		case sym == nil && test.want != "":
+			t.Errorf("%s is not in scope at %q", test.name, test.at)
+		case sym != nil && sym.Pos() != pos(test.want):
+			t.Errorf("%s at %q is declared at %d, want %d", test.name, test.at, sym.Pos(), pos(test.want))
+		}
+	}
+	if got := module.Scope().Innermost(pos("return x")); got == nil || got.Pos() != pos("{\n\t\tlet x") {
+		t.Errorf("innermost scope of %q is %v, want the if block", "return x", got)
+	}
+}
+
+func TestArguments(t *testing.T) {
+	const src = `struct Rect(x: u32 = 0, y: u32 = 0, w: u32, h: u32);
+const r = Rect(5, h: 7, w: 6);
+`
+	info := &Info{Arguments: map[*ast.CallExpr][]ast.Expr{}}
+	_, _, err := loadModule("main", src, info, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Arguments) != 1 {
+		t.Fatalf("got %d calls, want 1", len(info.Arguments))
+	}
+	want := []string{"5", "", "6", "7"}
+	for _, args := range info.Arguments {
+		got := make([]string, len(args))
+		for i, arg := range args {
+			if arg != nil {
+				got[i] = describe(arg)
+			}
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("got arguments %q, want %q", got, want)
+		}
+	}
+}
+
+func TestVariadicPromotions(t *testing.T) {
+	const src = `const printf: func(fmt: [*]u8, ...) i32 = @extern("printf");
+func f(small: u8, big: u64, flag: bool) i32 {
+	return printf("%d %d %d %d %s", small, big, flag, 7, "str");
+}
+`
+	moduleAst, err := parser.ParseBytes("main", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &Info{Types: map[ast.Expr]*TypeAndValue{}}
+	_, err = Check(&CheckConfig{Module: moduleAst, Info: info, CheckFuncBodies: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		`"%d %d %d %d %s"`: "[*]u8",
+		"small":            "i32",
+		"big":              "u64",
+		"flag":             "i32",
+		"7":                "i32",
+		`"str"`:            "[*]u8",
+	}
+	ast.Inspect(moduleAst, func(node ast.Node) bool {
+		call, isCall := node.(*ast.CallExpr)
+		if !isCall || describe(call.Base) != "printf" {
+			return true
+		}
+		for _, arg := range call.Args {
+			if got := fmt.Sprint(info.Types[arg].Type()); got != want[describe(arg)] {
+				t.Errorf("%s has type %s, want %s", describe(arg), got, want[describe(arg)])
+			}
+		}
+		return false
+	})
+}
+
+func TestExtern(t *testing.T) {
+	const src = `const puts: func(s: [*]u8) i32 = @extern("puts", library: "c");
+const errno: i32 = @extern("errno", weak: true, threadLocal: true);
+const ms: func() void = @extern("ms", callconv: "win64");
+const add = @export("usagi_add", func (a: i32, b: i32) i32 { return a + b; });
+`
+	_, module, err := loadModule("main", src, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	externs := map[string]ExternOptions{
+		"puts":  {Library: "c"},
+		"errno": {Weak: true, ThreadLocal: true},
+		"ms":    {CallingConvention: CallWin64},
+	}
+	for name, want := range externs {
+		sym := module.Scope().Lookup(name)
+		extern, isExtern := sym.Value().(*ExternalSymbol)
+		if !isExtern {
+			t.Errorf("%s is %v, want an external symbol", name, sym.Value())
+			continue
+		}
+		if extern.Options() != want {
+			t.Errorf("%s has options %+v, want %+v", name, extern.Options(), want)
+		}
+	}
+	if got, want := fmt.Sprint(module.Scope().Lookup("errno").Value()), `@extern("errno", weak: true, threadLocal: true)`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	add := module.Scope().Lookup("add")
+	if _, isFunc := add.Value().(*Function); !isFunc {
+		t.Errorf("add is %v, want a function", add.Value())
+	}
+	if got := add.LinkName(); got != "usagi_add" {
+		t.Errorf("add has link name %s, want usagi_add", got)
+	}
+}
+
+func TestExports(t *testing.T) {
+	const lib = `
+export const limit: u32 = 10;
+export struct Point(x: i32, y: i32);
+export func clamp(n: u32) u32 {
+	if n > limit {
+		return limit;
+	}
+	return helper(n);
+}
+const secret: u32 = 7;
+func helper(n: u32) u32 {
+	return n;
+}
+`
+	_, libModule, err := loadModule("lib", lib, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exports []string
+	for sym := range libModule.Exports() {
+		exports = append(exports, sym.Name())
+	}
+	if want := []string{"Point", "clamp", "limit"}; !slices.Equal(exports, want) {
+		t.Errorf("got exports %q, want %q", exports, want)
+	}
+	if libModule.LookupExport("secret") != nil || libModule.LookupExport("limit") == nil {
+		t.Errorf("LookupExport does not match the exports of lib")
+	}
+
+	importer := &testImporter{}
+	importer.Add("lib", libModule)
+	const src = `const lib = @import("lib");
+const a = lib.clamp(lib.limit);
+const b = lib.secret;
+func f() u32 {
+	return lib.helper(1);
+}
+const Point = lib.Point;
+impl Point {
+	func origin() Point {
+		return Point(0, 0);
+	}
+}
+`
+	_, _, err = loadModule("main", src, nil, importer)
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("got error %v, want diagnostics", err)
+	}
+	want := []string{
+		"secret is not exported by module lib",
+		"helper is not exported by module lib",
+		"cannot define methods on Point, which is declared in module lib",
+	}
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.Message)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got diagnostics %q, want %q", got, want)
+	}
+}
+
+func TestConcurrentCheck(t *testing.T) {
+	const lib = `
+export struct Point(x: i32, y: i32 = 0);
+export newtype Meters = u32;
+export func scale(p: Point, n: i32) Point {
+	let scaled = Point(p.x + n, p.y + n);
+	return scaled;
+}
+impl Point {
+	func sum(p: Point) i32 {
+		return p.x + p.y;
+	}
+}
+`
+	_, libModule, err := loadModule("lib", lib, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	importer := &testImporter{}
+	importer.Add("lib", libModule)
+
+	// Each module is checked against the shared lib and Universe, which
+	// must not be modified, so that the race detector finds no conflicts.
+	const n = 16
+	values := make([]Value, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Go(func() {
+			src := fmt.Sprintf(`const lib = @import("lib");
+const Point = lib.Point;
+const p = lib.scale(Point(x: %d, y: 1), 2);
+const sum = Point.sum(p);
+const ok: bool = true;
+func f(m: lib.Meters) lib.Meters {
+	let unused = m;
+	return m;
+}
+`, i)
+			_, module, err := loadModule(fmt.Sprintf("main%d", i), src, nil, importer)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			values[i] = module.Scope().Lookup("sum").Value()
+		})
+	}
+	wg.Wait()
+	for i, value := range values {
+		if got, want := valueString(value), fmt.Sprint(i+5); got != want {
+			t.Errorf("main%d: sum = %s, want %s", i, got, want)
+		}
+	}
+	if children := Universe.Children(); len(children) != 0 {
+		t.Errorf("Universe has %d children, want none", len(children))
+	}
+}
+
 type testImporter struct {
 	imports map[string]*Module
 }
@@ -0,0 +1,114 @@
+package semantics
+
+// Sizes computes the memory layout of types, which depends on the target.
+type Sizes interface {
+	Sizeof(typ Type) int64
+	Alignof(typ Type) int64
+	// Offsetsof returns the offset of each member of a struct with the
+	// given members.
+	Offsetsof(members []*NameAndType) []int64
+}
+
+// StdSizes lays out types as C compilers do on most targets: integers
+// are as large as the smallest power of two bytes that holds them,
+// integers and pointers are aligned to their size up to MaxAlign, and
+// struct members are placed in order at the next suitably aligned offset.
+type StdSizes struct {
+	WordSize int64 // size of a pointer in bytes
+	MaxAlign int64 // largest alignment of any type in bytes
+}
+
+func (s *StdSizes) Sizeof(typ Type) int64 {
+	switch typ := Underlying(typ).(type) {
+	case *IntegerType:
+		bytes := (int64(typ.Bits()) + 7) / 8
+		size := min(bytes, 1)
+		for size < bytes {
+			size *= 2
+		}
+		return size
+	case *UntypedIntegerType:
+		return s.Sizeof(defaultIntegerType)
+	case *BoolType:
+		return 1
+	case *Pointer, *Signature:
+		return s.WordSize
+	case *SliceType:
+		return 2 * s.WordSize
+	case *ArrayType:
+		return typ.Len() * s.Sizeof(typ.Element())
+	case *StructType:
+		members := typ.Members()
+		if len(members) == 0 {
+			return 0
+		}
+		offsets := s.Offsetsof(members)
+		last := len(members) - 1
+		return alignUp(offsets[last]+s.Sizeof(members[last].Type()), s.Alignof(typ))
+	case *UnionType:
+		var size int64
+		for _, m := range typ.Members() {
+			size = max(size, s.Sizeof(m.Type()))
+		}
+		return alignUp(size, s.Alignof(typ))
+	default:
+		return 0
+	}
+}
+
+func (s *StdSizes) Alignof(typ Type) int64 {
+	switch typ := Underlying(typ).(type) {
+	case *IntegerType, *UntypedIntegerType:
+		return max(1, min(s.Sizeof(typ), s.MaxAlign))
+	case *Pointer, *Signature, *SliceType:
+		return s.WordSize
+	case *ArrayType:
+		return s.Alignof(typ.Element())
+	case *StructType:
+		return s.maxAlign(typ.Members())
+	case *UnionType:
+		return s.maxAlign(typ.Members())
+	default:
+		return 1
+	}
+}
+
+func (s *StdSizes) maxAlign(members []*NameAndType) int64 {
+	align := int64(1)
+	for _, m := range members {
+		align = max(align, s.Alignof(m.Type()))
+	}
+	return align
+}
+
+func (s *StdSizes) Offsetsof(members []*NameAndType) []int64 {
+	offsets := make([]int64, len(members))
+	var offset int64
+	for i, m := range members {
+		offset = alignUp(offset, s.Alignof(m.Type()))
+		offsets[i] = offset
+		offset += s.Sizeof(m.Type())
+	}
+	return offsets
+}
+
+func alignUp(x, align int64) int64 {
+	return (x + align - 1) / align * align
+}
+
+var stdSizes = map[string]*StdSizes{
+	"x86_64":   {WordSize: 8, MaxAlign: 16},
+	"aarch64":  {WordSize: 8, MaxAlign: 16},
+	"riscv64":  {WordSize: 8, MaxAlign: 16},
+	"thumbv7m": {WordSize: 4, MaxAlign: 8},
+}
+
+// SizesFor returns the Sizes used for the architecture arch, or nil if
+// arch is unknown.
+func SizesFor(arch string) Sizes {
+	sizes, found := stdSizes[arch]
+	if !found {
+		return nil
+	}
+	return sizes
+}
@@ -0,0 +1,75 @@
+package semantics
+
+import (
+	"testing"
+)
+
+func TestSizes(t *testing.T) {
+	const src = `
+struct Header(tag: u8, len: u32, next: [*]u8);
+newtype Word = union(bytes: [4]u8, value: u32, wide: u64);
+newtype Odd = u24;
+struct Empty();
+
+const headerSize = @sizeOf(Header);
+const headerAlign = @alignOf(Header);
+const nextOffset = @offsetOf(Header, "next");
+const wordSize = @sizeOf(Word);
+const wideOffset = @offsetOf(Word, "wide");
+const oddSize = @sizeOf(Odd);
+const sliceSize = @sizeOf([]u8);
+const arraySize = @sizeOf([3]u16);
+const arrayAlign = @alignOf([3]u16);
+const wideAlign = @alignOf(u128);
+const emptySize = @sizeOf(Empty);
+`
+	tests := []struct {
+		arch string
+		want map[string]string
+	}{
+		{
+			arch: "x86_64",
+			want: map[string]string{
+				"headerSize":  "16",
+				"headerAlign": "8",
+				"nextOffset":  "8",
+				"wordSize":    "8",
+				"wideOffset":  "0",
+				"oddSize":     "4",
+				"sliceSize":   "16",
+				"arraySize":   "6",
+				"arrayAlign":  "2",
+				"wideAlign":   "16",
+				"emptySize":   "0",
+			},
+		},
+		{
+			arch: "thumbv7m",
+			want: map[string]string{
+				"headerSize":  "12",
+				"headerAlign": "4",
+				"nextOffset":  "8",
+				"wordSize":    "8",
+				"wideOffset":  "0",
+				"oddSize":     "4",
+				"sliceSize":   "8",
+				"arraySize":   "6",
+				"arrayAlign":  "2",
+				"wideAlign":   "8",
+				"emptySize":   "0",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		module, err := checkSource(t, src, CheckConfig{Sizes: SizesFor(test.arch)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range test.want {
+			if got := valueString(module.Scope().Lookup(name).Value()); got != want {
+				t.Errorf("%s: %s = %s, want %s", test.arch, name, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package semantics
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+type Endianness int
+
+const (
+	LittleEndian Endianness = iota
+	BigEndian
+)
+
+func (e Endianness) String() string {
+	switch e {
+	case LittleEndian:
+		return "little endian"
+	case BigEndian:
+		return "big endian"
+	default:
+		panic(fmt.Sprintf("unexpected semantics.Endianness: %#v", e))
+	}
+}
+
+// A Target describes the machine a module is compiled for.
+type Target struct {
+	Name string
+	Arch string
+	// OS is the operating system, or "none" for freestanding targets.
+	OS           string
+	ABI          string
+	PointerWidth int // size of a pointer in bits
+	Endianness   Endianness
+}
+
+// Sizes returns the layout of types on t.
+func (t *Target) Sizes() Sizes {
+	if sizes := SizesFor(t.Arch); sizes != nil {
+		return sizes
+	}
+	word := int64(t.PointerWidth / 8)
+	return &StdSizes{WordSize: word, MaxAlign: word}
+}
+
+// validate reports whether types can be laid out on t.
+func (t *Target) validate() error {
+	if t.PointerWidth <= 0 || t.PointerWidth%8 != 0 || t.PointerWidth > 64 {
+		return fmt.Errorf("target %s has invalid pointer width %d", t, t.PointerWidth)
+	}
+	return nil
+}
+
+// SizeType returns the type of usize, if signed is false, or isize: the
+// integer type as wide as a pointer.
+func (t *Target) SizeType(signed bool) *IntegerType {
+	return NewIntegerType(signed, t.PointerWidth)
+}
+
+func (t *Target) String() string { return t.Name }
+
+const defaultTarget = "x86_64-linux"
+
+var targets = map[string]*Target{
+	"x86_64-linux": {
+		Name:         "x86_64-linux",
+		Arch:         "x86_64",
+		OS:           "linux",
+		ABI:          "sysv",
+		PointerWidth: 64,
+		Endianness:   LittleEndian,
+	},
+	"aarch64-linux": {
+		Name:         "aarch64-linux",
+		Arch:         "aarch64",
+		OS:           "linux",
+		ABI:          "aapcs64",
+		PointerWidth: 64,
+		Endianness:   LittleEndian,
+	},
+	"riscv64-none": {
+		Name:         "riscv64-none",
+		Arch:         "riscv64",
+		OS:           "none",
+		ABI:          "lp64d",
+		PointerWidth: 64,
+		Endianness:   LittleEndian,
+	},
+	"thumbv7m-none": {
+		Name:         "thumbv7m-none",
+		Arch:         "thumbv7m",
+		OS:           "none",
+		ABI:          "eabi",
+		PointerWidth: 32,
+		Endianness:   LittleEndian,
+	},
+}
+
+// LookupTarget returns the known target called name.
+func LookupTarget(name string) (*Target, error) {
+	target, found := targets[name]
+	if !found {
+		return nil, fmt.Errorf("unknown target %q", name)
+	}
+	t := *target
+	return &t, nil
+}
+
+// TargetNames returns the names of the known targets in sorted order.
+func TargetNames() []string {
+	return slices.Sorted(maps.Keys(targets))
+}
+
+// A CallingConvention is the convention by which a function is called,
+// which external functions may specify with @extern.
+type CallingConvention int
+
+const (
+	// CallC is the C calling convention of the target.
+	CallC CallingConvention = iota
+	CallStdcall
+	CallFastcall
+	CallVectorcall
+	CallSysV
+	CallWin64
+	CallAAPCS
+)
+
+var callingConventions = [...]struct {
+	name string
+	// arches lists the architectures supporting the convention, or is
+	// nil if every architecture does.
+	arches []string
+}{
+	CallC:          {"c", nil},
+	CallStdcall:    {"stdcall", []string{"x86"}},
+	CallFastcall:   {"fastcall", []string{"x86"}},
+	CallVectorcall: {"vectorcall", []string{"x86", "x86_64"}},
+	CallSysV:       {"sysv64", []string{"x86_64"}},
+	CallWin64:      {"win64", []string{"x86_64"}},
+	CallAAPCS:      {"aapcs", []string{"arm", "thumbv7m"}},
+}
+
+func (cc CallingConvention) String() string {
+	if cc < 0 || int(cc) >= len(callingConventions) {
+		panic(fmt.Sprintf("unexpected semantics.CallingConvention: %#v", cc))
+	}
+	return callingConventions[cc].name
+}
+
+// LookupCallingConvention returns the calling convention called name.
+func LookupCallingConvention(name string) (CallingConvention, error) {
+	for cc, conv := range callingConventions {
+		if conv.name == name {
+			return CallingConvention(cc), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown calling convention %q", name)
+}
+
+// Supports reports whether functions can be called with cc on t.
+func (t *Target) Supports(cc CallingConvention) bool {
+	arches := callingConventions[cc].arches
+	return arches == nil || slices.Contains(arches, t.Arch)
+}
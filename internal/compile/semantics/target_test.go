@@ -0,0 +1,62 @@
+package semantics
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestTargets(t *testing.T) {
+	names := TargetNames()
+	want := []string{"aarch64-linux", "riscv64-none", "thumbv7m-none", "x86_64-linux"}
+	if !slices.Equal(names, want) {
+		t.Errorf("got targets %v, want %v", names, want)
+	}
+
+	const src = `
+const size = @sizeOf(usize);
+const max: usize = 4294967295;
+const min: isize = -2147483648;
+`
+	for _, name := range names {
+		target, err := LookupTarget(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		module, err := checkSource(t, src, CheckConfig{Target: target})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got, want := valueString(module.Scope().Lookup("size").Value()), target.PointerWidth/8; got != strconv.Itoa(want) {
+			t.Errorf("%s: @sizeOf(usize) = %s, want %d", name, got, want)
+		}
+		if typ := module.Scope().Lookup("max").Type(); !typ.Equal(NewIntegerType(false, target.PointerWidth)) {
+			t.Errorf("%s: usize is %s", name, typ)
+		}
+	}
+
+	thumb, _ := LookupTarget("thumbv7m-none")
+	_, err := checkSource(t, "const x: usize = 4294967296;", CheckConfig{Target: thumb})
+	var diags Diagnostics
+	if !errors.As(err, &diags) || diags[0].Message != "constant 4294967296 overflows u32" {
+		t.Errorf("got %v, want usize to overflow on %s", err, thumb)
+	}
+
+	x86, _ := LookupTarget("x86_64-linux")
+	if !thumb.Supports(CallAAPCS) || x86.Supports(CallAAPCS) || !x86.Supports(CallWin64) || !thumb.Supports(CallC) {
+		t.Error("calling conventions are not supported on the expected targets")
+	}
+	if cc, err := LookupCallingConvention("sysv64"); err != nil || cc != CallSysV {
+		t.Errorf("got calling convention %v, %v, want sysv64", cc, err)
+	}
+
+	_, err = checkSource(t, "const size = @sizeOf(usize);", CheckConfig{Target: &Target{Name: "custom", Arch: "custom"}})
+	if !errors.As(err, &diags) || diags[0].Message != "target custom has invalid pointer width 0" {
+		t.Errorf("got %v, want the target to be rejected", err)
+	}
+
+	if _, err := LookupTarget("pdp11-unix"); err == nil {
+		t.Error("found unknown target pdp11-unix")
+	}
+}
@@ -2,73 +2,116 @@ package semantics
 
 import (
 	"fmt"
-	"slices"
+	"math/big"
 	"strconv"
 	"strings"
 )
 
+// A Type is the type of a value. Types are interned, so identical types
+// constructed separately are the same value, except for those with
+// default values; see typeContext.
 type Type interface {
 	IsAssignableTo(other Type) bool
 	Equal(other Type) bool
+	typeID() uint64
 }
 
 type IntegerType struct {
+	identity
 	signed bool
 	bits   uint16
 }
 
 func NewIntegerType(signed bool, bits int) *IntegerType {
-	return &IntegerType{signed, uint16(bits)}
+	key := newTypeKey('i').bool(signed).int(int64(bits))
+	return intern(string(key), &IntegerType{signed: signed, bits: uint16(bits)}, false)
 }
 
-func NewIntegerTypeFromName(name string) *IntegerType {
+// NewIntegerTypeFromName returns the integer type called name, such as u8
+// or i32, or nil if name does not name one. It returns an error if name
+// has the form of an integer type but too many bits.
+func NewIntegerTypeFromName(name string) (*IntegerType, error) {
 	if name == "void" {
-		return NewIntegerType(false, 0)
+		return NewIntegerType(false, 0), nil
 	}
 
 	if len(name) < 2 {
-		return nil
+		return nil, nil
 	}
 
 	if name[0] != 'i' && name[0] != 'u' {
-		return nil
+		return nil, nil
 	}
 
 	signed := name[0] == 'i'
 
 	for _, r := range name[1:] {
 		if !(r >= '0' && r <= '9') {
-			return nil
+			return nil, nil
 		}
 	}
 
 	bits, err := strconv.ParseUint(name[1:], 10, 16)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("invalid integer type %s", name)
 	}
 
-	return NewIntegerType(signed, int(bits))
+	return NewIntegerType(signed, int(bits)), nil
 }
 
 func (i *IntegerType) Signed() bool { return i.signed }
 func (i *IntegerType) Bits() int    { return int(i.bits) }
 
+// IsAssignableTo reports whether every value of i can be represented by
+// other.
 func (i *IntegerType) IsAssignableTo(other Type) bool {
 	otherInt, isInteger := other.(*IntegerType)
 	if !isInteger {
 		return false
 	}
-	return otherInt.Bits() >= i.Bits()
+	if i.signed == otherInt.signed {
+		return otherInt.bits >= i.bits
+	}
+	return !i.signed && otherInt.bits > i.bits
 }
 
-func (i *IntegerType) Equal(other Type) bool {
-	otherInt, isInt := other.(*IntegerType)
-	if !isInt {
-		return false
+// Min returns the smallest value representable by i.
+func (i *IntegerType) Min() *big.Int {
+	if !i.signed || i.bits == 0 {
+		return new(big.Int)
+	}
+	min := new(big.Int).Lsh(big.NewInt(1), uint(i.bits-1))
+	return min.Neg(min)
+}
+
+// Max returns the largest value representable by i.
+func (i *IntegerType) Max() *big.Int {
+	bits := uint(i.bits)
+	if i.signed && bits > 0 {
+		bits--
+	}
+	max := new(big.Int).Lsh(big.NewInt(1), bits)
+	return max.Sub(max, big.NewInt(1))
+}
+
+// Representable reports whether v is a value of i.
+func (i *IntegerType) Representable(v *big.Int) bool {
+	return v.Cmp(i.Min()) >= 0 && v.Cmp(i.Max()) <= 0
+}
+
+// Wrap returns v reduced modulo 2^bits into the range of i, as two's
+// complement arithmetic would.
+func (i *IntegerType) Wrap(v *big.Int) *big.Int {
+	modulus := new(big.Int).Lsh(big.NewInt(1), uint(i.bits))
+	wrapped := new(big.Int).Mod(v, modulus)
+	if wrapped.Cmp(i.Max()) > 0 {
+		wrapped.Sub(wrapped, modulus)
 	}
-	return i.signed == otherInt.signed && i.bits == otherInt.bits
+	return wrapped
 }
 
+func (i *IntegerType) Equal(other Type) bool { return identical(i, other) }
+
 func (i *IntegerType) String() string {
 	if i.signed {
 		return "i" + strconv.Itoa(i.Bits())
@@ -77,13 +120,77 @@ func (i *IntegerType) String() string {
 	}
 }
 
+// UntypedIntegerType is the type of integer constants that have not been
+// given a type by their context. Such constants have arbitrary precision
+// and take on the type they are assigned to, if it can represent them.
+type UntypedIntegerType struct{ identity }
+
+var UntypedInt = intern("untyped", &UntypedIntegerType{}, false)
+
+func (*UntypedIntegerType) IsAssignableTo(other Type) bool {
+	switch other.(type) {
+	case *IntegerType, *UntypedIntegerType:
+		return true
+	default:
+		return false
+	}
+}
+
+func (u *UntypedIntegerType) Equal(other Type) bool { return identical(u, other) }
+
+func (*UntypedIntegerType) String() string { return "untyped integer" }
+
+type BoolType struct{ identity }
+
+var Bool = intern("bool", &BoolType{}, false)
+
+func (*BoolType) IsAssignableTo(other Type) bool {
+	_, isBool := other.(*BoolType)
+	return isBool
+}
+
+func (b *BoolType) Equal(other Type) bool { return identical(b, other) }
+
+func (*BoolType) String() string { return "bool" }
+
+// NeverType is the type of expressions that never produce a value, such
+// as return and break, and the return type of functions that never return.
+// It is assignable to every type.
+type NeverType struct{ identity }
+
+var Never = intern("never", &NeverType{}, false)
+
+func (*NeverType) IsAssignableTo(other Type) bool { return true }
+
+func (n *NeverType) Equal(other Type) bool { return identical(n, other) }
+
+func (*NeverType) String() string { return "noreturn" }
+
+func isNever(typ Type) bool {
+	_, never := Underlying(typ).(*NeverType)
+	return never
+}
+
+// isVoid reports whether typ is void, the type of expressions and
+// functions that produce no value.
+func isVoid(typ Type) bool {
+	i, isInt := Underlying(typ).(*IntegerType)
+	return isInt && i.bits == 0
+}
+
 type Pointer struct {
+	identity
 	element Type
 	many    bool
 }
 
-func NewPointer(element Type) *Pointer     { return &Pointer{element: element} }
-func NewManyPointer(element Type) *Pointer { return &Pointer{element: element, many: true} }
+func NewPointer(element Type) *Pointer     { return newPointer(element, false) }
+func NewManyPointer(element Type) *Pointer { return newPointer(element, true) }
+
+func newPointer(element Type, many bool) *Pointer {
+	key := newTypeKey('p').bool(many).typ(element)
+	return intern(string(key), &Pointer{element: element, many: many}, false)
+}
 
 func (p *Pointer) Element() Type { return p.element }
 
@@ -91,13 +198,7 @@ func (p *Pointer) IsAssignableTo(other Type) bool {
 	return false
 }
 
-func (p *Pointer) Equal(other Type) bool {
-	otherPointer, isPointer := other.(*Pointer)
-	if !isPointer {
-		return false
-	}
-	return p.Element().Equal(otherPointer.Element()) && p.many == otherPointer.many
-}
+func (p *Pointer) Equal(other Type) bool { return identical(p, other) }
 
 func (p *Pointer) String() string {
 	if p.many {
@@ -107,16 +208,31 @@ func (p *Pointer) String() string {
 }
 
 type Signature struct {
+	identity
 	params     []*NameAndType
 	returnType Type
+	variadic   bool
 }
 
 func NewSignature(params []*NameAndType, returnType Type) *Signature {
-	return &Signature{params, returnType}
+	return newSignature(params, returnType, false)
+}
+
+// NewVariadicSignature returns the signature of an external function that
+// takes any number of arguments after params, like C's printf.
+func NewVariadicSignature(params []*NameAndType, returnType Type) *Signature {
+	return newSignature(params, returnType, true)
+}
+
+func newSignature(params []*NameAndType, returnType Type, variadic bool) *Signature {
+	key, defaults := newTypeKey('f').bool(variadic).list(params)
+	key = key.typ(returnType)
+	return intern(string(key), &Signature{params: params, returnType: returnType, variadic: variadic}, defaults)
 }
 
 func (sig *Signature) Params() []*NameAndType { return sig.params }
 func (sig *Signature) ReturnType() Type       { return sig.returnType }
+func (sig *Signature) Variadic() bool         { return sig.variadic }
 
 func (sig *Signature) String() string {
 	var b strings.Builder
@@ -129,6 +245,12 @@ func (sig *Signature) String() string {
 			b.WriteString(", ")
 		}
 	}
+	if sig.variadic {
+		if len(sig.params) > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("...")
+	}
 	b.WriteString(") ")
 	fmt.Fprintf(&b, "%s", sig.ReturnType())
 	return b.String()
@@ -138,22 +260,17 @@ func (sig *Signature) IsAssignableTo(other Type) bool {
 	return sig.Equal(other)
 }
 
-func (sig *Signature) Equal(other Type) bool {
-	otherSig, isSig := other.(*Signature)
-	if !isSig {
-		return false
-	}
-
-	return slices.EqualFunc(sig.Params(), otherSig.Params(), func(a, b *NameAndType) bool {
-		return a.Name() == b.Name() && a.Type().Equal(b.Type())
-	}) && sig.ReturnType().Equal(otherSig.ReturnType())
-}
+func (sig *Signature) Equal(other Type) bool { return identical(sig, other) }
 
 type SliceType struct {
+	identity
 	element Type
 }
 
-func NewSliceType(element Type) *SliceType { return &SliceType{element} }
+func NewSliceType(element Type) *SliceType {
+	key := newTypeKey('s').typ(element)
+	return intern(string(key), &SliceType{element: element}, false)
+}
 
 func (typ *SliceType) Element() Type { return typ.element }
 
@@ -161,18 +278,36 @@ func (typ *SliceType) IsAssignableTo(other Type) bool {
 	return typ.Equal(other)
 }
 
-func (typ *SliceType) Equal(other Type) bool {
-	otherSlice, isSlice := other.(*SliceType)
-	if !isSlice {
-		return false
-	}
-	return typ.Element().Equal(otherSlice.Element())
-}
+func (typ *SliceType) Equal(other Type) bool { return identical(typ, other) }
 
 func (typ *SliceType) String() string {
 	return fmt.Sprintf("[]%s", typ.Element())
 }
 
+type ArrayType struct {
+	identity
+	element Type
+	length  int64
+}
+
+func NewArrayType(element Type, length int64) *ArrayType {
+	key := newTypeKey('a').int(length).typ(element)
+	return intern(string(key), &ArrayType{element: element, length: length}, false)
+}
+
+func (typ *ArrayType) Element() Type { return typ.element }
+func (typ *ArrayType) Len() int64    { return typ.length }
+
+func (typ *ArrayType) IsAssignableTo(other Type) bool {
+	return typ.Equal(other)
+}
+
+func (typ *ArrayType) Equal(other Type) bool { return identical(typ, other) }
+
+func (typ *ArrayType) String() string {
+	return fmt.Sprintf("[%d]%s", typ.length, typ.Element())
+}
+
 type ExistentialType struct {
 	trait Type
 }
@@ -186,12 +321,14 @@ func (typ *ExistentialType) IsAssignableTo(other Type) bool {
 }
 
 type TraitType struct {
+	identity
 	closed       bool
 	requirements []*NameAndType
 }
 
 func NewTraitType(closed bool, requirements []*NameAndType) *TraitType {
-	return &TraitType{closed, requirements}
+	key, defaults := newTypeKey('t').bool(closed).list(requirements)
+	return intern(string(key), &TraitType{closed: closed, requirements: requirements}, defaults)
 }
 
 func (typ *TraitType) Closed() bool { return typ.closed }
@@ -202,36 +339,47 @@ func (typ *TraitType) IsAssignableTo(other Type) bool {
 	return false // TODO
 }
 
-func (typ *TraitType) Equal(other Type) bool {
-	otherTrait, isTrait := other.(*TraitType)
-	if !isTrait {
-		return false
-	}
-	return typ.Closed() == otherTrait.Closed() && slices.EqualFunc(typ.requirements, otherTrait.requirements, func(a, b *NameAndType) bool {
-		return a.Name() == b.Name() && a.Type().Equal(b.Type())
-	})
-}
+func (typ *TraitType) Equal(other Type) bool { return identical(typ, other) }
 
 func (typ *TraitType) String() string {
 	return "trait"
 }
 
 type StructType struct {
+	identity
 	members []*NameAndType
 }
 
-func NewStructType(members []*NameAndType) *StructType { return &StructType{members} }
+func NewStructType(members []*NameAndType) *StructType {
+	key, defaults := newTypeKey('S').list(members)
+	return intern(string(key), &StructType{members: members}, defaults)
+}
+
+// newPlaceholderType returns a struct type distinct from every other
+// type, which stands in for a struct or union type while its members are
+// checked.
+func newPlaceholderType() *StructType {
+	return &StructType{identity: identity{id: typeCtx.newID()}}
+}
 
 func (typ *StructType) Members() []*NameAndType { return typ.members }
 
-func (typ *StructType) IsAssignableTo(other Type) bool {
-	return false
+// Member returns the member of typ called name, or nil if there is none.
+func (typ *StructType) Member(name string) *NameAndType {
+	for _, m := range typ.members {
+		if m.Name() == name {
+			return m
+		}
+	}
+	return nil
 }
 
-func (typ *StructType) Equal(other Type) bool {
-	return other == typ
+func (typ *StructType) IsAssignableTo(other Type) bool {
+	return typ.Equal(other)
 }
 
+func (typ *StructType) Equal(other Type) bool { return identical(typ, other) }
+
 func (typ *StructType) String() string {
 	members := make([]string, 0, len(typ.members))
 	for _, m := range typ.members {
@@ -240,18 +388,129 @@ func (typ *StructType) String() string {
 	return fmt.Sprintf("struct(%s)", strings.Join(members, ", "))
 }
 
+// UnionType is a type whose members all share the same storage.
+type UnionType struct {
+	identity
+	members []*NameAndType
+}
+
+func NewUnionType(members []*NameAndType) *UnionType {
+	key, defaults := newTypeKey('U').list(members)
+	return intern(string(key), &UnionType{members: members}, defaults)
+}
+
+func (typ *UnionType) Members() []*NameAndType { return typ.members }
+
+// Member returns the member of typ called name, or nil if there is none.
+func (typ *UnionType) Member(name string) *NameAndType {
+	for _, m := range typ.members {
+		if m.Name() == name {
+			return m
+		}
+	}
+	return nil
+}
+
+func (typ *UnionType) IsAssignableTo(other Type) bool {
+	return typ.Equal(other)
+}
+
+func (typ *UnionType) Equal(other Type) bool { return identical(typ, other) }
+
+func (typ *UnionType) String() string {
+	members := make([]string, 0, len(typ.members))
+	for _, m := range typ.members {
+		members = append(members, m.String())
+	}
+	return fmt.Sprintf("union(%s)", strings.Join(members, ", "))
+}
+
+// Named is a type introduced by a newtype or struct declaration. It is
+// distinct from every other type, including its underlying type, while a
+// constant bound to a type is only an alias for it.
+type Named struct {
+	identity
+	sym        Symbol
+	underlying Type
+	methods    []*Function
+}
+
+func NewNamed(sym Symbol, underlying Type) *Named {
+	return &Named{identity: identity{id: typeCtx.newID()}, sym: sym, underlying: underlying}
+}
+
+// Symbol returns the symbol declaring n.
+func (n *Named) Symbol() Symbol { return n.sym }
+
+// Underlying returns the type n was declared with. It is never itself a
+// named type.
+func (n *Named) Underlying() Type { return n.underlying }
+
+// Methods returns the methods defined for n by impl declarations, in the
+// order they were declared.
+func (n *Named) Methods() []*Function { return n.methods }
+
+// Method returns the method of n called name, or nil if there is none.
+func (n *Named) Method(name string) *Function {
+	for _, m := range n.methods {
+		if m.Name() == name {
+			return m
+		}
+	}
+	return nil
+}
+
+func (n *Named) IsAssignableTo(other Type) bool {
+	return n.Equal(other)
+}
+
+func (n *Named) Equal(other Type) bool { return identical(n, other) }
+
+func (n *Named) String() string { return n.sym.Name() }
+
+// Underlying returns the underlying type of typ if it is a named type, and
+// typ otherwise.
+func Underlying(typ Type) Type {
+	if named, isNamed := typ.(*Named); isNamed {
+		return named.underlying
+	}
+	return typ
+}
+
 type NameAndType struct {
 	name string
 	typ  Type
+	def  Value
 }
 
 func NewNameAndType(name string, typ Type) *NameAndType {
-	return &NameAndType{name, typ}
+	return &NameAndType{name: name, typ: typ}
 }
 
 func (nt *NameAndType) Name() string { return nt.name }
 func (nt *NameAndType) Type() Type   { return nt.typ }
 
+// Default returns the value used for the parameter or member when a call
+// omits it, or nil if it must be given.
+func (nt *NameAndType) Default() Value { return nt.def }
+
 func (nt *NameAndType) String() string {
 	return fmt.Sprintf("%s: %s", nt.Name(), nt.Type())
 }
+
+// InvalidType is the type of expressions that failed to check. Checks
+// involving it always succeed, so that each error is reported only once.
+type InvalidType struct{ identity }
+
+var Invalid = intern("invalid", &InvalidType{}, false)
+
+func (*InvalidType) IsAssignableTo(other Type) bool { return true }
+
+func (i *InvalidType) Equal(other Type) bool { return identical(i, other) }
+
+func (*InvalidType) String() string { return "invalid type" }
+
+func isInvalid(typ Type) bool {
+	_, invalid := Underlying(typ).(*InvalidType)
+	return invalid
+}
@@ -0,0 +1,152 @@
+package semantics
+
+import (
+	"fmt"
+	"maps"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"weak"
+
+	"codeberg.org/rileyq/usagi/internal/compile/parser"
+)
+
+func TestTypeIdentity(t *testing.T) {
+	u8 := NewIntegerType(false, 8)
+	point := func() *StructType {
+		return NewStructType([]*NameAndType{NewNameAndType("x", NewIntegerType(true, 32)), NewNameAndType("y", NewIntegerType(true, 32))})
+	}
+	withDefault := NewNameAndType("x", NewIntegerType(true, 32))
+	withDefault.def = NewIntegerLiteral(nil)
+
+	fromName, err := NewIntegerTypeFromName("u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identical := []struct{ a, b Type }{
+		{NewIntegerType(false, 8), u8},
+		{fromName, u8},
+		{NewSliceType(NewIntegerType(false, 8)), NewSliceType(u8)},
+		{NewManyPointer(NewArrayType(u8, 4)), NewManyPointer(NewArrayType(u8, 4))},
+		{point(), point()},
+		{NewSignature([]*NameAndType{NewNameAndType("p", point())}, Bool), NewSignature([]*NameAndType{NewNameAndType("p", point())}, Bool)},
+		{(&Builtin{BuiltinImport}).Type(), (&Builtin{BuiltinImport}).Type()},
+	}
+	for _, test := range identical {
+		if test.a != test.b {
+			t.Errorf("%s and %s are not the same type", test.a, test.b)
+		}
+	}
+
+	// Types differing only in defaults are equal but kept apart, as calls
+	// depend on their defaults.
+	a := NewStructType([]*NameAndType{withDefault})
+	b := NewStructType([]*NameAndType{NewNameAndType("x", NewIntegerType(true, 32))})
+	if a == b || !a.Equal(b) || !b.Equal(a) {
+		t.Errorf("struct with default: got identical %v, equal %v; want distinct but equal", a == b, a.Equal(b))
+	}
+
+	distinct := []struct{ a, b Type }{
+		{NewIntegerType(false, 8), NewIntegerType(true, 8)},
+		{NewPointer(u8), NewManyPointer(u8)},
+		{NewArrayType(u8, 4), NewArrayType(u8, 5)},
+		{NewStructType([]*NameAndType{NewNameAndType("x", u8)}), NewUnionType([]*NameAndType{NewNameAndType("x", u8)})},
+		{NewStructType([]*NameAndType{NewNameAndType("x", u8)}), NewStructType([]*NameAndType{NewNameAndType("y", u8)})},
+		{NewSignature(nil, u8), NewVariadicSignature(nil, u8)},
+		{NewNamed(nil, u8), NewNamed(nil, u8)},
+	}
+	for _, test := range distinct {
+		if test.a.Equal(test.b) {
+			t.Errorf("%s and %s are equal", test.a, test.b)
+		}
+	}
+}
+
+// largeModule returns the source of a module declaring n structs, each
+// with a function using it and the struct before it.
+func largeModule(n int) string {
+	var b strings.Builder
+	b.WriteString("struct S0(a: i32, next: []S0);\n")
+	for i := 1; i < n; i++ {
+		fmt.Fprintf(&b, "struct S%d(prev: S%d, next: []S%d, data: [*]u8, f: func(x: []S%d) i32);\n", i, i-1, i, i-1)
+		fmt.Fprintf(&b, `func f%d(s: S%d, p: []S%d) i32 {
+	let x: i32 = 1;
+	if s.f(p) == x {
+		x = s.f(s.prev.next) + x;
+	}
+	return x;
+}
+`, i, i, i-1)
+	}
+	return b.String()
+}
+
+// TestTypeRelease covers the removal of the entries of released types,
+// which the runtime calls release for once an entry is unreachable.
+func TestTypeRelease(t *testing.T) {
+	u8 := NewIntegerType(false, 8)
+	live := NewArrayType(u8, 1<<40)
+	if NewArrayType(u8, 1<<40) != live {
+		t.Error("a type in use was not shared")
+	}
+
+	ctx := &typeContext{entries: map[string]weak.Pointer[typeEntry]{}}
+	released, kept := &typeEntry{id: 1}, &typeEntry{id: 2}
+	ctx.entries["released"] = weak.Make(released)
+	ctx.entries["kept"] = weak.Make(kept)
+	ctx.release(releasedEntry{"released", weak.Make(released)})
+	// The key was given a new entry after the one released.
+	ctx.release(releasedEntry{"kept", weak.Make(&typeEntry{id: 3})})
+	if _, found := ctx.entries["released"]; found || ctx.size() != 1 {
+		t.Errorf("got entries %v, want only kept", slices.Sorted(maps.Keys(ctx.entries)))
+	}
+	runtime.KeepAlive(released)
+	runtime.KeepAlive(kept)
+
+	ctx.named = map[namedKey]weak.Pointer[Named]{}
+	named := NewNamed(nil, u8)
+	key := namedKey{"lib", "S"}
+	ctx.named[key] = weak.Make(named)
+	ctx.releaseNamed(releasedNamed{key, weak.Make(NewNamed(nil, u8))})
+	if ctx.named[key].Value() != named {
+		t.Error("a named type was released for an earlier one with its name")
+	}
+	ctx.releaseNamed(releasedNamed{key, weak.Make(named)})
+	if len(ctx.named) != 0 {
+		t.Error("a released named type was kept")
+	}
+}
+
+func BenchmarkCheck(b *testing.B) {
+	src := []byte(largeModule(500))
+	moduleAst, err := parser.ParseBytes("large", src)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := Check(&CheckConfig{Module: moduleAst, CheckFuncBodies: true}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEqual(b *testing.B) {
+	_, module, err := loadModule("large", largeModule(500), nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	// The signatures of the last functions are deep but distinct, so
+	// structural comparison would have to walk them.
+	f := module.Scope().Lookup("f499").Type()
+	g := module.Scope().Lookup("f498").Type()
+	s := Underlying(module.Scope().Lookup("S499").Type())
+	slice := NewSliceType(s)
+	for b.Loop() {
+		if f.Equal(g) || !slice.Equal(NewSliceType(s)) {
+			b.Fatal("wrong result")
+		}
+	}
+}
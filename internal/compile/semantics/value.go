@@ -3,6 +3,10 @@ package semantics
 import (
 	"fmt"
 	"math/big"
+	"strconv"
+	"strings"
+
+	"codeberg.org/rileyq/usagi/internal/compile/ast"
 )
 
 type Value interface {
@@ -23,6 +27,14 @@ const (
 	_ BuiltinID = iota
 	BuiltinImport
 	BuiltinExtern
+	BuiltinAs
+	BuiltinIntCast
+	BuiltinTruncate
+	BuiltinBitCast
+	BuiltinSizeOf
+	BuiltinAlignOf
+	BuiltinOffsetOf
+	BuiltinExport
 )
 
 func (id BuiltinID) String() string {
@@ -31,6 +43,22 @@ func (id BuiltinID) String() string {
 		return "@extern"
 	case BuiltinImport:
 		return "@import"
+	case BuiltinAs:
+		return "@as"
+	case BuiltinIntCast:
+		return "@intCast"
+	case BuiltinTruncate:
+		return "@truncate"
+	case BuiltinBitCast:
+		return "@bitCast"
+	case BuiltinSizeOf:
+		return "@sizeOf"
+	case BuiltinAlignOf:
+		return "@alignOf"
+	case BuiltinOffsetOf:
+		return "@offsetOf"
+	case BuiltinExport:
+		return "@export"
 	default:
 		panic(fmt.Sprintf("unexpected semantics.BuiltinID: %#v", id))
 	}
@@ -49,7 +77,21 @@ func (value *Builtin) Type() Type {
 	case BuiltinImport:
 		return NewSignature([]*NameAndType{NewNameAndType("name", stringLiteral)}, typeTrait)
 	case BuiltinExtern:
-		return NewSignature([]*NameAndType{NewNameAndType("linkName", stringLiteral)}, typeTrait)
+		return NewSignature([]*NameAndType{
+			NewNameAndType("linkName", stringLiteral),
+			{name: "callconv", typ: stringLiteral, def: NewStringLiteral(CallC.String())},
+			{name: "weak", typ: Bool, def: NewBoolLiteral(false)},
+			{name: "threadLocal", typ: Bool, def: NewBoolLiteral(false)},
+			{name: "library", typ: stringLiteral, def: NewStringLiteral("")},
+		}, typeTrait)
+	case BuiltinExport:
+		return NewSignature([]*NameAndType{NewNameAndType("linkName", stringLiteral), NewNameAndType("value", typeTrait)}, typeTrait)
+	case BuiltinAs, BuiltinIntCast, BuiltinTruncate, BuiltinBitCast:
+		return NewSignature([]*NameAndType{NewNameAndType("T", typeTrait), NewNameAndType("value", UntypedInt)}, typeTrait)
+	case BuiltinSizeOf, BuiltinAlignOf:
+		return NewSignature([]*NameAndType{NewNameAndType("T", typeTrait)}, UntypedInt)
+	case BuiltinOffsetOf:
+		return NewSignature([]*NameAndType{NewNameAndType("T", typeTrait), NewNameAndType("member", stringLiteral)}, UntypedInt)
 	default:
 		panic("unimplemented builtin")
 	}
@@ -71,39 +113,90 @@ func (s *StringLiteral) Type() Type {
 	return NewSliceType(NewIntegerType(false, 8))
 }
 
+// An IntegerLiteral is an integer constant. Constants without a type are
+// untyped.
 type IntegerLiteral struct {
 	value *big.Int
+	typ   *IntegerType
 }
 
-func NewIntegerLiteral(value *big.Int) *IntegerLiteral { return &IntegerLiteral{value} }
+func NewIntegerLiteral(value *big.Int) *IntegerLiteral { return &IntegerLiteral{value, nil} }
+
+func NewTypedIntegerLiteral(value *big.Int, typ *IntegerType) *IntegerLiteral {
+	return &IntegerLiteral{value, typ}
+}
 
 func NewIntegerLiteralFromString(value string) (*IntegerLiteral, error) {
-	v := &big.Int{}
-	v.SetString(value, 0)
+	v, ok := new(big.Int).SetString(value, 0)
+	if !ok {
+		return nil, fmt.Errorf("invalid integer literal %s", value)
+	}
 	return NewIntegerLiteral(v), nil
 }
 
 func (value *IntegerLiteral) Value() *big.Int { return value.value }
 
 func (value *IntegerLiteral) Type() Type {
-	return NewIntegerType(value.value.Sign() < 0, value.value.BitLen())
+	if value.typ == nil {
+		return UntypedInt
+	}
+	return value.typ
 }
 
 func (value *IntegerLiteral) String() string {
 	return value.value.String()
 }
 
-type ExternalSymbol struct{ nt *NameAndType }
+type BoolLiteral struct{ value bool }
 
-func NewExternalSymbol(name string, typ Type) *ExternalSymbol {
-	return &ExternalSymbol{NewNameAndType(name, typ)}
+func NewBoolLiteral(value bool) *BoolLiteral { return &BoolLiteral{value} }
+
+func (value *BoolLiteral) Value() bool { return value.value }
+func (value *BoolLiteral) Type() Type  { return Bool }
+
+func (value *BoolLiteral) String() string { return strconv.FormatBool(value.value) }
+
+// ExternOptions are the options given to @extern besides the link name.
+// The zero value describes a strong, C-callable symbol from any library.
+type ExternOptions struct {
+	CallingConvention CallingConvention
+	Weak              bool
+	ThreadLocal       bool
+	// Library is the library the symbol is linked from, or "" if it is
+	// left to the linker to find.
+	Library string
 }
 
-func (e *ExternalSymbol) Name() string { return e.nt.Name() }
-func (e *ExternalSymbol) Type() Type   { return e.nt.Type() }
+type ExternalSymbol struct {
+	nt   *NameAndType
+	opts ExternOptions
+}
+
+func NewExternalSymbol(name string, typ Type, opts ExternOptions) *ExternalSymbol {
+	return &ExternalSymbol{NewNameAndType(name, typ), opts}
+}
+
+func (e *ExternalSymbol) Name() string           { return e.nt.Name() }
+func (e *ExternalSymbol) Type() Type             { return e.nt.Type() }
+func (e *ExternalSymbol) Options() ExternOptions { return e.opts }
 
 func (e *ExternalSymbol) String() string {
-	return fmt.Sprintf("@extern(%q)", e.Name())
+	var b strings.Builder
+	fmt.Fprintf(&b, "@extern(%q", e.Name())
+	if e.opts.CallingConvention != CallC {
+		fmt.Fprintf(&b, ", callconv: %q", e.opts.CallingConvention)
+	}
+	if e.opts.Weak {
+		b.WriteString(", weak: true")
+	}
+	if e.opts.ThreadLocal {
+		b.WriteString(", threadLocal: true")
+	}
+	if e.opts.Library != "" {
+		fmt.Fprintf(&b, ", library: %q", e.opts.Library)
+	}
+	b.WriteString(")")
+	return b.String()
 }
 
 type ModuleImport struct {
@@ -134,3 +227,57 @@ func NewNamedArgument(name string, arg *TypeAndValue) *NamedArgument {
 func (value *NamedArgument) Name() string { return value.name }
 func (value *NamedArgument) Type() Type   { return value.arg.Type() }
 func (value *NamedArgument) Value() Value { return value.arg.Value() }
+
+// A Function is a function with a body that can be evaluated at compile
+// time.
+type Function struct {
+	name  string
+	sig   *Signature
+	decl  *ast.FuncExpr
+	scope *Scope
+}
+
+func NewFunction(name string, sig *Signature, decl *ast.FuncExpr, scope *Scope) *Function {
+	return &Function{name, sig, decl, scope}
+}
+
+// module returns the module declaring fn, or nil if it was read from
+// export data.
+func (fn *Function) module() *Module {
+	if fn.scope == nil {
+		return nil
+	}
+	return fn.scope.Module()
+}
+
+func (fn *Function) Name() string          { return fn.name }
+func (fn *Function) Signature() *Signature { return fn.sig }
+func (fn *Function) Decl() *ast.FuncExpr   { return fn.decl }
+func (fn *Function) Type() Type            { return fn.sig }
+func (fn *Function) String() string        { return fmt.Sprintf("func %s", fn.name) }
+
+type StructValue struct {
+	typ    Type
+	fields []Value
+}
+
+// NewStructValue returns a value of typ, a struct type or a named type
+// whose underlying type is a struct, with the given field values.
+func NewStructValue(typ Type, fields []Value) *StructValue {
+	return &StructValue{typ, fields}
+}
+
+func (value *StructValue) Fields() []Value { return value.fields }
+func (value *StructValue) Type() Type      { return value.typ }
+
+func (value *StructValue) structType() *StructType {
+	return Underlying(value.typ).(*StructType)
+}
+
+func (value *StructValue) String() string {
+	fields := make([]string, 0, len(value.fields))
+	for i, field := range value.fields {
+		fields = append(fields, fmt.Sprintf("%s: %s", value.structType().Members()[i].Name(), valueString(field)))
+	}
+	return fmt.Sprintf("%s(%s)", value.typ, strings.Join(fields, ", "))
+}
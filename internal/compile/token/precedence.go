@@ -14,7 +14,7 @@ func (t Type) Precedence() Precedence {
 	switch t {
 	case Assign:
 		return PrecedenceAssignment
-	case Less:
+	case Less, LessEqual, Greater, GreaterEqual, Equal, NotEqual:
 		return PrecedenceRelational
 	case Minus, Plus:
 		return PrecedenceAddition
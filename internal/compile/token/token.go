@@ -10,3 +10,13 @@ type Token struct {
 	End  Pos
 	Text string
 }
+
+// Lookup returns the token type whose String is name.
+func Lookup(name string) (Type, bool) {
+	for i, n := range names {
+		if n == name {
+			return Type(i), true
+		}
+	}
+	return Invalid, false
+}
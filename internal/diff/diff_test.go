@@ -0,0 +1,71 @@
+package diff
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	new := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	const want = `--- old
++++ new
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -9,3 +9,4 @@
+ i
+ j
+ k
++l
+`
+	if got := string(Unified("old", "new", []byte(old), []byte(new))); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := Unified("old", "new", []byte(old), []byte(old)); got != nil {
+		t.Errorf("equal inputs produced a diff:\n%s", got)
+	}
+
+	const wantEOF = `--- old
++++ new
+@@ -1 +1 @@
+-x
+\ No newline at end of file
++x
+`
+	if got := string(Unified("old", "new", []byte("x"), []byte("x\n"))); got != wantEOF {
+		t.Errorf("got:\n%s\nwant:\n%s", got, wantEOF)
+	}
+}
+
+func TestLines(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	randomLines := func() []string {
+		lines := make([]string, rng.IntN(40))
+		for i := range lines {
+			lines[i] = string(rune('a'+rng.IntN(4))) + "\n"
+		}
+		return lines
+	}
+	for range 200 {
+		a, b := randomLines(), randomLines()
+		var gotA, gotB []string
+		for _, o := range lines(a, b) {
+			if o.kind != opInsert {
+				gotA = append(gotA, o.line)
+			}
+			if o.kind != opDelete {
+				gotB = append(gotB, o.line)
+			}
+		}
+		if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+			t.Fatalf("edit script from %q to %q gives %q and %q", a, b, gotA, gotB)
+		}
+	}
+}